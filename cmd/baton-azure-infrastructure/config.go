@@ -14,6 +14,64 @@ var (
 	azureClientId     = field.StringField("azure-client-id", field.WithDescription("Azure Client ID"))
 	mailboxSettings   = field.BoolField("mailboxSettings", field.WithDescription("If true, attempt to get mailbox settings for users to determine user purpose"))
 	skipAdGroups      = field.BoolField("skip-ad-groups", field.WithDescription("If true, skip syncing Windows Server Active Directory groups"))
+	deltaSync         = field.BoolField("delta-sync",
+		field.WithDescription("If true, list users and groups through Microsoft Graph delta queries and only read the group memberships that changed since the previous sync. User last login isn't synced in this mode"))
+	signInLookbackHours = field.IntField("sign-in-lookback-hours",
+		field.WithDescription("How many hours of sign-in logs to report as enterprise application usage events, 0 disables them"),
+		field.WithDefaultValue(24))
+	resourceGraph = field.BoolField("resource-graph",
+		field.WithDescription("If true, read subscriptions, resource groups and role assignments for the whole tenant through Azure Resource Graph"))
+	azureCloud = field.StringField("azure-cloud",
+		field.WithDescription("The Azure cloud to connect to: AzureCloud, AzureUSGovernment, AzureUSGovernmentDoD or AzureChinaCloud"),
+		field.WithDefaultValue("AzureCloud"))
+	azureClientCertificatePath = field.StringField("azure-client-certificate-path",
+		field.WithDescription("Path to a PEM or PFX file holding the certificate and private key to authenticate the app registration with"))
+	azureClientCertificatePassword = field.StringField("azure-client-certificate-password",
+		field.WithDescription("Password of an encrypted client certificate file"))
+	azureFederatedTokenFile = field.StringField("azure-federated-token-file",
+		field.WithDescription("Path to a token file, e.g. a Kubernetes service account token, to authenticate the app registration with through workload identity federation"))
+	useManagedIdentity = field.BoolField("use-managed-identity",
+		field.WithDescription("If true, authenticate as the managed identity of the host"))
+	managedIdentityClientId = field.StringField("managed-identity-client-id",
+		field.WithDescription("Client ID of the user-assigned managed identity to authenticate as, the system-assigned identity is used if empty"))
+	subscriptionIds = field.StringSliceField("subscription-ids",
+		field.WithDescription("Only sync these subscription IDs, along with subscriptions matching subscription-names"))
+	excludeSubscriptionIds = field.StringSliceField("exclude-subscription-ids",
+		field.WithDescription("Subscription IDs to skip"))
+	subscriptionNames = field.StringSliceField("subscription-names",
+		field.WithDescription("Only sync subscriptions whose display name matches one of these glob patterns, along with subscriptions listed in subscription-ids"))
+	excludeSubscriptionNames = field.StringSliceField("exclude-subscription-names",
+		field.WithDescription("Skip subscriptions whose display name matches one of these glob patterns, e.g. sandbox-*"))
+	managementGroups = field.StringSliceField("management-groups",
+		field.WithDescription("Only sync subscriptions below these management group IDs"))
+	resourceGroups = field.StringSliceField("resource-groups",
+		field.WithDescription("Only sync resource groups, and role assignments made in them, whose name matches one of these glob patterns"))
+	excludeResourceGroups = field.StringSliceField("exclude-resource-groups",
+		field.WithDescription("Skip resource groups, and role assignments made in them, whose name matches one of these glob patterns"))
+	userFilter = field.StringField("user-filter",
+		field.WithDescription("OData $filter expression selecting the users to sync, e.g. \"accountEnabled eq true and userType eq 'Member'\""))
+	groupFilter = field.StringField("group-filter",
+		field.WithDescription("OData $filter expression selecting the groups to sync"))
+	servicePrincipalFilter = field.StringField("service-principal-filter",
+		field.WithDescription("OData $filter expression selecting the enterprise applications and managed identities to sync"))
+	assignedRolesOnly = field.BoolField("assigned-roles-only",
+		field.WithDescription("If true, only sync the role definitions of a subscription that have an active or eligible assignment, along with always-included-roles"))
+	alwaysIncludedRoles = field.StringSliceField("always-included-roles",
+		field.WithDescription("Role names or role definition IDs synced even when they aren't assigned, when assigned-roles-only is set"),
+		field.WithDefaultValue([]string{"Owner", "Contributor", "Reader", "User Access Administrator"}))
+	httpRecordDir = field.StringField("http-record-dir",
+		field.WithDescription("Directory to record Microsoft Graph and Azure Resource Manager requests and responses to as fixtures, with tokens and personal data redacted"))
+	httpReplayDir = field.StringField("http-replay-dir",
+		field.WithDescription("Directory of fixtures recorded with http-record-dir to answer Microsoft Graph and Azure Resource Manager requests from instead of the network"))
+	maxRetries = field.IntField("max-retries",
+		field.WithDescription("How many times throttled or transiently failing Microsoft Graph and Azure Resource Manager requests are retried"),
+		field.WithDefaultValue(5))
+	subscriptionParallelism = field.IntField("subscription-parallelism",
+		field.WithDescription("How many subscriptions to read role definitions, role assignments and resource groups from at once"),
+		field.WithDefaultValue(4))
+	userAttributes = field.StringSliceField("user-attributes",
+		field.WithDescription("Additional Microsoft Graph user properties to sync into the user profile, "+
+			"e.g. costCenter, employeeOrgData, onPremisesSamAccountName, extension_<appId>_<name> or customSecurityAttributes/<set>"))
 )
 
 var ConfigurationFields = []field.SchemaField{
@@ -21,13 +79,42 @@ var ConfigurationFields = []field.SchemaField{
 	azureClientSecret,
 	azureTenantId,
 	azureClientId,
+	azureClientCertificatePath,
+	azureClientCertificatePassword,
+	azureFederatedTokenFile,
+	useManagedIdentity,
+	managedIdentityClientId,
+	azureCloud,
 	mailboxSettings,
 	skipAdGroups,
+	userAttributes,
+	deltaSync,
+	signInLookbackHours,
+	resourceGraph,
+	maxRetries,
+	subscriptionParallelism,
+	subscriptionIds,
+	excludeSubscriptionIds,
+	subscriptionNames,
+	excludeSubscriptionNames,
+	managementGroups,
+	resourceGroups,
+	excludeResourceGroups,
+	userFilter,
+	groupFilter,
+	servicePrincipalFilter,
+	assignedRolesOnly,
+	alwaysIncludedRoles,
+	httpRecordDir,
+	httpReplayDir,
 }
 
 var FieldRelationships = []field.SchemaFieldRelationship{
 	field.FieldsMutuallyExclusive(useCliCredentials, azureClientId),
 	field.FieldsMutuallyExclusive(useCliCredentials, azureClientSecret),
+	field.FieldsMutuallyExclusive(azureClientSecret, azureClientCertificatePath, azureFederatedTokenFile),
+	field.FieldsDependentOn([]field.SchemaField{azureClientCertificatePassword}, []field.SchemaField{azureClientCertificatePath}),
+	field.FieldsMutuallyExclusive(httpRecordDir, httpReplayDir),
 }
 
 var cfg = field.NewConfiguration(ConfigurationFields, FieldRelationships...)
@@ -37,8 +124,43 @@ func ValidateConfig(v *viper.Viper) error {
 	useCliCredentials := v.GetBool(useCliCredentials.FieldName)
 	azureClientSecret := v.GetString(azureClientSecret.FieldName)
 	azureClientId := v.GetString(azureClientId.FieldName)
+	azureTenantId := v.GetString(azureTenantId.FieldName)
+	azureClientCertificatePath := v.GetString(azureClientCertificatePath.FieldName)
+	azureClientCertificatePassword := v.GetString(azureClientCertificatePassword.FieldName)
+	azureFederatedTokenFile := v.GetString(azureFederatedTokenFile.FieldName)
+	useManagedIdentity := v.GetBool(useManagedIdentity.FieldName) || v.GetString(managedIdentityClientId.FieldName) != ""
 	if useCliCredentials && (azureClientSecret != "" || azureClientId != "") {
 		return fmt.Errorf("use-cli-credentials and azure-client-secret/azure-client-id are mutually exclusive")
 	}
+
+	methods := 0
+	for _, set := range []bool{
+		useCliCredentials,
+		azureClientSecret != "",
+		azureClientCertificatePath != "",
+		azureFederatedTokenFile != "",
+		useManagedIdentity,
+	} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return fmt.Errorf("use-cli-credentials, azure-client-secret, azure-client-certificate-path, azure-federated-token-file " +
+			"and use-managed-identity/managed-identity-client-id are mutually exclusive")
+	}
+
+	if azureClientCertificatePassword != "" && azureClientCertificatePath == "" {
+		return fmt.Errorf("azure-client-certificate-password requires azure-client-certificate-path")
+	}
+	if (azureClientCertificatePath != "" || azureFederatedTokenFile != "") && (azureTenantId == "" || azureClientId == "") {
+		return fmt.Errorf("azure-client-certificate-path and azure-federated-token-file require azure-tenant-id and azure-client-id")
+	}
+	if v.GetString(httpRecordDir.FieldName) != "" && v.GetString(httpReplayDir.FieldName) != "" {
+		return fmt.Errorf("http-record-dir and http-replay-dir are mutually exclusive")
+	}
+	if useManagedIdentity && azureClientId != "" {
+		return fmt.Errorf("use azure-client-id only with app registration credentials, managed-identity-client-id selects a user-assigned managed identity")
+	}
 	return nil
 }
@@ -14,7 +14,106 @@ func TestConfigs(t *testing.T) {
 	)
 
 	testCases := []test.TestCase{
-		// Add test cases here.
+		{
+			Configs: map[string]string{
+				"azure-tenant-id":     "tenant",
+				"azure-client-id":     "client",
+				"azure-client-secret": "secret",
+			},
+			IsValid: true,
+			Message: "client secret",
+		},
+		{
+			Configs: map[string]string{
+				"azure-tenant-id":                   "tenant",
+				"azure-client-id":                   "client",
+				"azure-client-certificate-path":     "/etc/baton/cert.pfx",
+				"azure-client-certificate-password": "password",
+			},
+			IsValid: true,
+			Message: "client certificate",
+		},
+		{
+			Configs: map[string]string{
+				"azure-tenant-id":               "tenant",
+				"azure-client-id":               "client",
+				"azure-client-secret":           "secret",
+				"azure-client-certificate-path": "/etc/baton/cert.pem",
+			},
+			IsValid: false,
+			Message: "client secret and certificate",
+		},
+		{
+			Configs: map[string]string{
+				"azure-client-certificate-path": "/etc/baton/cert.pem",
+			},
+			IsValid: false,
+			Message: "client certificate without app registration",
+		},
+		{
+			Configs: map[string]string{
+				"azure-client-certificate-password": "password",
+			},
+			IsValid: false,
+			Message: "certificate password without certificate",
+		},
+		{
+			Configs: map[string]string{
+				"azure-tenant-id":            "tenant",
+				"azure-client-id":            "client",
+				"azure-federated-token-file": "/var/run/secrets/azure/tokens/azure-identity-token",
+			},
+			IsValid: true,
+			Message: "workload identity",
+		},
+		{
+			Configs: map[string]string{
+				"azure-tenant-id":            "tenant",
+				"azure-client-id":            "client",
+				"azure-federated-token-file": "/var/run/secrets/azure/tokens/azure-identity-token",
+				"use-managed-identity":       "true",
+			},
+			IsValid: false,
+			Message: "workload identity and managed identity",
+		},
+		{
+			Configs: map[string]string{
+				"use-managed-identity": "true",
+			},
+			IsValid: true,
+			Message: "system-assigned managed identity",
+		},
+		{
+			Configs: map[string]string{
+				"azure-tenant-id":            "tenant",
+				"managed-identity-client-id": "identity",
+			},
+			IsValid: true,
+			Message: "user-assigned managed identity",
+		},
+		{
+			Configs: map[string]string{
+				"use-cli-credentials":  "true",
+				"use-managed-identity": "true",
+			},
+			IsValid: false,
+			Message: "cli and managed identity",
+		},
+		{
+			Configs: map[string]string{
+				"http-replay-dir": "testdata/fixtures",
+			},
+			IsValid: true,
+			Message: "replay",
+		},
+		{
+			Configs: map[string]string{
+				"http-record-dir": "testdata/fixtures",
+				"http-replay-dir": "testdata/fixtures",
+			},
+			IsValid: false,
+			Message: "record and replay",
+		},
 	}
 
 	test.ExerciseTestCases(t, configurationSchema, ValidateConfig, testCases)
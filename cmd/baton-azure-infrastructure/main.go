@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/conductorone/baton-azure-infrastructure/pkg/connector"
 	"github.com/conductorone/baton-sdk/pkg/config"
@@ -43,9 +44,66 @@ func getConnector(ctx context.Context, v *viper.Viper) (types.ConnectorServer, e
 	azureTenantId := v.GetString(azureTenantId.FieldName)
 	azureClientSecret := v.GetString(azureClientSecret.FieldName)
 	azureClientId := v.GetString(azureClientId.FieldName)
+	azureClientCertificatePath := v.GetString(azureClientCertificatePath.FieldName)
+	azureClientCertificatePassword := v.GetString(azureClientCertificatePassword.FieldName)
+	azureFederatedTokenFile := v.GetString(azureFederatedTokenFile.FieldName)
+	useManagedIdentity := v.GetBool(useManagedIdentity.FieldName)
+	managedIdentityClientId := v.GetString(managedIdentityClientId.FieldName)
+	azureCloud := v.GetString(azureCloud.FieldName)
 	mailboxSettings := v.GetBool(mailboxSettings.FieldName)
 	skipAdGroups := v.GetBool(skipAdGroups.FieldName)
-	cb, err := connector.New(ctx, useCliCredentials, azureTenantId, azureClientId, azureClientSecret, mailboxSettings, skipAdGroups)
+	userAttributes := v.GetStringSlice(userAttributes.FieldName)
+	deltaSync := v.GetBool(deltaSync.FieldName)
+	resourceGraph := v.GetBool(resourceGraph.FieldName)
+	maxRetries := v.GetInt(maxRetries.FieldName)
+	subscriptionParallelism := v.GetInt(subscriptionParallelism.FieldName)
+	subscriptionIds := v.GetStringSlice(subscriptionIds.FieldName)
+	excludeSubscriptionIds := v.GetStringSlice(excludeSubscriptionIds.FieldName)
+	subscriptionNames := v.GetStringSlice(subscriptionNames.FieldName)
+	excludeSubscriptionNames := v.GetStringSlice(excludeSubscriptionNames.FieldName)
+	managementGroups := v.GetStringSlice(managementGroups.FieldName)
+	resourceGroups := v.GetStringSlice(resourceGroups.FieldName)
+	excludeResourceGroups := v.GetStringSlice(excludeResourceGroups.FieldName)
+	userFilter := v.GetString(userFilter.FieldName)
+	groupFilter := v.GetString(groupFilter.FieldName)
+	servicePrincipalFilter := v.GetString(servicePrincipalFilter.FieldName)
+	assignedRolesOnly := v.GetBool(assignedRolesOnly.FieldName)
+	alwaysIncludedRoles := v.GetStringSlice(alwaysIncludedRoles.FieldName)
+	httpRecordDir := v.GetString(httpRecordDir.FieldName)
+	httpReplayDir := v.GetString(httpReplayDir.FieldName)
+	signInLookback := time.Duration(v.GetInt(signInLookbackHours.FieldName)) * time.Hour
+	opts := []connector.Option{
+		connector.WithCloud(azureCloud),
+		connector.WithClientCertificate(azureClientCertificatePath, azureClientCertificatePassword),
+		connector.WithWorkloadIdentity(azureFederatedTokenFile),
+		connector.WithManagedIdentity(useManagedIdentity, managedIdentityClientId),
+		connector.WithUserAttributes(userAttributes...),
+		connector.WithDeltaSync(deltaSync),
+		connector.WithSignInLookback(signInLookback),
+		connector.WithResourceGraph(resourceGraph),
+		connector.WithMaxRetries(maxRetries),
+		connector.WithSubscriptionParallelism(subscriptionParallelism),
+		connector.WithSubscriptionIDs(subscriptionIds...),
+		connector.WithExcludedSubscriptionIDs(excludeSubscriptionIds...),
+		connector.WithSubscriptionNames(subscriptionNames...),
+		connector.WithExcludedSubscriptionNames(excludeSubscriptionNames...),
+		connector.WithManagementGroups(managementGroups...),
+		connector.WithResourceGroups(resourceGroups...),
+		connector.WithExcludedResourceGroups(excludeResourceGroups...),
+		connector.WithUserFilter(userFilter),
+		connector.WithGroupFilter(groupFilter),
+		connector.WithServicePrincipalFilter(servicePrincipalFilter),
+		connector.WithAssignedRolesOnly(assignedRolesOnly),
+		connector.WithAlwaysIncludedRoles(alwaysIncludedRoles...),
+	}
+	if httpRecordDir != "" {
+		opts = append(opts, connector.WithRecording(httpRecordDir))
+	}
+	if httpReplayDir != "" {
+		opts = append(opts, connector.WithReplay(httpReplayDir))
+	}
+
+	cb, err := connector.New(ctx, useCliCredentials, azureTenantId, azureClientId, azureClientSecret, mailboxSettings, skipAdGroups, opts...)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
@@ -0,0 +1,254 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	activityLogAPIVersion         = "2015-04-01"
+	roleAssignmentWriteOperation  = "Microsoft.Authorization/roleAssignments/write"
+	roleAssignmentDeleteOperation = "Microsoft.Authorization/roleAssignments/delete"
+	activityLogStatusSucceeded    = "Succeeded"
+	activityLogResponseBodyKey    = "responseBody"
+	activityLogRequestBodyKey     = "requestbody"
+	activityLogSourcePrefix       = "activity_log:"
+)
+
+// activityLogSource reads role assignment writes and deletes from a subscription's Activity Log.
+// https://learn.microsoft.com/en-us/rest/api/monitor/activity-logs/list?view=rest-monitor-2015-04-01
+type activityLogSource struct {
+	conn           *Connector
+	subscriptionID string
+}
+
+func (s *activityLogSource) name() string {
+	return activityLogSourcePrefix + s.subscriptionID
+}
+
+func (s *activityLogSource) listEvents(ctx context.Context, since time.Time, reqURL string, _ int) ([]*v2.Event, string, time.Time, error) {
+	if reqURL == "" {
+		// The Activity Log requires both ends of the time range. since overlaps the previous pass, the entries it
+		// already returned are dropped by the cursor by eventDataId.
+		v := url.Values{}
+		v.Set("api-version", activityLogAPIVersion)
+		v.Set("$filter", fmt.Sprintf(
+			"eventTimestamp ge '%s' and eventTimestamp le '%s' and resourceProvider eq 'Microsoft.Authorization'",
+			graphFilterTime(since),
+			graphFilterTime(time.Now()),
+		))
+		reqURL = s.conn.buildARMURL(
+			path.Join("subscriptions", s.subscriptionID, "providers/Microsoft.Insights/eventtypes/management/values"),
+			v,
+		)
+	}
+
+	resp := &activityLogList{}
+	err := s.conn.queryUncached(ctx, armScopes, http.MethodGet, reqURL, nil, resp)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+
+	var (
+		latest       time.Time
+		changes      []*roleAssignmentChange
+		principalIDs []string
+	)
+	for _, entry := range resp.Value {
+		if entry.EventTimestamp.After(latest) {
+			latest = entry.EventTimestamp
+		}
+
+		change := s.roleAssignmentChange(ctx, entry)
+		if change == nil {
+			continue
+		}
+		changes = append(changes, change)
+		principalIDs = append(principalIDs, change.body.Properties.PrincipalID)
+	}
+	if len(changes) == 0 {
+		return nil, resp.NextLink, latest, nil
+	}
+
+	principalTypes, err := getPrincipalTypes(ctx, s.conn, principalIDs)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+
+	var rv []*v2.Event
+	for _, change := range changes {
+		principalType, ok := principalTypes[change.body.Properties.PrincipalID]
+		if !ok {
+			// The principal may have been deleted since; the next full sync reconciles it.
+			ctxzap.Extract(ctx).Debug("baton-azure-infrastructure: unable to resolve role assignment principal",
+				zap.String("principal_id", change.body.Properties.PrincipalID),
+			)
+			continue
+		}
+
+		event := s.roleAssignmentEvent(change, principalType)
+		if event != nil {
+			rv = append(rv, event)
+		}
+	}
+
+	return rv, resp.NextLink, latest, nil
+}
+
+// roleAssignmentChange is a succeeded role assignment write or delete read from the Activity Log.
+type roleAssignmentChange struct {
+	entry *activityLogEvent
+	body  *roleAssignmentLogBody
+	added bool
+	// scope is where the role was assigned, "" when the log entry doesn't say.
+	scope string
+}
+
+// roleAssignmentChange returns the role assignment written or deleted by the log entry, or nil when the entry
+// isn't a succeeded role assignment operation or its scope is filtered out.
+func (s *activityLogSource) roleAssignmentChange(ctx context.Context, entry *activityLogEvent) *roleAssignmentChange {
+	if entry.OperationName == nil || entry.Status == nil || entry.Status.Value != activityLogStatusSucceeded {
+		return nil
+	}
+
+	operation := entry.OperationName.Value
+	added := strings.EqualFold(operation, roleAssignmentWriteOperation)
+	if !added && !strings.EqualFold(operation, roleAssignmentDeleteOperation) {
+		return nil
+	}
+
+	body := activityLogRoleAssignment(entry)
+	if body == nil || body.Properties.RoleDefinitionID == "" || body.Properties.PrincipalID == "" {
+		ctxzap.Extract(ctx).Debug("baton-azure-infrastructure: activity log entry has no role assignment",
+			zap.String("event_data_id", entry.EventDataID),
+			zap.String("operation", operation),
+		)
+		return nil
+	}
+
+	scope := roleAssignmentScope(entry, body)
+	if resourceGroup := resourceGroupOfScope(scope); resourceGroup != "" && !s.conn.includeResourceGroup(resourceGroup) {
+		return nil
+	}
+
+	return &roleAssignmentChange{
+		entry: entry,
+		body:  body,
+		added: added,
+		scope: scope,
+	}
+}
+
+// roleAssignmentEvent translates a role assignment change into the grant or revoke of the assigned entitlement,
+// using the same resource and principal IDs as the builders. Assignments inside a resource group target the
+// resource group's role resource, other assignments the subscription's role.
+func (s *activityLogSource) roleAssignmentEvent(change *roleAssignmentChange, principalType string) *v2.Event {
+	principalID := getPrincipalIDResource(principalType, &armauthorization.RoleAssignment{
+		Properties: &armauthorization.RoleAssignmentProperties{
+			PrincipalID: &change.body.Properties.PrincipalID,
+		},
+	})
+	if principalID == nil {
+		return nil
+	}
+
+	roleID := path.Base(change.body.Properties.RoleDefinitionID)
+	target := &v2.Resource{
+		Id: &v2.ResourceId{
+			ResourceType: roleResourceType.Id,
+			Resource:     fmt.Sprintf("%s:%s", roleID, s.subscriptionID),
+		},
+	}
+	if resourceGroup := resourceGroupOfScope(change.scope); resourceGroup != "" {
+		target = &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: roleAssignmentResourceGroupType.Id,
+				Resource:     getResourceGroupID(resourceGroup, s.subscriptionID, roleID),
+			},
+		}
+	}
+
+	principal := &v2.Resource{Id: principalID}
+	entry := change.entry
+	if !change.added {
+		return newRevokeEvent(entry.EventDataID, entry.EventTimestamp, ent.NewAssignmentEntitlement(target, typeAssigned), principal)
+	}
+
+	return newGrantEvent(entry.EventDataID, entry.EventTimestamp, grant.NewGrant(target, typeAssigned, principalID))
+}
+
+// roleAssignmentScope returns the scope of the role assignment. Request bodies leave it out, but role assignment
+// IDs start with their scope.
+func roleAssignmentScope(entry *activityLogEvent, body *roleAssignmentLogBody) string {
+	if body.Properties.Scope != "" {
+		return body.Properties.Scope
+	}
+
+	const marker = "/providers/microsoft.authorization/roleassignments/"
+	for _, id := range []string{body.ID, entry.ResourceID} {
+		if i := strings.Index(strings.ToLower(id), marker); i >= 0 {
+			return id[:i]
+		}
+	}
+
+	return ""
+}
+
+// activityLogRoleAssignment reads the role assignment from the response body, falling back to the request body
+// which is all that is logged for some writes.
+func activityLogRoleAssignment(entry *activityLogEvent) *roleAssignmentLogBody {
+	for _, key := range []string{activityLogResponseBodyKey, activityLogRequestBodyKey} {
+		raw, ok := entry.Properties[key]
+		if !ok || raw == "" {
+			continue
+		}
+
+		body := &roleAssignmentLogBody{}
+		if err := json.Unmarshal([]byte(raw), body); err != nil {
+			continue
+		}
+
+		if body.Properties.RoleDefinitionID != "" {
+			return body
+		}
+	}
+
+	return nil
+}
+
+// listSubscriptionIDs returns the subscriptions visible to the connector that pass the subscription filters.
+func (d *Connector) listSubscriptionIDs(ctx context.Context) ([]string, error) {
+	var rv []string
+	pager := d.clientFactory.NewSubscriptionsClient().NewListPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, armError(err)
+		}
+
+		for _, subscription := range page.Value {
+			ok, err := d.includeSubscription(ctx, subscription)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				rv = append(rv, StringValue(subscription.SubscriptionID))
+			}
+		}
+	}
+
+	return rv, nil
+}
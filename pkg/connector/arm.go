@@ -0,0 +1,82 @@
+package connector
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azlog "github.com/Azure/azure-sdk-for-go/sdk/azcore/log"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	armresources "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	armsubscription "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/subscription/armsubscription"
+	"go.uber.org/zap"
+)
+
+// userAgent identifies the connector in Graph and ARM requests.
+const userAgent = "baton-azure-infrastructure"
+
+// userAgentPolicy puts the connector's user agent in front of the one the ARM SDK sets.
+type userAgentPolicy struct{}
+
+func (userAgentPolicy) Do(req *policy.Request) (*http.Response, error) {
+	header := req.Raw().Header
+	if ua := header.Get("User-Agent"); ua != "" {
+		header.Set("User-Agent", userAgent+" "+ua)
+	} else {
+		header.Set("User-Agent", userAgent)
+	}
+	return req.Next()
+}
+
+// armClientOptions returns the client options every ARM SDK client is created with. ARM requests go through the
+// same HTTP client as Graph requests, so they share its proxy settings, timeouts and request logging, and back off
+// with the same retry policy.
+func (d *Connector) armClientOptions() *arm.ClientOptions {
+	options := &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Cloud:           d.azureCloud().config,
+			Retry:           d.retry.armRetryOptions(),
+			PerCallPolicies: []policy.Policy{userAgentPolicy{}},
+			Logging: policy.LogOptions{
+				AllowedHeaders: requestIDHeaders,
+			},
+		},
+	}
+	// A nil *http.Client in the interface would hide the SDK's default transport.
+	if d.transport != nil {
+		options.Transport = d.transport
+	}
+
+	return options
+}
+
+func (d *Connector) newSubscriptionClientFactory() (*armsubscription.ClientFactory, error) {
+	return armsubscription.NewClientFactory(d.token, d.armClientOptions())
+}
+
+func (d *Connector) newRoleDefinitionsClient() (*armauthorization.RoleDefinitionsClient, error) {
+	return armauthorization.NewRoleDefinitionsClient(d.token, d.armClientOptions())
+}
+
+func (d *Connector) newRoleAssignmentsClient(subscriptionID string) (*armauthorization.RoleAssignmentsClient, error) {
+	return armauthorization.NewRoleAssignmentsClient(subscriptionID, d.token, d.armClientOptions())
+}
+
+func (d *Connector) newResourceGroupsClient(subscriptionID string) (*armresources.ResourceGroupsClient, error) {
+	return armresources.NewResourceGroupsClient(subscriptionID, d.token, d.armClientOptions())
+}
+
+// azureSDKLogOnce guards the Azure SDK's log listener, which is global to the process.
+var azureSDKLogOnce sync.Once
+
+// logAzureSDK forwards the Azure SDK's retries and failed responses to the debug log. The listener is installed by
+// the first connector only. Other events are left out, since every request is already logged by uhttp.
+func logAzureSDK(l *zap.Logger) {
+	azureSDKLogOnce.Do(func() {
+		azlog.SetEvents(azlog.EventRetryPolicy, azlog.EventResponseError)
+		azlog.SetListener(func(event azlog.Event, msg string) {
+			l.Debug("baton-azure-infrastructure: azure sdk", zap.String("event", string(event)), zap.String("message", msg))
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestARMClientsShareTransport(t *testing.T) {
+	var requests []*http.Request
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req)
+		return jsonResponse(http.StatusOK, map[string]interface{}{
+			"value": []map[string]string{{"id": "/subscriptions/1/resourceGroups/rg", "name": "rg"}},
+		})
+	})
+
+	c, err := newConnector(context.Background(), &http.Client{Transport: transport}, false, false,
+		WithCloud(AzureChinaCloud),
+		WithMaxRetries(0),
+	)
+	require.NoError(t, err)
+	c.token = staticToken{}
+
+	resourceGroups, err := listResourceGroups(context.Background(), c, "1")
+	require.NoError(t, err)
+	require.Len(t, resourceGroups, 1)
+
+	require.Len(t, requests, 1)
+	require.Equal(t, "management.chinacloudapi.cn", requests[0].URL.Host)
+	require.True(t, strings.HasPrefix(requests[0].Header.Get("User-Agent"), userAgent+" azsdk-go-armresources/"),
+		requests[0].Header.Get("User-Agent"))
+}
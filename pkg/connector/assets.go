@@ -0,0 +1,122 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+const (
+	// maxAssetSize bounds the logos Asset reads. Entra ID accepts logos of up to 100 KB, logos linked from
+	// elsewhere may be larger.
+	maxAssetSize = 1 << 20
+	// applicationLogoAssetPrefix marks asset IDs that refer to the logo of an application registration by app ID.
+	applicationLogoAssetPrefix = "application-logo:"
+)
+
+// assetCDNHosts are the hosts Entra ID serves application logos from. Logos are only fetched from them and from
+// Microsoft Graph, so a logo URL set on a service principal can't make the connector request arbitrary hosts.
+var assetCDNHosts = []string{
+	"secure.aadcdn.microsoftonline-p.com",
+	"aadcdn.msauthimages.net",
+	"aadcdn.msftauthimages.net",
+}
+
+// applicationLogo returns the asset holding the logo of an enterprise application. When the service principal links
+// no logo, the logo of the application registration is used instead, as long as the application is registered in
+// the tenant: Graph doesn't return application registrations of other tenants.
+func (d *Connector) applicationLogo(app *servicePrincipal) *v2.AssetRef {
+	switch {
+	case !IsEmpty(app.Info.LogoUrl):
+		return &v2.AssetRef{Id: app.Info.LogoUrl}
+	case app.AppId != "" && slices.Contains(d.organizationIDs, app.AppOwnerOrganizationId):
+		return &v2.AssetRef{Id: applicationLogoAssetPrefix + app.AppId}
+	default:
+		return nil
+	}
+}
+
+// assetURL returns the URL an asset ID refers to.
+func (d *Connector) assetURL(id string) (*url.URL, error) {
+	if appID, ok := strings.CutPrefix(id, applicationLogoAssetPrefix); ok {
+		// https://learn.microsoft.com/en-us/graph/api/resources/application#properties
+		id = d.buildURL(fmt.Sprintf("applications(appId='%s')/logo", url.PathEscape(appID)), nil)
+	}
+
+	u, err := url.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("baton-azure-infrastructure: invalid asset %q: %w", id, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("baton-azure-infrastructure: invalid asset %q, only https URLs are supported", id)
+	}
+	if !strings.EqualFold(u.Host, d.azureCloud().graphHost) && !slices.ContainsFunc(assetCDNHosts, func(host string) bool {
+		return strings.EqualFold(u.Host, host)
+	}) {
+		return nil, fmt.Errorf("baton-azure-infrastructure: invalid asset %q, host %s is not allowed", id, u.Host)
+	}
+
+	return u, nil
+}
+
+// fetchAsset reads the image an asset ID refers to and returns its content type. A Graph token is only sent when
+// the image is served by Microsoft Graph, logos on the CDN are fetched without credentials.
+func (d *Connector) fetchAsset(ctx context.Context, id string) (string, []byte, error) {
+	u, err := d.assetURL(id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if strings.EqualFold(u.Host, d.azureCloud().graphHost) {
+		token, err := d.token.GetToken(ctx, policy.TokenRequestOptions{Scopes: d.azureCloud().scopes(graphReadScopes)})
+		if err != nil {
+			return "", nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+	}
+
+	resp, err := d.transport.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", nil, newHTTPError(resp, string(raw), fmt.Errorf("baton-azure-infrastructure: failed to fetch asset %s", u.Redacted()))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAssetSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(data) > maxAssetSize {
+		return "", nil, fmt.Errorf("baton-azure-infrastructure: asset %s is larger than %d bytes", u.Redacted(), maxAssetSize)
+	}
+	if len(data) == 0 {
+		return "", nil, fmt.Errorf("baton-azure-infrastructure: asset %s is empty", u.Redacted())
+	}
+
+	// Graph and CDNs often label logos application/octet-stream, the content decides then.
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", nil, fmt.Errorf("baton-azure-infrastructure: asset %s is not an image", u.Redacted())
+	}
+
+	return contentType, data, nil
+}
@@ -0,0 +1,90 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var fakePNG = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 32)...)
+
+func TestAsset(t *testing.T) {
+	ctx := context.Background()
+	// Logos linked from service principals live on a CDN, which must never see the Graph token.
+	cdn := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		switch r.URL.Path {
+		case "/logo.png":
+			_, _ = w.Write(fakePNG)
+		case "/large.png":
+			_, _ = w.Write(append(fakePNG, make([]byte, maxAssetSize)...))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(cdn.Close)
+	cdnHosts := assetCDNHosts
+	assetCDNHosts = append(slices.Clone(assetCDNHosts), strings.TrimPrefix(cdn.URL, "https://"))
+	t.Cleanup(func() { assetCDNHosts = cdnHosts })
+
+	f := newFakeTenant(t)
+	f.objects["app1"]["info"] = map[string]any{"logoUrl": cdn.URL + "/logo.png"}
+	f.addServicePrincipal("app2", spTypeApplication)
+	f.addApplicationLogo("app-app2", fakePNG)
+	c := f.connector(t)
+
+	apps := listAll(t, newEnterpriseApplicationsBuilder(c), nil)
+	logos := make(map[string]string)
+	for _, app := range apps {
+		trait, err := rs.GetAppTrait(app)
+		require.NoError(t, err)
+		logos[app.Id.Resource] = trait.GetLogo().GetId()
+	}
+	require.Equal(t, map[string]string{
+		"app1": cdn.URL + "/logo.png",
+		"app2": applicationLogoAssetPrefix + "app-app2",
+	}, logos)
+	// Applications registered in other tenants have no application registration to read a logo from.
+	require.Nil(t, c.applicationLogo(&servicePrincipal{AppId: "app-other", AppOwnerOrganizationId: microsoftBuiltinAppsOwnerID}))
+
+	for _, id := range []string{logos["app1"], logos["app2"]} {
+		contentType, body, err := c.Asset(ctx, &v2.AssetRef{Id: id})
+		require.NoError(t, err, id)
+		require.Equal(t, "image/png", contentType)
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+		require.Equal(t, fakePNG, data)
+	}
+
+	_, _, err := c.Asset(ctx, &v2.AssetRef{Id: applicationLogoAssetPrefix + "app-app1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, _, err = c.Asset(ctx, &v2.AssetRef{Id: cdn.URL + "/large.png"})
+	require.ErrorContains(t, err, "larger than")
+	_, _, err = c.Asset(ctx, &v2.AssetRef{Id: cdn.URL + "/page.html"})
+	require.ErrorContains(t, err, "not an image")
+	_, _, err = c.Asset(ctx, &v2.AssetRef{Id: "http://example.com/logo.png"})
+	require.ErrorContains(t, err, "only https")
+	_, _, err = c.Asset(ctx, &v2.AssetRef{Id: "https://example.com/logo.png"})
+	require.ErrorContains(t, err, "not allowed")
+	_, _, err = c.Asset(ctx, &v2.AssetRef{})
+	require.Error(t, err)
+}
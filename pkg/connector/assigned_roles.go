@@ -0,0 +1,146 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// roleEligibilityAPIVersion is the Microsoft.Authorization API version used to list eligible role assignments.
+const roleEligibilityAPIVersion = "2020-10-01"
+
+// assignedRolesOptions limit the synced role definitions to those that are assigned. Role names and role
+// definition IDs in alwaysIncluded are lowercased.
+type assignedRolesOptions struct {
+	enabled        bool
+	alwaysIncluded map[string]bool
+}
+
+// WithAssignedRolesOnly only syncs the role definitions of a subscription that have at least one active or
+// eligible assignment in the synced scopes, along with the roles listed by WithAlwaysIncludedRoles.
+func WithAssignedRolesOnly(enabled bool) Option {
+	return func(c *Connector) error {
+		c.assignedRoles.enabled = enabled
+		return nil
+	}
+}
+
+// WithAlwaysIncludedRoles lists role names or role definition IDs that WithAssignedRolesOnly keeps even when
+// they aren't assigned, so that they can still be requested.
+func WithAlwaysIncludedRoles(roles ...string) Option {
+	return func(c *Connector) error {
+		c.assignedRoles.alwaysIncluded = addLowered(c.assignedRoles.alwaysIncluded, roles)
+		return nil
+	}
+}
+
+type roleEligibilityScheduleInstance struct {
+	Properties struct {
+		Scope            string `json:"scope"`
+		RoleDefinitionID string `json:"roleDefinitionId"`
+	} `json:"properties"`
+}
+
+type roleEligibilityScheduleInstanceList struct {
+	Value    []*roleEligibilityScheduleInstance `json:"value"`
+	NextLink string                             `json:"nextLink"`
+}
+
+// listEligibleRoleDefinitionIDs returns the IDs of the role definitions that principals are eligible for through
+// Privileged Identity Management in a subscription, at any scope inside it that passes the resource group filters.
+// https://learn.microsoft.com/en-us/rest/api/authorization/role-eligibility-schedule-instances/list-for-scope
+func (d *Connector) listEligibleRoleDefinitionIDs(ctx context.Context, subscriptionID string) ([]string, error) {
+	v := url.Values{}
+	v.Set("api-version", roleEligibilityAPIVersion)
+	reqURL := d.buildARMURL(path.Join("subscriptions", subscriptionID, "providers/Microsoft.Authorization/roleEligibilityScheduleInstances"), v)
+
+	var rv []string
+	for reqURL != "" {
+		resp := &roleEligibilityScheduleInstanceList{}
+		err := d.query(ctx, armScopes, http.MethodGet, reqURL, nil, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, instance := range resp.Value {
+			resourceGroup := resourceGroupOfScope(instance.Properties.Scope)
+			if resourceGroup != "" && !d.includeResourceGroup(resourceGroup) {
+				continue
+			}
+			rv = append(rv, path.Base(instance.Properties.RoleDefinitionID))
+		}
+		reqURL = resp.NextLink
+	}
+
+	return rv, nil
+}
+
+// assignedRoleIDs returns the lowercased IDs of the role definitions with an active or eligible assignment in a
+// subscription. Eligible assignments are left out, with a warning, when they can't be read.
+func (r *roleBuilder) assignedRoleIDs(ctx context.Context, subscriptionID string) (map[string]bool, error) {
+	state := r.syncState(ctx)
+	state.mu.RLock()
+	cached, ok := state.assignedRolesCache[subscriptionID]
+	state.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	err := r.cacheRoleAssignments(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(map[string]bool)
+	assignments, _ := r.cacheGet(ctx, subscriptionID)
+	for _, assignment := range assignments {
+		if assignment.Properties != nil {
+			rv[strings.ToLower(path.Base(StringValue(assignment.Properties.RoleDefinitionID)))] = true
+		}
+	}
+
+	if !state.eligibilityUnavailable.Load() {
+		eligible, err := r.conn.listEligibleRoleDefinitionIDs(ctx, subscriptionID)
+		switch status.Code(err) {
+		case codes.OK:
+			rv = addLowered(rv, eligible)
+		case codes.PermissionDenied, codes.Unauthenticated, codes.InvalidArgument:
+			// Reading eligible assignments requires Microsoft.Authorization/roleEligibilityScheduleInstances/read
+			// and an Entra ID P2 license for Privileged Identity Management.
+			if state.eligibilityUnavailable.CompareAndSwap(false, true) {
+				ctxzap.Extract(ctx).Warn(
+					"baton-azure-infrastructure: unable to read eligible role assignments, only roles with active assignments are synced",
+					zap.Error(err),
+				)
+			}
+		default:
+			return nil, fmt.Errorf("baton-azure-infrastructure: failed to list eligible role assignments of subscription %s: %w", subscriptionID, err)
+		}
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.assignedRolesCache[subscriptionID] = rv
+
+	return rv, nil
+}
+
+// includeRole reports whether a role definition is assigned, given the IDs returned by assignedRoleIDs, or always
+// included.
+func (r *roleBuilder) includeRole(role *armauthorization.RoleDefinition, assigned map[string]bool) bool {
+	id := strings.ToLower(path.Base(StringValue(role.ID)))
+	if assigned[id] || r.conn.assignedRoles.alwaysIncluded[id] {
+		return true
+	}
+
+	return role.Properties != nil && r.conn.assignedRoles.alwaysIncluded[strings.ToLower(StringValue(role.Properties.RoleName))]
+}
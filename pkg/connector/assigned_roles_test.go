@@ -0,0 +1,50 @@
+package connector
+
+import (
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignedRolesOnly(t *testing.T) {
+	const (
+		ownerRoleID        = "8e3af657-a8ff-443c-a75c-2fe8c4bcb635"
+		contributorRoleID  = "b24988ac-6180-42a0-ab88-20f7382dd24c"
+		backupReaderRoleID = "a795c7a0-d4a2-40c1-ae25-d81f01202912"
+		tagContributorID   = "4a9ae827-6dc8-4573-8ac7-8239d42aa03f"
+	)
+	f := newFakeTenant(t)
+	f.addRoleDefinition(fakeSubscriptionID, ownerRoleID, "Owner")
+	f.addRoleDefinition(fakeSubscriptionID, contributorRoleID, "Contributor")
+	f.addRoleDefinition(fakeSubscriptionID, backupReaderRoleID, "Backup Reader")
+	f.addRoleDefinition(fakeSubscriptionID, tagContributorID, "Tag Contributor")
+	f.addEligibleRoleAssignment("/subscriptions/"+fakeSubscriptionID+"/resourceGroups/rg1", contributorRoleID, "u3")
+	f.addEligibleRoleAssignment("/subscriptions/"+fakeSubscriptionID+"/resourceGroups/rg2", backupReaderRoleID, "u4")
+	subscription := &v2.ResourceId{ResourceType: subscriptionsResourceType.Id, Resource: fakeSubscriptionID}
+
+	roles := listAll(t, newRoleBuilder(f.connector(t)), subscription)
+	require.Len(t, roles, 5)
+
+	c := f.connector(t,
+		WithAssignedRolesOnly(true),
+		WithAlwaysIncludedRoles("owner", tagContributorID),
+		WithExcludedResourceGroups("rg2"),
+	)
+	b := newRoleBuilder(c)
+	roles = listAll(t, b, subscription)
+	// Reader is actively assigned, Contributor is eligible, Owner and Tag Contributor are always included. Backup
+	// Reader is only eligible in an excluded resource group.
+	require.ElementsMatch(t, []string{
+		fakeRoleID + ":" + fakeSubscriptionID,
+		contributorRoleID + ":" + fakeSubscriptionID,
+		ownerRoleID + ":" + fakeSubscriptionID,
+		tagContributorID + ":" + fakeSubscriptionID,
+	}, resourceIDs(roles))
+
+	// Assignments are read again on the next sync, not within one.
+	f.addEligibleRoleAssignment("/subscriptions/"+fakeSubscriptionID+"/resourceGroups/rg1", backupReaderRoleID, "u5")
+	require.Len(t, listAll(t, b, subscription), 4)
+	c.syncEpoch.Add(1)
+	require.Contains(t, resourceIDs(listAll(t, b, subscription)), backupReaderRoleID+":"+fakeSubscriptionID)
+}
@@ -0,0 +1,187 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// Graph accepts at most 20 requests in a single $batch.
+const graphBatchSize = 20
+
+// graphBatchItem is a single GET sent through Graph JSON batching. URL is a full Graph URL, as returned by
+// buildURL or buildBetaURL. On success the response body is decoded into Result, otherwise Err is set.
+// https://learn.microsoft.com/en-us/graph/json-batching
+type graphBatchItem struct {
+	URL    string
+	Result interface{}
+	Err    error
+}
+
+type graphBatchRequest struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type graphBatchRequests struct {
+	Requests []*graphBatchRequest `json:"requests"`
+}
+
+type graphBatchResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+type graphBatchResponses struct {
+	Responses []*graphBatchResponse `json:"responses"`
+}
+
+// batchGet sends items to Graph in batches of 20, retrying throttled items on their own according to the
+// connector's retry policy. An error is only
+// returned when a batch as a whole fails; failures of single items are reported through graphBatchItem.Err.
+func (d *Connector) batchGet(ctx context.Context, items []*graphBatchItem) error {
+	// A batch is sent to either the v1.0 or the beta endpoint, and can only contain requests for that version.
+	byVersion := make(map[string][]*graphBatchItem)
+	var versions []string
+	for _, item := range items {
+		version, _, err := graphRelativeURL(d.azureCloud().graphHost, item.URL)
+		if err != nil {
+			item.Err = err
+			continue
+		}
+
+		if _, ok := byVersion[version]; !ok {
+			versions = append(versions, version)
+		}
+		byVersion[version] = append(byVersion[version], item)
+	}
+
+	for _, version := range versions {
+		pending := byVersion[version]
+		for start := 0; start < len(pending); start += graphBatchSize {
+			end := min(start+graphBatchSize, len(pending))
+			err := d.sendBatch(ctx, version, pending[start:end])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Connector) sendBatch(ctx context.Context, version string, items []*graphBatchItem) error {
+	l := ctxzap.Extract(ctx)
+	pending := items
+	for attempt := 0; len(pending) > 0; attempt++ {
+		reqs := &graphBatchRequests{}
+		byID := make(map[string]*graphBatchItem, len(pending))
+		for i, item := range pending {
+			id := strconv.Itoa(i)
+			_, relativeURL, _ := graphRelativeURL(d.azureCloud().graphHost, item.URL)
+			reqs.Requests = append(reqs.Requests, &graphBatchRequest{
+				ID:     id,
+				Method: http.MethodGet,
+				URL:    relativeURL,
+				// Batched requests don't inherit the batch's headers, advanced queries need this one.
+				Headers: map[string]string{"ConsistencyLevel": "eventual"},
+			})
+			byID[id] = item
+		}
+
+		resp := &graphBatchResponses{}
+		reqURL := d.buildURL("$batch", nil)
+		if version == betaVersion {
+			reqURL = d.buildBetaURL("$batch", nil)
+		}
+		err := d.query(ctx, graphReadScopes, http.MethodPost, reqURL, reqs, resp)
+		if err != nil {
+			return err
+		}
+
+		var (
+			throttled []*graphBatchItem
+			wait      time.Duration
+		)
+		for _, r := range resp.Responses {
+			item, ok := byID[r.ID]
+			if !ok {
+				continue
+			}
+			delete(byID, r.ID)
+
+			switch {
+			case d.retry.shouldRetry(true, r.Status, batchResponseHeader(r), attempt):
+				throttled = append(throttled, item)
+				wait = max(wait, d.retry.delay(batchResponseHeader(r), attempt))
+			case r.Status == http.StatusNotFound:
+				item.Err = fmt.Errorf("baton-azure-infrastructure: GET '%s' %w: %s", item.URL, ErrNotFound, string(r.Body))
+			case r.Status < 200 || r.Status >= 300:
+				item.Err = fmt.Errorf("baton-azure-infrastructure: GET '%s' %w: %d %s", item.URL, ErrRequestFailed, r.Status, string(r.Body))
+			default:
+				item.Err = nil
+				if item.Result != nil && len(r.Body) > 0 {
+					item.Err = json.Unmarshal(r.Body, item.Result)
+				}
+			}
+		}
+
+		for _, item := range byID {
+			item.Err = fmt.Errorf("baton-azure-infrastructure: GET '%s' %w: missing from batch response", item.URL, ErrNoResponse)
+		}
+
+		if len(throttled) == 0 {
+			return nil
+		}
+
+		l.Debug("baton-azure-infrastructure: batched requests throttled, retrying",
+			zap.Int("requests", len(throttled)),
+			zap.Duration("wait", wait),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		pending = throttled
+	}
+
+	return nil
+}
+
+// batchResponseHeader returns the headers of a single batch response, which Graph sends as a plain JSON object.
+func batchResponseHeader(r *graphBatchResponse) http.Header {
+	header := make(http.Header, len(r.Headers))
+	for key, value := range r.Headers {
+		header.Set(key, value)
+	}
+
+	return header
+}
+
+// graphRelativeURL splits a full Graph URL into its version and the path and query relative to that version,
+// which is the form $batch expects.
+func graphRelativeURL(graphHost, fullURL string) (string, string, error) {
+	prefix := "https://" + graphHost + "/"
+	if !strings.HasPrefix(fullURL, prefix) {
+		return "", "", fmt.Errorf("baton-azure-infrastructure: %s is not a Microsoft Graph URL", fullURL)
+	}
+
+	version, relativeURL, ok := strings.Cut(strings.TrimPrefix(fullURL, prefix), "/")
+	if !ok {
+		return "", "", fmt.Errorf("baton-azure-infrastructure: %s is not a Microsoft Graph URL", fullURL)
+	}
+
+	return version, "/" + relativeURL, nil
+}
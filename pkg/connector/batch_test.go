@@ -0,0 +1,111 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	uhttp "github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/stretchr/testify/require"
+)
+
+type staticToken struct{}
+
+func (staticToken) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token"}, nil
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func jsonResponse(status int, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+	}, nil
+}
+
+func TestBatchGet(t *testing.T) {
+	var (
+		batches   []int
+		throttled = false
+	)
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "/v1.0/$batch", req.URL.Path)
+		reqs := &graphBatchRequests{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(reqs))
+		batches = append(batches, len(reqs.Requests))
+
+		resp := &graphBatchResponses{}
+		for _, r := range reqs.Requests {
+			switch {
+			case r.URL == "/users/u3/mailboxSettings" && !throttled:
+				throttled = true
+				resp.Responses = append(resp.Responses, &graphBatchResponse{
+					ID:      r.ID,
+					Status:  http.StatusTooManyRequests,
+					Headers: map[string]string{"Retry-After": "0"},
+				})
+			case r.URL == "/users/u4/mailboxSettings":
+				resp.Responses = append(resp.Responses, &graphBatchResponse{ID: r.ID, Status: http.StatusNotFound})
+			default:
+				resp.Responses = append(resp.Responses, &graphBatchResponse{
+					ID:     r.ID,
+					Status: http.StatusOK,
+					Body:   json.RawMessage(`{"userPurpose": "user"}`),
+				})
+			}
+		}
+		return jsonResponse(http.StatusOK, resp)
+	})
+
+	c := &Connector{
+		token:      staticToken{},
+		httpClient: uhttp.NewBaseHttpClient(&http.Client{Transport: transport}),
+		retry:      defaultRetryPolicy(),
+	}
+
+	var items []*graphBatchItem
+	for i := 0; i < 25; i++ {
+		items = append(items, &graphBatchItem{
+			URL:    c.buildURL(fmt.Sprintf("users/u%d/mailboxSettings", i), nil),
+			Result: &mailboxSettings{},
+		})
+	}
+
+	require.NoError(t, c.batchGet(context.Background(), items))
+	require.Equal(t, []int{20, 1, 5}, batches)
+	for i, item := range items {
+		if i == 4 {
+			require.ErrorIs(t, item.Err, ErrNotFound)
+			continue
+		}
+		require.NoError(t, item.Err)
+		require.Equal(t, "user", item.Result.(*mailboxSettings).UserPurpose)
+	}
+}
+
+func TestGraphRelativeURL(t *testing.T) {
+	version, relativeURL, err := graphRelativeURL("graph.microsoft.com", "https://graph.microsoft.com/beta/users/1/mailboxSettings?$select=userPurpose")
+	require.NoError(t, err)
+	require.Equal(t, "beta", version)
+	require.Equal(t, "/users/1/mailboxSettings?$select=userPurpose", relativeURL)
+
+	_, _, err = graphRelativeURL("graph.microsoft.com", "https://management.azure.com/subscriptions")
+	require.Error(t, err)
+}
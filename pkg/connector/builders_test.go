@@ -0,0 +1,480 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	fakeSubscriptionID = "11111111-1111-1111-1111-111111111111"
+	fakeRoleID         = "acdd72a7-3385-48ef-bd42-f606fba81ae7"
+	fakeAppRoleID      = "22222222-2222-2222-2222-222222222222"
+)
+
+// newFakeTenant returns a fake with a few users, a group, an enterprise application, a managed identity and a
+// subscription with two resource groups.
+func newFakeTenant(t *testing.T) *fakeAzure {
+	f := newFakeAzure(t)
+	for _, id := range []string{"u1", "u2", "u3", "u4", "u5"} {
+		f.addUser(id, "User "+id)
+	}
+	f.addGroup("g1", "Group 1")
+	f.addRelation("members", "g1", "u1")
+	f.addRelation("members", "g1", "u2")
+	f.addRelation("owners", "g1", "u3")
+	f.addServicePrincipal("app1", spTypeApplication, map[string]any{
+		"id":                 fakeAppRoleID,
+		"displayName":        "Reader",
+		"value":              "Reader",
+		"allowedMemberTypes": []string{"User"},
+	})
+	f.addRelation("owners", "app1", "u1")
+	f.addAppRoleAssignment("app1", "u2", fakeAppRoleID)
+	f.addServicePrincipal("mi1", spTypeManagedIdentity)
+	f.addSubscription(fakeSubscriptionID, "rg1", "rg2")
+	f.addRoleDefinition(fakeSubscriptionID, fakeRoleID, "Reader")
+	f.addRoleAssignment("/subscriptions/"+fakeSubscriptionID, "ra1", fakeRoleID, "u1")
+	f.addRoleAssignment("/subscriptions/"+fakeSubscriptionID+"/resourceGroups/rg1", "ra2", fakeRoleID, "u2")
+
+	return f
+}
+
+func listAll(t *testing.T, syncer connectorbuilder.ResourceSyncer, parentResourceID *v2.ResourceId) []*v2.Resource {
+	var (
+		rv    []*v2.Resource
+		token string
+	)
+	for {
+		resources, next, _, err := syncer.List(context.Background(), parentResourceID, &pagination.Token{Token: token})
+		require.NoError(t, err)
+		rv = append(rv, resources...)
+		if next == "" {
+			return rv
+		}
+		token = next
+	}
+}
+
+func grantsAll(t *testing.T, syncer connectorbuilder.ResourceSyncer, resource *v2.Resource) []*v2.Grant {
+	var (
+		rv    []*v2.Grant
+		token string
+	)
+	for {
+		grants, next, _, err := syncer.Grants(context.Background(), resource, &pagination.Token{Token: token})
+		require.NoError(t, err)
+		rv = append(rv, grants...)
+		if next == "" {
+			return rv
+		}
+		token = next
+	}
+}
+
+func resourceIDs(resources []*v2.Resource) []string {
+	var rv []string
+	for _, r := range resources {
+		rv = append(rv, r.Id.Resource)
+	}
+
+	return rv
+}
+
+func grantPrincipals(grants []*v2.Grant) []string {
+	var rv []string
+	for _, g := range grants {
+		parts := strings.Split(g.Entitlement.Id, ":")
+		rv = append(rv, parts[len(parts)-1]+"/"+g.Principal.Id.Resource)
+	}
+
+	return rv
+}
+
+func fakeUser(id string) *v2.Resource {
+	return &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: id}}
+}
+
+func findResource(t *testing.T, resources []*v2.Resource, id string) *v2.Resource {
+	for _, r := range resources {
+		if r.Id.Resource == id {
+			return r
+		}
+	}
+	require.Failf(t, "resource not found", "no resource %s in %v", id, resourceIDs(resources))
+
+	return nil
+}
+
+func findEntitlement(t *testing.T, entitlements []*v2.Entitlement, slug string) *v2.Entitlement {
+	for _, e := range entitlements {
+		if e.Slug == slug {
+			return e
+		}
+	}
+	require.Failf(t, "entitlement not found", "no entitlement %s", slug)
+
+	return nil
+}
+
+func TestUserBuilderOffline(t *testing.T) {
+	f := newFakeTenant(t)
+	c := f.connector(t)
+	f.throttle("/users", 1)
+
+	users := listAll(t, newUserBuilder(c), nil)
+	require.Equal(t, []string{"u1", "u2", "u3", "u4", "u5"}, resourceIDs(users))
+	// One throttled request and three pages.
+	require.Equal(t, 4, f.requestCount("/v1.0/users"))
+
+	entitlements, _, _, err := newUserBuilder(c).Entitlements(context.Background(), users[0], &pagination.Token{})
+	require.NoError(t, err)
+	require.Empty(t, entitlements)
+	require.Empty(t, grantsAll(t, newUserBuilder(c), users[0]))
+}
+
+func TestGroupBuilderOffline(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeTenant(t)
+	b := newGroupBuilder(f.connector(t))
+
+	groups := listAll(t, b, nil)
+	require.Equal(t, []string{"g1"}, resourceIDs(groups))
+
+	entitlements, _, _, err := b.Entitlements(ctx, groups[0], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, entitlements, 2)
+	require.ElementsMatch(t, []string{"owners/u3", "members/u1", "members/u2"}, grantPrincipals(grantsAll(t, b, groups[0])))
+
+	members := findEntitlement(t, entitlements, typeMembers)
+	_, err = b.Grant(ctx, fakeUser("u4"), members)
+	require.NoError(t, err)
+	// Granting an existing membership succeeds.
+	_, err = b.Grant(ctx, fakeUser("u4"), members)
+	require.NoError(t, err)
+	require.Equal(t, []string{"u1", "u2", "u4"}, f.relation("members", "g1"))
+
+	_, err = b.Revoke(ctx, &v2.Grant{Entitlement: members, Principal: fakeUser("u1")})
+	require.NoError(t, err)
+	// Revoking a missing membership succeeds.
+	_, err = b.Revoke(ctx, &v2.Grant{Entitlement: members, Principal: fakeUser("u1")})
+	require.NoError(t, err)
+	require.Equal(t, []string{"u2", "u4"}, f.relation("members", "g1"))
+}
+
+func TestEnterpriseApplicationBuilderOffline(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeTenant(t)
+	b := newEnterpriseApplicationsBuilder(f.connector(t))
+
+	apps := listAll(t, b, nil)
+	require.Equal(t, []string{"app1"}, resourceIDs(apps))
+
+	entitlements, _, _, err := b.Entitlements(ctx, apps[0], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, entitlements, 3)
+	require.ElementsMatch(t, []string{"owners/u1", fakeAppRoleID + "/u2"}, grantPrincipals(grantsAll(t, b, apps[0])))
+
+	reader := findEntitlement(t, entitlements, "Reader")
+	_, err = b.Grant(ctx, fakeUser("u3"), reader)
+	require.NoError(t, err)
+	owner := findEntitlement(t, entitlements, "owner")
+	_, err = b.Grant(ctx, fakeUser("u3"), owner)
+	require.NoError(t, err)
+	require.Equal(t, []string{"u1", "u3"}, f.relation("owners", "app1"))
+
+	_, err = b.Revoke(ctx, &v2.Grant{Id: "app1-u2-" + fakeAppRoleID, Entitlement: reader, Principal: fakeUser("u2")})
+	require.NoError(t, err)
+	_, err = b.Revoke(ctx, &v2.Grant{Entitlement: owner, Principal: fakeUser("u1")})
+	require.NoError(t, err)
+	require.Equal(t, []string{"u3"}, f.relation("owners", "app1"))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	require.Len(t, f.appRoleAssignments["app1"], 1)
+	require.Equal(t, "u3", f.appRoleAssignments["app1"][0]["principalId"])
+}
+
+func TestManagedIdentityBuilderOffline(t *testing.T) {
+	f := newFakeTenant(t)
+	b := newManagedIdentityBuilder(f.connector(t))
+
+	identities := listAll(t, b, nil)
+	require.Equal(t, []string{"mi1"}, resourceIDs(identities))
+	require.Empty(t, grantsAll(t, b, identities[0]))
+}
+
+func TestUserSignInActivityOffline(t *testing.T) {
+	lastSignIn := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	f := newFakeTenant(t)
+	f.objects["u1"]["signInActivity"] = map[string]any{"lastSignInDateTime": lastSignIn.Format(time.RFC3339)}
+
+	users := listAll(t, newUserBuilder(f.connector(t)), nil)
+	trait, err := rs.GetUserTrait(findResource(t, users, "u1"))
+	require.NoError(t, err)
+	require.Equal(t, lastSignIn, trait.GetLastLogin().AsTime())
+
+	// Without a P1 or P2 license the users are listed without sign-in activity.
+	f.unlicensed = true
+	b := newUserBuilder(f.connector(t))
+	users = listAll(t, b, nil)
+	require.Equal(t, []string{"u1", "u2", "u3", "u4", "u5"}, resourceIDs(users))
+	trait, err = rs.GetUserTrait(users[0])
+	require.NoError(t, err)
+	require.Nil(t, trait.GetLastLogin())
+	require.True(t, b.signInActivityUnavailable.Load())
+
+	// Without AuditLog.Read.All the users are listed without sign-in activity too.
+	f.unlicensed = false
+	f.noAuditLogRead = true
+	b = newUserBuilder(f.connector(t))
+	users = listAll(t, b, nil)
+	require.Equal(t, []string{"u1", "u2", "u3", "u4", "u5"}, resourceIDs(users))
+	trait, err = rs.GetUserTrait(findResource(t, users, "u1"))
+	require.NoError(t, err)
+	require.Nil(t, trait.GetLastLogin())
+	require.True(t, b.signInActivityUnavailable.Load())
+}
+
+func TestIsSignInActivityError(t *testing.T) {
+	require.True(t, isSignInActivityError(fmt.Errorf("list users: %w", &HTTPError{StatusCode: http.StatusForbidden, ErrorCode: signInActivityLicenseErrorCode})))
+	require.True(t, isSignInActivityError(&HTTPError{StatusCode: http.StatusForbidden, ErrorCode: "Authorization_RequestDenied"}))
+	require.False(t, isSignInActivityError(&HTTPError{StatusCode: http.StatusBadRequest, ErrorCode: "BadRequest"}))
+	// The code has to come from the error response, not the message.
+	require.False(t, isSignInActivityError(errors.New(signInActivityLicenseErrorCode)))
+}
+
+func TestServicePrincipalSignInActivityOffline(t *testing.T) {
+	lastSignIn := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	f := newFakeTenant(t)
+	f.addServicePrincipalSignInActivity("app-mi1", lastSignIn)
+
+	c := f.connector(t)
+	identities := listAll(t, newManagedIdentityBuilder(c), nil)
+	trait, err := rs.GetUserTrait(identities[0])
+	require.NoError(t, err)
+	require.Equal(t, lastSignIn, trait.GetLastLogin().AsTime())
+
+	// The report is read again on the next sync.
+	f.spSignInActivities = nil
+	f.addServicePrincipalSignInActivity("app-mi1", lastSignIn.Add(time.Hour))
+	c.syncEpoch.Add(1)
+	identities = listAll(t, newManagedIdentityBuilder(c), nil)
+	trait, err = rs.GetUserTrait(identities[0])
+	require.NoError(t, err)
+	require.Equal(t, lastSignIn.Add(time.Hour), trait.GetLastLogin().AsTime())
+
+	// Without a P1 or P2 license the report is skipped for the rest of the sync.
+	f.unlicensed = true
+	c = f.connector(t)
+	for range 2 {
+		identities = listAll(t, newManagedIdentityBuilder(c), nil)
+		require.Equal(t, []string{"mi1"}, resourceIDs(identities))
+		trait, err = rs.GetUserTrait(identities[0])
+		require.NoError(t, err)
+		require.Nil(t, trait.GetLastLogin())
+	}
+	// Twice for the licensed connector and once for the unlicensed one.
+	require.Equal(t, 3, f.requestCount("servicePrincipalSignInActivities"))
+
+	// Without AuditLog.Read.All the report is skipped the same way.
+	f.unlicensed = false
+	f.noAuditLogRead = true
+	identities = listAll(t, newManagedIdentityBuilder(f.connector(t)), nil)
+	trait, err = rs.GetUserTrait(identities[0])
+	require.NoError(t, err)
+	require.Nil(t, trait.GetLastLogin())
+}
+
+func TestServicePrincipalSignInActivityUncached(t *testing.T) {
+	lastSignIn := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	f := newFakeTenant(t)
+	f.addServicePrincipalSignInActivity("app-mi1", lastSignIn)
+	// The report has to be read again on the next sync, even with the HTTP cache on.
+	t.Setenv("BATON_DISABLE_HTTP_CACHE", "false")
+	c, err := NewConnectorFromToken(context.Background(), f.server.Client(), staticToken{}, false, false,
+		WithBaseURLs(f.server.URL, f.server.URL))
+	require.NoError(t, err)
+	require.NotEmpty(t, listAll(t, newManagedIdentityBuilder(c), nil))
+
+	f.spSignInActivities = nil
+	f.addServicePrincipalSignInActivity("app-mi1", lastSignIn.Add(time.Hour))
+	c.syncEpoch.Add(1)
+	identities := listAll(t, newManagedIdentityBuilder(c), nil)
+	trait, err := rs.GetUserTrait(identities[0])
+	require.NoError(t, err)
+	require.Equal(t, lastSignIn.Add(time.Hour), trait.GetLastLogin().AsTime())
+	require.Equal(t, 2, f.requestCount("servicePrincipalSignInActivities"))
+}
+
+func TestSubscriptionTenantAndResourceGroupBuildersOffline(t *testing.T) {
+	f := newFakeTenant(t)
+	f.addSubscription("33333333-3333-3333-3333-333333333333")
+	f.addSubscription("44444444-4444-4444-4444-444444444444")
+	c := f.connector(t)
+
+	subscriptions := listAll(t, newSubscriptionBuilder(c), nil)
+	require.Len(t, subscriptions, 3)
+	entitlements, _, _, err := newSubscriptionBuilder(c).Entitlements(context.Background(), subscriptions[0], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, entitlements, 2)
+	require.Empty(t, grantsAll(t, newSubscriptionBuilder(c), subscriptions[0]))
+
+	tenants := listAll(t, newTenantBuilder(c), nil)
+	require.Equal(t, []string{fakeTenantID}, resourceIDs(tenants))
+
+	f.throttle("/resourcegroups", 1)
+	resourceGroups := listAll(t, newResourceGroupBuilder(c), subscriptions[0].Id)
+	require.Len(t, resourceGroups, 2)
+	require.Empty(t, grantsAll(t, newResourceGroupBuilder(c), resourceGroups[0]))
+}
+
+func TestRoleBuilderOffline(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeTenant(t)
+	b := newRoleBuilder(f.connector(t))
+	subscription := &v2.ResourceId{ResourceType: subscriptionsResourceType.Id, Resource: fakeSubscriptionID}
+	scope := "/subscriptions/" + fakeSubscriptionID
+
+	roles := listAll(t, b, subscription)
+	require.Equal(t, []string{fakeRoleID + ":" + fakeSubscriptionID}, resourceIDs(roles))
+
+	entitlements, _, _, err := b.Entitlements(ctx, roles[0], &pagination.Token{})
+	require.NoError(t, err)
+	// Assignments below the subscription are listed as well.
+	require.ElementsMatch(t, []string{"assigned/u1", "assigned/u2"}, grantPrincipals(grantsAll(t, b, roles[0])))
+
+	assigned := findEntitlement(t, entitlements, typeAssigned)
+	_, err = b.Grant(ctx, fakeUser("u3"), assigned)
+	require.NoError(t, err)
+	// Azure refuses duplicate assignments with 409, which Grant treats as success.
+	_, err = b.Grant(ctx, fakeUser("u3"), assigned)
+	require.NoError(t, err)
+	require.Equal(t, []string{"u1", "u3"}, f.roleAssignmentsOf(scope, fakeRoleID))
+
+	_, err = b.Revoke(ctx, &v2.Grant{Entitlement: assigned, Principal: fakeUser("u1")})
+	require.NoError(t, err)
+	require.Equal(t, []string{"u3"}, f.roleAssignmentsOf(scope, fakeRoleID))
+
+	// Any other refusal fails the grant.
+	f.readOnlyARM = true
+	_, err = b.Grant(ctx, fakeUser("u4"), assigned)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestGroupBuilderCreateDeleteOffline(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeTenant(t)
+	b := newGroupBuilder(f.connector(t))
+
+	resource, err := rs.NewGroupResource("Group 2", groupResourceType, "new", []rs.GroupTraitOption{
+		rs.WithGroupProfile(map[string]interface{}{"description": "Created offline"}),
+	})
+	require.NoError(t, err)
+
+	created, _, err := b.Create(ctx, resource)
+	require.NoError(t, err)
+	require.Equal(t, "Group 2", created.DisplayName)
+	require.Equal(t, "Created offline", f.objects[created.Id.Resource]["description"])
+	require.Equal(t, []string{"g1", created.Id.Resource}, resourceIDs(listAll(t, b, nil)))
+
+	_, err = b.Delete(ctx, created.Id)
+	require.NoError(t, err)
+	// Deleting a missing group succeeds.
+	_, err = b.Delete(ctx, created.Id)
+	require.NoError(t, err)
+	require.Equal(t, []string{"g1"}, resourceIDs(listAll(t, b, nil)))
+
+	_, _, err = b.Create(ctx, &v2.Resource{})
+	require.Error(t, err)
+}
+
+func TestRoleBuilderCreateDeleteOffline(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeTenant(t)
+	f.addSubscription("33333333-3333-3333-3333-333333333333")
+	b := newRoleBuilder(f.connector(t))
+	subscription := &v2.ResourceId{ResourceType: subscriptionsResourceType.Id, Resource: fakeSubscriptionID}
+	otherScope := "/subscriptions/33333333-3333-3333-3333-333333333333"
+
+	resource, err := rs.NewRoleResource("Custom Reader", roleResourceType, "new", []rs.RoleTraitOption{
+		rs.WithRoleProfile(map[string]interface{}{
+			"actions":           []interface{}{"Microsoft.Resources/subscriptions/read"},
+			"assignable_scopes": []interface{}{"/subscriptions/" + fakeSubscriptionID, otherScope},
+		}),
+	}, rs.WithParentResourceID(subscription))
+	require.NoError(t, err)
+
+	created, _, err := b.Create(ctx, resource)
+	require.NoError(t, err)
+	require.Equal(t, "Custom Reader", created.DisplayName)
+	roleID := strings.Split(created.Id.Resource, ":")[0]
+
+	// An assignment in another assignable scope still blocks the delete.
+	f.addRoleAssignment(otherScope, "ra3", roleID, "u1")
+	_, err = b.Delete(ctx, created.Id)
+	require.ErrorContains(t, err, otherScope+"/providers/Microsoft.Authorization/roleAssignments/ra3")
+
+	f.roleAssignments = f.roleAssignments[:len(f.roleAssignments)-1]
+	_, err = b.Delete(ctx, created.Id)
+	require.NoError(t, err)
+	// Deleting a missing role succeeds.
+	_, err = b.Delete(ctx, created.Id)
+	require.NoError(t, err)
+
+	// Built-in roles are never deleted.
+	_, err = b.Delete(ctx, &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: fakeRoleID + ":" + fakeSubscriptionID})
+	require.ErrorContains(t, err, "not a custom role")
+	require.Len(t, f.roleDefinitions, 1)
+
+	// ARM refusals keep their status code.
+	created, _, err = b.Create(ctx, resource)
+	require.NoError(t, err)
+	f.readOnlyARM = true
+	_, _, err = b.Create(ctx, resource)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = b.Delete(ctx, created.Id)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestResourceGroupRoleAssignmentBuilderOffline(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeTenant(t)
+	b := &roleAssignmentResourceGroupBuilder{conn: f.connector(t)}
+	scope := "/subscriptions/" + fakeSubscriptionID + "/resourceGroups/rg1"
+
+	assignments := listAll(t, b, nil)
+	require.Len(t, assignments, 2)
+	rg1 := findResource(t, assignments, "rg1:"+fakeSubscriptionID+":"+fakeRoleID)
+
+	entitlements, _, _, err := b.Entitlements(ctx, rg1, &pagination.Token{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"assigned/u2"}, grantPrincipals(grantsAll(t, b, rg1)))
+
+	assigned := findEntitlement(t, entitlements, typeAssigned)
+	_, err = b.Grant(ctx, fakeUser("u4"), assigned)
+	require.NoError(t, err)
+	require.Equal(t, []string{"u2", "u4"}, f.roleAssignmentsOf(scope, fakeRoleID))
+	_, err = b.Grant(ctx, fakeUser("u4"), assigned)
+	require.NoError(t, err)
+
+	_, err = b.Revoke(ctx, &v2.Grant{Entitlement: assigned, Principal: fakeUser("u2")})
+	require.NoError(t, err)
+	require.Equal(t, []string{"u4"}, f.roleAssignmentsOf(scope, fakeRoleID))
+
+	f.readOnlyARM = true
+	_, err = b.Grant(ctx, fakeUser("u3"), assigned)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -1,6 +1,7 @@
 package connector
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -8,15 +9,19 @@ import (
 	"net/http"
 	"net/url"
 	"path"
-	"strconv"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	uhttp "github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
-	apiDomain                   = "graph.microsoft.com"
 	apiVersion                  = "v1.0"
 	betaVersion                 = "beta"
 	microsoftBuiltinAppsOwnerID = "f8cdef31-a31e-4b4a-93e4-5f571e91255a"
@@ -39,40 +44,69 @@ var (
 	defaultAppRoleAssignmentID = "00000000-0000-0000-0000-000000000000"
 )
 
+// HTTPError is returned for every non-2xx Graph or ARM response that wasn't recovered by retrying. It is a gRPC
+// status through GRPCStatus, and unwraps to the underlying error and to ErrNotFound or ErrRequestFailed.
 type HTTPError struct {
-	StatusCode  int
-	RawResponse string
-	RetryAfter  int
-	RateLimited bool
-	Err         error
+	StatusCode   int
+	RawResponse  string
+	RetryAfter   int
+	RateLimited  bool
+	ErrorCode    string
+	ErrorMessage string
+	RequestIDs   map[string]string
+	Domain       string
+	Err          error
 }
 
 func (e *HTTPError) Error() string {
+	if e.RawResponse == "" {
+		return fmt.Sprintf("%s %d", e.Err, e.StatusCode)
+	}
 	return fmt.Sprintf("%s %d %s", e.Err, e.StatusCode, e.RawResponse)
 }
 
+func (e *HTTPError) Unwrap() []error {
+	sentinel := ErrRequestFailed
+	if e.StatusCode == http.StatusNotFound {
+		sentinel = ErrNotFound
+	}
+
+	if e.Err == nil {
+		return []error{sentinel}
+	}
+	return []error{e.Err, sentinel}
+}
+
 func newHTTPError(resp *http.Response, rawResponse string, err error) *HTTPError {
-	retryAfter := 0
-	if resp.StatusCode == http.StatusTooManyRequests {
-		retryAfter, err = strconv.Atoi(resp.Header.Get("Retry-After"))
-		if err != nil {
+	retryAfterSeconds := 0
+	if resp.Header.Get("Retry-After") != "" || resp.Header.Get(retryAfterMsHeader) != "" {
+		wait, ok := retryAfter(resp.Header)
+		if ok {
+			retryAfterSeconds = int((wait + time.Second - 1) / time.Second)
+		} else {
 			err = fmt.Errorf("%w: %w", err, ErrFailedToParseRateLimit)
 		}
 	}
 
-	return &HTTPError{
+	httpErr := &HTTPError{
 		StatusCode:  resp.StatusCode,
 		RawResponse: rawResponse,
 		Err:         err,
-		RetryAfter:  retryAfter,
+		RetryAfter:  retryAfterSeconds,
 		RateLimited: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusGatewayTimeout,
 	}
+	if resp.Request != nil && resp.Request.URL != nil {
+		httpErr.Domain = resp.Request.URL.Host
+	}
+	httpErr.parseErrorResponse(resp.Header, rawResponse)
+
+	return httpErr
 }
 
 func (c *Connector) buildURL(reqPath string, v url.Values) string {
 	ux := url.URL{
 		Scheme:   "https",
-		Host:     apiDomain,
+		Host:     c.azureCloud().graphHost,
 		Path:     path.Join(apiVersion, reqPath),
 		RawQuery: v.Encode(),
 	}
@@ -86,87 +120,185 @@ func WithBearerToken(token string) uhttp.RequestOption {
 func (c *Connector) buildBetaURL(reqPath string, v url.Values) string {
 	ux := url.URL{
 		Scheme:   "https",
-		Host:     apiDomain,
+		Host:     c.azureCloud().graphHost,
 		Path:     path.Join(betaVersion, reqPath),
 		RawQuery: v.Encode(),
 	}
 	return ux.String()
 }
 
+func (c *Connector) buildARMURL(reqPath string, v url.Values) string {
+	ux := url.URL{
+		Scheme:   "https",
+		Host:     c.azureCloud().armHost,
+		Path:     reqPath,
+		RawQuery: v.Encode(),
+	}
+	return ux.String()
+}
+
+// doRequest sends a request, retrying throttled and transient failures according to the connector's retry policy.
+// Requests that aren't idempotent are only sent again when the service throttled them and said when to come back.
+// GET responses come from uhttp's response cache unless cached is false.
 func (c *Connector) doRequest(ctx context.Context,
 	method,
 	endpointUrl string,
 	token string,
 	res interface{},
 	body interface{},
+	cached bool,
 ) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
 	urlAddress, err := url.Parse(endpointUrl)
 	if err != nil {
 		return nil, err
 	}
-	req, err := c.httpClient.NewRequest(ctx,
-		method,
-		urlAddress,
-		WithBearerToken(token),
-		uhttp.WithHeader("ConsistencyLevel", "eventual"),
-		uhttp.WithContentTypeJSONHeader(),
-		uhttp.WithJSONBody(body),
-	)
-	if err != nil {
-		return nil, err
-	}
 
-	resp, err := c.httpClient.Do(req, uhttp.WithResponse(res))
-	if resp != nil {
-		defer resp.Body.Close()
+	var doOptions []uhttp.DoOption
+	if res != nil {
+		doOptions = append(doOptions, uhttp.WithResponse(res))
 	}
 
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		resMessage, err := io.ReadAll(resp.Body)
+	idempotent := idempotentRequest(method, urlAddress)
+	for attempt := 0; ; attempt++ {
+		req, err := c.httpClient.NewRequest(ctx,
+			method,
+			urlAddress,
+			WithBearerToken(token),
+			uhttp.WithHeader("ConsistencyLevel", "eventual"),
+			uhttp.WithContentTypeJSONHeader(),
+			uhttp.WithJSONBody(body),
+		)
 		if err != nil {
-			return nil, fmt.Errorf("microsoft-azure-infrastructure: failed to read response body: %w", err)
+			return nil, err
+		}
+
+		var (
+			wait time.Duration
+			resp *http.Response
+		)
+		if cached {
+			resp, err = c.httpClient.Do(req, doOptions...)
+		} else {
+			resp, err = c.doUncached(req, doOptions...)
+		}
+		switch {
+		case resp == nil:
+			if !c.retry.shouldRetryError(idempotent, err, attempt) {
+				return nil, err
+			}
+			wait = c.retry.delay(nil, attempt)
+
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			resp.Body.Close()
+			return nil, err
+
+		default:
+			rawResp, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if readErr != nil {
+				return nil, fmt.Errorf("microsoft-azure-infrastructure: failed to read response body: %w", readErr)
+			}
+
+			httpErr := newHTTPError(resp, string(rawResp), err)
+			httpErr.Domain = urlAddress.Host
+			if !c.retry.shouldRetry(idempotent, resp.StatusCode, resp.Header, attempt) {
+				return nil, fmt.Errorf("microsoft-azure-infrastructure: %s '%s': %w", method, urlAddress.String(), httpErr)
+			}
+			wait = c.retry.delay(resp.Header, attempt)
+		}
+
+		l.Debug("baton-azure-infrastructure: request failed, retrying",
+			zap.String("method", method),
+			zap.String("url", urlAddress.String()),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("wait", wait),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
 		}
-		return nil, fmt.Errorf("microsoft-azure-infrastructure: %s, '%s', %w: %s", method, urlAddress.String(), ErrRequestFailed, string(resMessage))
 	}
+}
 
-	rawResp, err := io.ReadAll(resp.Body)
+// doUncached sends req like uhttp.BaseHttpClient.Do, but never answers it from uhttp's response cache nor stores
+// the response there. Errors of non-2xx responses are replaced by an HTTPError in doRequest.
+func (c *Connector) doUncached(req *http.Request, options ...uhttp.DoOption) (*http.Response, error) {
+	resp, err := c.transport.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("microsoft-azure-infrastructure: failed to read response body: %w", err)
+		if isTimeout(err) {
+			return nil, uhttp.WrapErrors(codes.DeadlineExceeded, "request timeout", err)
+		}
+		return nil, err
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("microsoft-azure-infrastructure: %s '%s' %w", method, urlAddress.String(), ErrNotFound)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, uhttp.WrapErrors(codes.Unavailable, "failed to read response body", err)
 	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
 
-	if res != nil && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusCreated {
-		return nil, newHTTPError(resp, string(rawResp), ErrNoResponse)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, uhttp.WrapErrorsWithRateLimitInfo(grpcCode(resp.StatusCode), resp)
 	}
 
-	if resp.StatusCode != http.StatusOK &&
-		resp.StatusCode != http.StatusNoContent &&
-		resp.StatusCode != http.StatusCreated {
-		return nil, newHTTPError(resp, string(rawResp), ErrRequestFailed)
+	wresp := &uhttp.WrapperResponse{
+		Header:     resp.Header,
+		Body:       body,
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+	}
+	var errs []error
+	for _, option := range options {
+		errs = append(errs, option(wresp))
 	}
 
-	return nil, nil
+	return resp, errors.Join(errs...)
 }
 
-func (c *Connector) query(ctx context.Context, scopes []string, method, requestURL string, body interface{}, res interface{}) error {
+func (c *Connector) query(ctx context.Context, scopes tokenScopes, method, requestURL string, body interface{}, res interface{}) error {
+	return c.sendQuery(ctx, scopes, method, requestURL, body, res, true)
+}
+
+// queryUncached is query for GETs whose response changes from one sync to the next although the URL doesn't, e.g.
+// delta links, reports, audit logs and the ARM listings paged by hand. uhttp would otherwise answer them from its
+// response cache for up to an hour.
+func (c *Connector) queryUncached(ctx context.Context, scopes tokenScopes, method, requestURL string, body interface{}, res interface{}) error {
+	return c.sendQuery(ctx, scopes, method, requestURL, body, res, false)
+}
+
+func (c *Connector) sendQuery(ctx context.Context, scopes tokenScopes, method, requestURL string, body interface{}, res interface{}, cached bool) error {
 	token, err := c.token.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: scopes,
+		Scopes: c.azureCloud().scopes(scopes),
 	})
 	if err != nil {
 		return err
 	}
 
-	_, err = c.doRequest(ctx, method, requestURL, token.Token, res, body)
+	_, err = c.doRequest(ctx, method, requestURL, token.Token, res, body, cached)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// rateLimitDescription returns the rate limit details uhttp attaches to throttled responses, or nil if err
+// isn't a throttling error.
+func rateLimitDescription(err error) *v2.RateLimitDescription {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+
+	for _, detail := range st.Details() {
+		if rl, ok := detail.(*v2.RateLimitDescription); ok && rl.Status == v2.RateLimitDescription_STATUS_OVERLIMIT {
+			return rl
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package connector
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+)
+
+// Cloud names, as used by the Azure CLI.
+const (
+	AzurePublicCloud       = "AzureCloud"
+	AzureUSGovernmentCloud = "AzureUSGovernment"
+	AzureUSGovernmentDoD   = "AzureUSGovernmentDoD"
+	AzureChinaCloud        = "AzureChinaCloud"
+)
+
+// tokenScopes selects the API a token is requested for. The scope itself depends on the cloud.
+type tokenScopes int
+
+const (
+	graphReadScopes tokenScopes = iota
+	armScopes
+)
+
+// azureCloud holds every host that differs between the public cloud and the sovereign clouds.
+// https://learn.microsoft.com/en-us/graph/deployments
+// https://learn.microsoft.com/en-us/azure/azure-government/compare-azure-government-global-azure
+type azureCloud struct {
+	name          string
+	graphHost     string
+	graphAudience string
+	armHost       string
+	armAudience   string
+	portalHost    string
+	config        cloud.Configuration
+}
+
+var azureClouds = []*azureCloud{
+	{
+		name:          AzurePublicCloud,
+		graphHost:     "graph.microsoft.com",
+		graphAudience: "https://graph.microsoft.com",
+		armHost:       "management.azure.com",
+		armAudience:   "https://management.core.windows.net/",
+		portalHost:    "entra.microsoft.com",
+		config:        cloud.AzurePublic,
+	},
+	{
+		name:          AzureUSGovernmentCloud,
+		graphHost:     "graph.microsoft.us",
+		graphAudience: "https://graph.microsoft.us",
+		armHost:       "management.usgovcloudapi.net",
+		armAudience:   "https://management.core.usgovcloudapi.net",
+		portalHost:    "portal.azure.us",
+		config:        cloud.AzureGovernment,
+	},
+	{
+		name:          AzureUSGovernmentDoD,
+		graphHost:     "dod-graph.microsoft.us",
+		graphAudience: "https://dod-graph.microsoft.us",
+		armHost:       "management.usgovcloudapi.net",
+		armAudience:   "https://management.core.usgovcloudapi.net",
+		portalHost:    "portal.azure.us",
+		config:        cloud.AzureGovernment,
+	},
+	{
+		name:          AzureChinaCloud,
+		graphHost:     "microsoftgraph.chinacloudapi.cn",
+		graphAudience: "https://microsoftgraph.chinacloudapi.cn",
+		armHost:       "management.chinacloudapi.cn",
+		armAudience:   "https://management.core.chinacloudapi.cn",
+		portalHost:    "portal.azure.cn",
+		config:        cloud.AzureChina,
+	},
+}
+
+func lookupAzureCloud(name string) (*azureCloud, error) {
+	for _, c := range azureClouds {
+		if strings.EqualFold(c.name, name) {
+			return c, nil
+		}
+	}
+
+	names := make([]string, 0, len(azureClouds))
+	for _, c := range azureClouds {
+		names = append(names, c.name)
+	}
+	return nil, fmt.Errorf("baton-azure-infrastructure: unknown cloud %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// azureCloud returns the cloud the connector talks to, the public cloud unless WithCloud selected another.
+func (d *Connector) azureCloud() *azureCloud {
+	if d.cloud == nil {
+		return azureClouds[0]
+	}
+	return d.cloud
+}
+
+func (c *azureCloud) scopes(scopes tokenScopes) []string {
+	if scopes == armScopes {
+		return []string{strings.TrimSuffix(c.armAudience, "/") + "/.default"}
+	}
+	return []string{c.graphAudience + "/.default"}
+}
+
+// baseURLs replace the Graph and ARM hosts of a cloud, see WithBaseURLs.
+type baseURLs struct {
+	graph *url.URL
+	arm   *url.URL
+}
+
+func parseBaseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("baton-azure-infrastructure: invalid base URL %q: %w", rawURL, err)
+	}
+	if u.Scheme != "https" || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("baton-azure-infrastructure: base URL %q must be an https URL without a path", rawURL)
+	}
+
+	return u, nil
+}
+
+// withBaseURLs returns a copy of the cloud that sends Graph and ARM requests to other hosts. Tokens are still
+// requested for the cloud's own audiences.
+func (c *azureCloud) withBaseURLs(urls *baseURLs) *azureCloud {
+	rv := *c
+	rv.graphHost = urls.graph.Host
+	rv.armHost = urls.arm.Host
+	rv.config.Services = maps.Clone(c.config.Services)
+	armService := rv.config.Services[cloud.ResourceManager]
+	armService.Endpoint = "https://" + urls.arm.Host
+	rv.config.Services[cloud.ResourceManager] = armService
+
+	return &rv
+}
+
+func (c *azureCloud) portalURL(fragment string) string {
+	return (&url.URL{
+		Scheme:   "https",
+		Host:     c.portalHost,
+		Path:     "/",
+		Fragment: fragment,
+	}).String()
+}
+
+func (c *azureCloud) directoryObjectURL(objectID string) string {
+	return (&url.URL{
+		Scheme: "https",
+		Host:   c.graphHost,
+		Path:   path.Join(apiVersion, "directoryObjects", objectID),
+	}).String()
+}
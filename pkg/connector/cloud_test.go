@@ -0,0 +1,57 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCloud(t *testing.T) {
+	c, err := newConnector(context.Background(), http.DefaultClient, false, false, WithCloud("azureusgovernment"))
+	require.NoError(t, err)
+
+	require.Equal(t, "https://graph.microsoft.us/v1.0/users", c.buildURL("users", nil))
+	require.Equal(t, "https://graph.microsoft.us/beta/organization", c.buildBetaURL("organization", nil))
+	require.Equal(t, "https://management.usgovcloudapi.net/subscriptions", c.buildARMURL("subscriptions", nil))
+	require.Equal(t, []string{"https://graph.microsoft.us/.default"}, c.azureCloud().scopes(graphReadScopes))
+	require.Equal(t, []string{"https://management.core.usgovcloudapi.net/.default"}, c.azureCloud().scopes(armScopes))
+	require.Equal(t, cloud.AzureGovernment.ActiveDirectoryAuthorityHost, c.armClientOptions().Cloud.ActiveDirectoryAuthorityHost)
+	require.Equal(t, "https://portal.azure.us/#view/Microsoft_AAD_UsersAndTenants/UserProfileMenuBlade/~/overview/userId/1",
+		userURL(c.azureCloud(), &user{ID: "1"}))
+
+	version, relativeURL, err := graphRelativeURL(c.azureCloud().graphHost, c.buildURL("users/1", nil))
+	require.NoError(t, err)
+	require.Equal(t, "v1.0", version)
+	require.Equal(t, "/users/1", relativeURL)
+
+	_, err = newConnector(context.Background(), http.DefaultClient, false, false, WithCloud("AzureMoon"))
+	require.Error(t, err)
+
+	public := &Connector{}
+	require.Equal(t, "https://graph.microsoft.com/v1.0/users", public.buildURL("users", nil))
+	require.Equal(t, "https://entra.microsoft.com/#view/Microsoft_AAD_IAM/GroupDetailsMenuBlade/~/Overview/groupId/2",
+		groupURL(public.azureCloud(), &group{ID: "2"}))
+}
+
+func TestWithBaseURLs(t *testing.T) {
+	c, err := newConnector(context.Background(), http.DefaultClient, false, false,
+		WithBaseURLs("https://127.0.0.1:8443", "https://127.0.0.1:9443/"),
+		WithCloud(AzureUSGovernmentCloud),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, "https://127.0.0.1:8443/v1.0/users", c.buildURL("users", nil))
+	require.Equal(t, "https://127.0.0.1:9443/subscriptions", c.buildARMURL("subscriptions", nil))
+	require.Equal(t, "https://127.0.0.1:9443", c.armClientOptions().Cloud.Services[cloud.ResourceManager].Endpoint)
+	// Tokens are still requested for the cloud's audiences.
+	require.Equal(t, []string{"https://graph.microsoft.us/.default"}, c.azureCloud().scopes(graphReadScopes))
+	require.Equal(t, "https://management.usgovcloudapi.net", cloud.AzureGovernment.Services[cloud.ResourceManager].Endpoint)
+
+	for _, rawURL := range []string{"http://127.0.0.1:8443", "https://127.0.0.1:8443/v1.0", "127.0.0.1"} {
+		_, err = newConnector(context.Background(), http.DefaultClient, false, false, WithBaseURLs(rawURL, "https://127.0.0.1"))
+		require.Error(t, err, rawURL)
+	}
+}
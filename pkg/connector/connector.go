@@ -1,14 +1,18 @@
 package connector
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	azcore "github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	azidentity "github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	armsubscription "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/subscription/armsubscription"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -20,11 +24,155 @@ import (
 type Connector struct {
 	token                 azcore.TokenCredential
 	httpClient            *uhttp.BaseHttpClient
+	transport             *http.Client
 	MailboxSettings       bool
 	SkipAdGroups          bool
 	organizationIDs       []string
 	roleDefinitionsClient *armauthorization.RoleDefinitionsClient
 	clientFactory         *armsubscription.ClientFactory
+	spActivity            *syncCache[*servicePrincipalActivity]
+	userAttributes        []*userAttribute
+	deltaSync             bool
+	groupDelta            *syncCache[*groupDeltaState]
+	signInLookback        time.Duration
+	spIDs                 *syncCache[*servicePrincipalIDCache]
+	resourceGraph         *syncCache[*resourceGraphCache]
+	retry                 retryPolicy
+	cloud                 *azureCloud
+	baseURLs              *baseURLs
+	credentials           credentialOptions
+	fixtures              fixtureOptions
+	filter                scopeFilter
+	graphFilters          graphFilters
+	assignedRoles         assignedRolesOptions
+	// subscriptionParallelism bounds how many subscriptions are read at once, subscriptionScan is only set
+	// when it is above one.
+	subscriptionParallelism int
+	subscriptionScan        *syncCache[*subscriptionScan]
+	// syncEpoch is advanced by Validate at the start of every sync and invalidates the syncCache values.
+	syncEpoch *atomic.Uint64
+	// deniedEventSources holds the names of the event sources that were refused access, so it is only logged once.
+	deniedEventSources *sync.Map
+}
+
+// Option configures optional connector behavior.
+type Option func(c *Connector) error
+
+// WithCloud selects the Azure cloud to connect to by its Azure CLI name, e.g. AzureCloud, AzureUSGovernment or
+// AzureChinaCloud. It switches the Microsoft Graph and Azure Resource Manager endpoints, the token audiences,
+// the authority used by New and the hosts of portal links.
+func WithCloud(name string) Option {
+	return func(c *Connector) error {
+		if name == "" {
+			return nil
+		}
+
+		azCloud, err := lookupAzureCloud(name)
+		if err != nil {
+			return err
+		}
+
+		c.cloud = azCloud
+		return nil
+	}
+}
+
+// WithBaseURLs sends Microsoft Graph and Azure Resource Manager requests to graphURL and armURL instead of the
+// hosts of the selected cloud, e.g. to a proxy or a local stand-in server. Both must be https URLs without a path.
+func WithBaseURLs(graphURL, armURL string) Option {
+	return func(c *Connector) error {
+		graph, err := parseBaseURL(graphURL)
+		if err != nil {
+			return err
+		}
+
+		arm, err := parseBaseURL(armURL)
+		if err != nil {
+			return err
+		}
+
+		c.baseURLs = &baseURLs{graph: graph, arm: arm}
+		return nil
+	}
+}
+
+// WithDeltaSync enables incremental sync based on Microsoft Graph delta queries. Users and groups are listed through
+// delta queries, and group members reported as unchanged since the previous sync are reused instead of listed again.
+// Last login isn't synced for users listed through delta.
+func WithDeltaSync(enabled bool) Option {
+	return func(c *Connector) error {
+		c.deltaSync = enabled
+		return nil
+	}
+}
+
+// WithResourceGraph reads subscriptions, resource groups, role definitions and role assignments for the whole
+// tenant through Azure Resource Graph instead of paging through every subscription.
+func WithResourceGraph(enabled bool) Option {
+	return func(c *Connector) error {
+		if enabled {
+			c.resourceGraph = newSyncCache[*resourceGraphCache](c.syncEpoch)
+		}
+		return nil
+	}
+}
+
+// WithMaxRetries sets the retry budget for throttled and transiently failing Graph and ARM requests.
+// Zero disables retries.
+func WithMaxRetries(maxRetries int) Option {
+	return func(c *Connector) error {
+		if maxRetries < 0 {
+			return fmt.Errorf("baton-azure-infrastructure: max retries must not be negative")
+		}
+
+		c.retry.maxRetries = maxRetries
+		return nil
+	}
+}
+
+// WithSubscriptionParallelism prefetches role definitions, role assignments and resource groups for up to
+// parallelism subscriptions at once. One reads subscriptions one at a time, when they are first needed.
+func WithSubscriptionParallelism(parallelism int) Option {
+	return func(c *Connector) error {
+		if parallelism < 1 {
+			return fmt.Errorf("baton-azure-infrastructure: subscription parallelism must be at least 1")
+		}
+
+		c.subscriptionParallelism = parallelism
+		c.subscriptionScan = nil
+		if parallelism > 1 {
+			c.subscriptionScan = newSyncCache[*subscriptionScan](c.syncEpoch)
+		}
+		return nil
+	}
+}
+
+// WithSignInLookback reports user sign-ins from the last lookback as enterprise application usage events.
+// A zero lookback leaves sign-ins out of the event feed.
+func WithSignInLookback(lookback time.Duration) Option {
+	return func(c *Connector) error {
+		if lookback < 0 {
+			return fmt.Errorf("baton-azure-infrastructure: sign-in lookback must not be negative")
+		}
+
+		c.signInLookback = lookback
+		return nil
+	}
+}
+
+// WithUserAttributes adds Graph user properties, directory extensions and custom security attribute sets
+// to the synced user profiles, e.g. "onPremisesSamAccountName", "extension_<appId>_<name>",
+// "employeeOrgData/costCenter" or "customSecurityAttributes/<set>".
+func WithUserAttributes(attributes ...string) Option {
+	return func(c *Connector) error {
+		userAttributes, err := parseUserAttributes(attributes)
+		if err != nil {
+			return err
+		}
+
+		c.userAttributes = userAttributes
+		return nil
+	}
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
@@ -44,8 +192,19 @@ func (d *Connector) ResourceSyncers(ctx context.Context) []connectorbuilder.Reso
 
 // Asset takes an input AssetRef and attempts to fetch it using the connector's authenticated http client
 // It streams a response, always starting with a metadata object, following by chunked payloads for the asset.
+// Assets are the logos of enterprise applications and managed identities, their content type is taken from the
+// response or detected from the image.
 func (d *Connector) Asset(ctx context.Context, asset *v2.AssetRef) (string, io.ReadCloser, error) {
-	return "", nil, nil
+	if asset.GetId() == "" {
+		return "", nil, errors.New("baton-azure-infrastructure: asset ID is required")
+	}
+
+	contentType, data, err := d.fetchAsset(ctx, asset.GetId())
+	if err != nil {
+		return "", nil, err
+	}
+
+	return contentType, io.NopCloser(bytes.NewReader(data)), nil
 }
 
 // Metadata returns metadata about the connector.
@@ -57,9 +216,23 @@ func (d *Connector) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error)
 }
 
 // Validate is called to ensure that the connector is properly configured. It should exercise any API credentials
-// to be sure that they are valid.
+// to be sure that they are valid. Missing required Graph permissions fail validation, missing optional permissions
+// and subscriptions without Reader access are logged and reported in a structpb.Struct annotation.
 func (d *Connector) Validate(ctx context.Context) (annotations.Annotations, error) {
-	return nil, nil
+	// The SDK validates at the start of every sync, so anything cached for the previous sync is dropped here.
+	d.syncEpoch.Add(1)
+
+	report, err := d.validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validationError(report); err != nil {
+		return nil, err
+	}
+	logValidationWarnings(ctx, report)
+
+	return validationAnnotations(report)
 }
 
 func NewConnectorFromToken(ctx context.Context,
@@ -67,46 +240,98 @@ func NewConnectorFromToken(ctx context.Context,
 	token azcore.TokenCredential,
 	mailboxSettings bool,
 	skipAdGroups bool,
+	opts ...Option,
 ) (*Connector, error) {
-	client, err := uhttp.NewBaseHttpClientWithContext(ctx, httpClient)
+	c, err := newConnector(ctx, httpClient, mailboxSettings, skipAdGroups, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	clientFactory, err := armsubscription.NewClientFactory(token, nil)
+	err = c.connect(ctx, token)
 	if err != nil {
 		return nil, err
 	}
 
+	return c, nil
+}
+
+// newConnector applies the options to a connector that has no credential yet.
+func newConnector(ctx context.Context, httpClient *http.Client, mailboxSettings bool, skipAdGroups bool, opts ...Option) (*Connector, error) {
 	c := &Connector{
-		token:           token,
-		httpClient:      client,
 		MailboxSettings: mailboxSettings,
 		SkipAdGroups:    skipAdGroups,
-		clientFactory:   clientFactory,
+		retry:           defaultRetryPolicy(),
+		syncEpoch:       &atomic.Uint64{},
+
+		deniedEventSources: &sync.Map{},
+
+		subscriptionParallelism: 1,
+	}
+
+	c.spActivity = newSyncCache[*servicePrincipalActivity](c.syncEpoch)
+	c.spIDs = newSyncCache[*servicePrincipalIDCache](c.syncEpoch)
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	// Applied last, so the override holds no matter where WithCloud appears among the options.
+	if c.baseURLs != nil {
+		c.cloud = c.azureCloud().withBaseURLs(c.baseURLs)
+	}
+
+	if c.filter.filtersSubscriptions() {
+		c.filter.resolved = newResolvedScope(c.syncEpoch)
+	}
+
+	if c.deltaSync {
+		c.groupDelta = newSyncCache[*groupDeltaState](c.syncEpoch)
 	}
 
-	organizationIDs, err := c.getOrganizationIDs(ctx)
+	httpClient, err := c.fixtures.client(httpClient)
 	if err != nil {
 		return nil, err
 	}
-	c.organizationIDs = organizationIDs
 
-	roleDefinitionsClient, err := c.getRoleDefinitionsClient()
+	client, err := uhttp.NewBaseHttpClientWithContext(ctx, httpClient)
 	if err != nil {
 		return nil, err
 	}
-	c.roleDefinitionsClient = roleDefinitionsClient
+	c.httpClient = client
+	c.transport = httpClient
 
 	return c, nil
 }
 
-func (d *Connector) getRoleDefinitionsClient() (*armauthorization.RoleDefinitionsClient, error) {
-	client, err := armauthorization.NewRoleDefinitionsClient(d.token, nil)
+// connect sets the credential and creates the clients that depend on it.
+func (d *Connector) connect(ctx context.Context, token azcore.TokenCredential) error {
+	d.token = token
+	clientFactory, err := d.newSubscriptionClientFactory()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	d.clientFactory = clientFactory
+
+	organizationIDs, err := d.getOrganizationIDs(ctx)
+	if err != nil {
+		return err
+	}
+	d.organizationIDs = organizationIDs
+
+	err = d.validateGraphFilters(ctx)
+	if err != nil {
+		return err
+	}
+
+	roleDefinitionsClient, err := d.newRoleDefinitionsClient()
+	if err != nil {
+		return err
 	}
-	return client, nil
+	d.roleDefinitionsClient = roleDefinitionsClient
+
+	return nil
 }
 
 func (d *Connector) getOrganizationIDs(ctx context.Context) ([]string, error) {
@@ -126,46 +351,36 @@ func (d *Connector) getOrganizationIDs(ctx context.Context) ([]string, error) {
 }
 
 // New returns a new instance of the connector.
-func New(ctx context.Context, useCliCredentials bool, tenantID, clientID, clientSecret string, mailboxSettings bool, skipAdGroups bool) (*Connector, error) {
-	var cred azcore.TokenCredential
+func New(ctx context.Context, useCliCredentials bool, tenantID, clientID, clientSecret string, mailboxSettings bool, skipAdGroups bool, opts ...Option) (*Connector, error) {
 	httpClient, err := uhttp.NewClient(
 		ctx,
 		[]uhttp.Option{
 			uhttp.WithLogger(true, ctxzap.Extract(ctx)),
+			uhttp.WithUserAgent(userAgent),
 		}...,
 	)
 	if err != nil {
 		return nil, err
 	}
+	logAzureSDK(ctxzap.Extract(ctx))
+
+	c, err := newConnector(ctx, httpClient, mailboxSettings, skipAdGroups, opts...)
+	if err != nil {
+		return nil, err
+	}
 
-	switch {
-	case useCliCredentials:
-		cred, err = azidentity.NewAzureCLICredential(nil)
-	case !IsEmpty(tenantID) && !IsEmpty(clientID) && !IsEmpty(clientSecret):
-		cred, err = azidentity.NewClientSecretCredential(tenantID,
-			clientID,
-			clientSecret,
-			&azidentity.ClientSecretCredentialOptions{
-				ClientOptions: azcore.ClientOptions{
-					Transport: httpClient,
-				},
-			})
-	default:
-		cred, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
-			ClientOptions: azcore.ClientOptions{
-				Transport: httpClient,
-			},
-			TenantID: tenantID,
-		})
+	var cred azcore.TokenCredential = replayToken{}
+	if !c.fixtures.replaying() {
+		cred, err = c.newCredential(useCliCredentials, tenantID, clientID, clientSecret, httpClient)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	err = c.connect(ctx, cred)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewConnectorFromToken(ctx,
-		httpClient,
-		cred,
-		mailboxSettings,
-		skipAdGroups,
-	)
+	return c, nil
 }
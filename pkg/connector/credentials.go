@@ -0,0 +1,141 @@
+package connector
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	azcore "github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azidentity "github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// credentialOptions select how New authenticates when it isn't given a client secret or told to use the Azure CLI.
+// At most one of them is set.
+type credentialOptions struct {
+	certificatePath         string
+	certificatePassword     string
+	federatedTokenFile      string
+	managedIdentity         bool
+	managedIdentityClientID string
+}
+
+func (o *credentialOptions) count() int {
+	n := 0
+	for _, set := range []bool{o.certificatePath != "", o.federatedTokenFile != "", o.managedIdentity} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// WithClientCertificate authenticates the app registration with a certificate instead of a client secret. The file
+// holds the certificate and its private key, either PEM encoded or as a PKCS#12 (PFX) archive. The password is only
+// needed for encrypted files.
+func WithClientCertificate(path, password string) Option {
+	return func(c *Connector) error {
+		if path == "" {
+			return nil
+		}
+
+		c.credentials.certificatePath = path
+		c.credentials.certificatePassword = password
+		return nil
+	}
+}
+
+// WithWorkloadIdentity authenticates the app registration through workload identity federation, exchanging the
+// token in tokenFile, e.g. a projected Kubernetes service account token, for a Microsoft Entra token.
+func WithWorkloadIdentity(tokenFile string) Option {
+	return func(c *Connector) error {
+		if tokenFile == "" {
+			return nil
+		}
+
+		c.credentials.federatedTokenFile = tokenFile
+		return nil
+	}
+}
+
+// WithManagedIdentity authenticates as the managed identity of the host. An empty clientID selects the
+// system-assigned identity, otherwise the user-assigned identity with that client ID.
+func WithManagedIdentity(enabled bool, clientID string) Option {
+	return func(c *Connector) error {
+		if !enabled && clientID == "" {
+			return nil
+		}
+
+		c.credentials.managedIdentity = true
+		c.credentials.managedIdentityClientID = clientID
+		return nil
+	}
+}
+
+// newCredential creates the credential New authenticates with.
+func (d *Connector) newCredential(useCliCredentials bool, tenantID, clientID, clientSecret string, transport *http.Client) (azcore.TokenCredential, error) {
+	clientOptions := azcore.ClientOptions{
+		Cloud:     d.azureCloud().config,
+		Transport: transport,
+	}
+
+	withSecret := !IsEmpty(tenantID) && !IsEmpty(clientID) && !IsEmpty(clientSecret)
+	methods := d.credentials.count()
+	if useCliCredentials {
+		methods++
+	}
+	if withSecret {
+		methods++
+	}
+	if methods > 1 {
+		return nil, fmt.Errorf("baton-azure-infrastructure: the Azure CLI, client secret, client certificate, " +
+			"workload identity and managed identity credentials are mutually exclusive")
+	}
+
+	switch {
+	// The Azure CLI authenticates against the cloud selected with "az cloud set".
+	case useCliCredentials:
+		return azidentity.NewAzureCLICredential(nil)
+	case withSecret:
+		return azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, &azidentity.ClientSecretCredentialOptions{
+			ClientOptions: clientOptions,
+		})
+	case d.credentials.certificatePath != "":
+		certData, err := os.ReadFile(d.credentials.certificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("baton-azure-infrastructure: failed to read client certificate: %w", err)
+		}
+
+		var password []byte
+		if d.credentials.certificatePassword != "" {
+			password = []byte(d.credentials.certificatePassword)
+		}
+		certs, key, err := azidentity.ParseCertificates(certData, password)
+		if err != nil {
+			return nil, fmt.Errorf("baton-azure-infrastructure: failed to parse client certificate: %w", err)
+		}
+
+		return azidentity.NewClientCertificateCredential(tenantID, clientID, certs, key, &azidentity.ClientCertificateCredentialOptions{
+			ClientOptions: clientOptions,
+		})
+	case d.credentials.federatedTokenFile != "":
+		return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions: clientOptions,
+			ClientID:      clientID,
+			TenantID:      tenantID,
+			TokenFilePath: d.credentials.federatedTokenFile,
+		})
+	case d.credentials.managedIdentity:
+		options := &azidentity.ManagedIdentityCredentialOptions{
+			ClientOptions: clientOptions,
+		}
+		if d.credentials.managedIdentityClientID != "" {
+			options.ID = azidentity.ClientID(d.credentials.managedIdentityClientID)
+		}
+		return azidentity.NewManagedIdentityCredential(options)
+	default:
+		return azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			ClientOptions: clientOptions,
+			TenantID:      tenantID,
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package connector
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	azidentity "github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestCertificate(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "baton-azure-infrastructure"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestNewCredential(t *testing.T) {
+	ctx := context.Background()
+	certificatePath := writeTestCertificate(t)
+
+	c, err := newConnector(ctx, http.DefaultClient, false, false, WithClientCertificate(certificatePath, ""))
+	require.NoError(t, err)
+	cred, err := c.newCredential(false, "tenant", "client", "", http.DefaultClient)
+	require.NoError(t, err)
+	require.IsType(t, &azidentity.ClientCertificateCredential{}, cred)
+
+	_, err = c.newCredential(false, "tenant", "client", "secret", http.DefaultClient)
+	require.Error(t, err)
+
+	c, err = newConnector(ctx, http.DefaultClient, false, false, WithClientCertificate(filepath.Join(t.TempDir(), "missing.pem"), ""))
+	require.NoError(t, err)
+	_, err = c.newCredential(false, "tenant", "client", "", http.DefaultClient)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	c, err = newConnector(ctx, http.DefaultClient, false, false, WithWorkloadIdentity(certificatePath))
+	require.NoError(t, err)
+	cred, err = c.newCredential(false, "tenant", "client", "", http.DefaultClient)
+	require.NoError(t, err)
+	require.IsType(t, &azidentity.WorkloadIdentityCredential{}, cred)
+
+	c, err = newConnector(ctx, http.DefaultClient, false, false, WithManagedIdentity(false, "identity"))
+	require.NoError(t, err)
+	cred, err = c.newCredential(false, "", "", "", http.DefaultClient)
+	require.NoError(t, err)
+	require.IsType(t, &azidentity.ManagedIdentityCredential{}, cred)
+
+	_, err = c.newCredential(true, "", "", "", http.DefaultClient)
+	require.Error(t, err)
+
+	c, err = newConnector(ctx, http.DefaultClient, false, false,
+		WithManagedIdentity(true, ""),
+		WithWorkloadIdentity(certificatePath),
+	)
+	require.NoError(t, err)
+	_, err = c.newCredential(false, "tenant", "client", "", http.DefaultClient)
+	require.Error(t, err)
+}
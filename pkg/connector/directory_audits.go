@@ -0,0 +1,330 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// Entra audit log activities that are translated into events.
+// https://learn.microsoft.com/en-us/entra/identity/monitoring-health/reference-audit-activities
+const (
+	auditAddGroupMember            = "Add member to group"
+	auditRemoveGroupMember         = "Remove member from group"
+	auditAddGroupOwner             = "Add owner to group"
+	auditRemoveGroupOwner          = "Remove owner from group"
+	auditAddUserAppRoleAssignment  = "Add app role assignment grant to user"
+	auditRemoveUserAppRoleAssign   = "Remove app role assignment from user"
+	auditAddGroupAppRoleAssignment = "Add app role assignment to group"
+	auditRemoveGroupAppRoleAssign  = "Remove app role assignment from group"
+	auditAddDirectoryRoleMember    = "Add member to role"
+	auditRemoveDirectoryRoleMember = "Remove member from role"
+
+	auditResultSuccess = "success"
+	// Graph accepts at most 1000 audit entries per page.
+	directoryAuditsMaxPageSize = 1000
+)
+
+// directoryAuditSource reads Entra ID directory audits. Requires the AuditLog.Read.All permission.
+// https://learn.microsoft.com/en-us/graph/api/directoryaudit-list?view=graph-rest-1.0
+type directoryAuditSource struct {
+	conn *Connector
+}
+
+func (s *directoryAuditSource) name() string {
+	return "directory_audits"
+}
+
+func (s *directoryAuditSource) listEvents(ctx context.Context, since time.Time, reqURL string, pageSize int) ([]*v2.Event, string, time.Time, error) {
+	if reqURL == "" {
+		v := url.Values{}
+		// since overlaps the previous pass, the audits it already returned are dropped by the cursor.
+		v.Set("$filter", fmt.Sprintf("activityDateTime ge %s", graphFilterTime(since)))
+		if pageSize > 0 && pageSize <= directoryAuditsMaxPageSize {
+			v.Set("$top", strconv.Itoa(pageSize))
+		}
+		reqURL = s.conn.buildURL("auditLogs/directoryAudits", v)
+	}
+
+	resp := &directoryAuditList{}
+	err := s.conn.queryUncached(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+
+	var (
+		rv     []*v2.Event
+		latest time.Time
+	)
+	for _, audit := range resp.Value {
+		if audit.ActivityDateTime.After(latest) {
+			latest = audit.ActivityDateTime
+		}
+
+		event := directoryAuditEvent(audit)
+		if event == nil {
+			continue
+		}
+		rv = append(rv, event)
+	}
+
+	ctxzap.Extract(ctx).Debug("baton-azure-infrastructure: listed directory audits",
+		zap.Int("audits", len(resp.Value)),
+		zap.Int("events", len(rv)),
+	)
+
+	return rv, resp.NextLink, latest, nil
+}
+
+// directoryAuditEvent translates a directory audit into an event, or returns nil when the activity
+// isn't one we track or its principal can't be mapped onto a synced resource.
+func directoryAuditEvent(audit *directoryAudit) *v2.Event {
+	if !strings.EqualFold(audit.Result, auditResultSuccess) {
+		return nil
+	}
+
+	switch audit.ActivityDisplayName {
+	case auditAddGroupMember:
+		return groupAuditEvent(audit, typeMembers, true)
+	case auditRemoveGroupMember:
+		return groupAuditEvent(audit, typeMembers, false)
+	case auditAddGroupOwner:
+		return groupAuditEvent(audit, typeOwners, true)
+	case auditRemoveGroupOwner:
+		return groupAuditEvent(audit, typeOwners, false)
+	case auditAddUserAppRoleAssignment:
+		return appRoleAuditEvent(audit, userResourceType, true)
+	case auditRemoveUserAppRoleAssign:
+		return appRoleAuditEvent(audit, userResourceType, false)
+	case auditAddGroupAppRoleAssignment:
+		return appRoleAuditEvent(audit, groupResourceType, true)
+	case auditRemoveGroupAppRoleAssign:
+		return appRoleAuditEvent(audit, groupResourceType, false)
+	case auditAddDirectoryRoleMember, auditRemoveDirectoryRoleMember:
+		return directoryRoleAuditEvent(audit)
+	default:
+		return nil
+	}
+}
+
+// groupAuditEvent handles group member and owner changes. The first target is the member, the
+// group is referenced through the Group.ObjectID modified property.
+func groupAuditEvent(audit *directoryAudit, permission string, added bool) *v2.Event {
+	groupID := auditModifiedValue(audit, "Group.ObjectID", added)
+	if groupID == "" {
+		return nil
+	}
+
+	principal := auditPrincipal(audit, groupID)
+	if principal == nil {
+		return nil
+	}
+
+	group := &v2.Resource{
+		Id: &v2.ResourceId{
+			ResourceType: groupResourceType.Id,
+			Resource:     groupID,
+		},
+	}
+	entitlement := &v2.Entitlement{
+		Id:       fmt.Sprintf("group:%s:%s", groupID, permission),
+		Resource: group,
+	}
+	if !added {
+		return newRevokeEvent(audit.ID, audit.ActivityDateTime, entitlement, principal)
+	}
+
+	var annos annotations.Annotations
+	if principal.Id.ResourceType == groupResourceType.Id {
+		annos.Update(&v2.GrantExpandable{
+			EntitlementIds: []string{
+				fmt.Sprintf("group:%s:members", principal.Id.Resource),
+			},
+		})
+	}
+
+	return newGrantEvent(audit.ID, audit.ActivityDateTime, &v2.Grant{
+		Id:          fmtResourceGrant(group.Id, principal.Id, groupID+":"+permission),
+		Entitlement: entitlement,
+		Principal:   principal,
+		Annotations: annos,
+	})
+}
+
+// appRoleAuditEvent handles app role assignments. The enterprise application is the ServicePrincipal
+// target and the assigned app role is referenced through the AppRole.Id modified property.
+func appRoleAuditEvent(audit *directoryAudit, principalType *v2.ResourceType, added bool) *v2.Event {
+	var appID, principalID string
+	for _, target := range audit.TargetResources {
+		switch {
+		case strings.EqualFold(target.Type, "ServicePrincipal") && appID == "":
+			appID = target.ID
+		case strings.EqualFold(target.Type, principalType.Id) && principalID == "":
+			principalID = target.ID
+		}
+	}
+	if principalID == "" {
+		principalID = auditModifiedValue(audit, "User.ObjectID", added)
+		if principalType == groupResourceType {
+			principalID = auditModifiedValue(audit, "Group.ObjectID", added)
+		}
+	}
+
+	appRoleID := auditModifiedValue(audit, "AppRole.Id", added)
+	if appID == "" || principalID == "" || appRoleID == "" {
+		return nil
+	}
+
+	app := &v2.Resource{
+		Id: &v2.ResourceId{
+			ResourceType: enterpriseApplicationResourceType.Id,
+			Resource:     appID,
+		},
+	}
+	principal := &v2.Resource{
+		Id: &v2.ResourceId{
+			ResourceType: principalType.Id,
+			Resource:     principalID,
+		},
+	}
+	entitlement := &v2.Entitlement{
+		Id:       fmt.Sprintf("enterprise_application:%s:assignment:%s", appID, appRoleID),
+		Resource: app,
+	}
+	if !added {
+		return newRevokeEvent(audit.ID, audit.ActivityDateTime, entitlement, principal)
+	}
+
+	var annos annotations.Annotations
+	if principalType == groupResourceType {
+		annos.Update(&v2.GrantExpandable{
+			EntitlementIds: []string{
+				fmt.Sprintf("group:%s:members", principalID),
+			},
+			Shallow:         true,
+			ResourceTypeIds: []string{userResourceType.Id},
+		})
+	}
+
+	return newGrantEvent(audit.ID, audit.ActivityDateTime, &v2.Grant{
+		Id:          fmtResourceGrant(app.Id, principal.Id, appRoleID),
+		Entitlement: entitlement,
+		Principal:   principal,
+		Annotations: annos,
+	})
+}
+
+// directoryRoleAuditEvent handles Entra directory role membership changes. Directory roles aren't synced
+// as resources, so the change is reported as activity on the affected principal by whoever initiated it.
+func directoryRoleAuditEvent(audit *directoryAudit) *v2.Event {
+	principal := auditPrincipal(audit, "")
+	if principal == nil {
+		return nil
+	}
+
+	return newUsageEvent(audit.ID, audit.ActivityDateTime, principal, auditInitiator(audit))
+}
+
+// auditPrincipal returns the first user or group target, skipping the object that was changed.
+func auditPrincipal(audit *directoryAudit, skipID string) *v2.Resource {
+	for _, target := range audit.TargetResources {
+		if target.ID == "" || target.ID == skipID {
+			continue
+		}
+
+		var resourceType *v2.ResourceType
+		switch {
+		case strings.EqualFold(target.Type, "User"):
+			resourceType = userResourceType
+		case strings.EqualFold(target.Type, "Group"):
+			resourceType = groupResourceType
+		default:
+			// Service principals can be enterprise applications or managed identities,
+			// the audit entry doesn't tell them apart.
+			continue
+		}
+
+		displayName := target.DisplayName
+		if displayName == "" {
+			displayName = target.UserPrincipalName
+		}
+		return &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: resourceType.Id,
+				Resource:     target.ID,
+			},
+			DisplayName: displayName,
+		}
+	}
+
+	return nil
+}
+
+func auditInitiator(audit *directoryAudit) *v2.Resource {
+	if audit.InitiatedBy == nil {
+		return nil
+	}
+
+	if u := audit.InitiatedBy.User; u != nil && u.ID != "" {
+		return &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: userResourceType.Id,
+				Resource:     u.ID,
+			},
+			DisplayName: u.UserPrincipalName,
+		}
+	}
+
+	if app := audit.InitiatedBy.App; app != nil && app.ServicePrincipalID != "" {
+		return &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: enterpriseApplicationResourceType.Id,
+				Resource:     app.ServicePrincipalID,
+			},
+			DisplayName: app.DisplayName,
+		}
+	}
+
+	return nil
+}
+
+// auditModifiedValue returns a modified property of any target. Additions carry the value in newValue,
+// removals in oldValue. Values are JSON encoded strings, sometimes wrapped in an array.
+func auditModifiedValue(audit *directoryAudit, name string, added bool) string {
+	for _, target := range audit.TargetResources {
+		for _, property := range target.ModifiedProperties {
+			if property.DisplayName != name {
+				continue
+			}
+
+			raw := property.OldValue
+			if added {
+				raw = property.NewValue
+			}
+
+			var value string
+			if err := json.Unmarshal([]byte(raw), &value); err == nil {
+				return value
+			}
+
+			var values []string
+			if err := json.Unmarshal([]byte(raw), &values); err == nil && len(values) > 0 {
+				return values[0]
+			}
+
+			return strings.Trim(raw, `"`)
+		}
+	}
+
+	return ""
+}
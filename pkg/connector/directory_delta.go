@@ -0,0 +1,35 @@
+package connector
+
+import (
+	"net/url"
+)
+
+// User and group listing through delta queries.
+//
+// With delta sync enabled, users and groups are listed through users/delta and groups/delta, and the link to the
+// next page is kept in the page token. The SDK keeps no List state from one sync to the next, so every sync still
+// enumerates all users and groups. What carries over is the groups/delta link stamped on each group's members, see
+// group_delta.go.
+//   - Graph filters aren't supported by delta queries, so a type with a configured filter is listed as before.
+//   - users/delta doesn't return signInActivity, so last login isn't synced for users listed through delta.
+//   - Delta pages never come from the HTTP cache, the first page has the same URL on every sync.
+//
+// https://learn.microsoft.com/en-us/graph/api/user-delta?view=graph-rest-1.0
+// https://learn.microsoft.com/en-us/graph/delta-query-overview
+
+// listsUsersThroughDelta reports whether users are listed through users/delta.
+func (d *Connector) listsUsersThroughDelta() bool {
+	return d.deltaSync && d.graphFilters.users == ""
+}
+
+// listsGroupsThroughDelta reports whether groups are listed through groups/delta.
+func (d *Connector) listsGroupsThroughDelta() bool {
+	return d.deltaSync && d.graphFilters.groups == ""
+}
+
+// deltaListURL returns the first page of a users/delta or groups/delta listing. Delta queries page on their own and
+// don't support $top.
+func (d *Connector) deltaListURL(path string, v url.Values) string {
+	v.Del("$top")
+	return d.buildURL(path+"/delta", v)
+}
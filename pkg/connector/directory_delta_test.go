@@ -0,0 +1,48 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaListingOffline(t *testing.T) {
+	f := newFakeTenant(t)
+	f.addObject("g-ad", map[string]any{
+		"@odata.type":           odataTypeGroup,
+		"displayName":           "Synced from AD",
+		"onPremisesSyncEnabled": true,
+	})
+	// Delta pages must be read again every sync, even with the HTTP cache on.
+	t.Setenv("BATON_DISABLE_HTTP_CACHE", "false")
+	c, err := NewConnectorFromToken(context.Background(), f.server.Client(), staticToken{}, false, true,
+		WithBaseURLs(f.server.URL, f.server.URL), WithDeltaSync(true))
+	require.NoError(t, err)
+	u := newUserBuilder(c)
+	g := newGroupBuilder(c)
+
+	require.Equal(t, []string{"u1", "u2", "u3", "u4", "u5"}, resourceIDs(listAll(t, u, nil)))
+	require.Equal(t, []string{"g1"}, resourceIDs(listAll(t, g, nil)), "groups synced from AD are skipped")
+	require.Equal(t, 3, f.requestCount("GET /v1.0/users/delta"))
+	require.Equal(t, f.requestCount("GET /v1.0/users/delta"), f.requestCount("GET /v1.0/users"), "users are only listed through delta")
+
+	// Every sync lists all users again, including the changes made since.
+	f.updateObject("u1", "displayName", "Renamed")
+	f.addUser("u6", "User u6")
+	f.removeObject("u2")
+	users := listAll(t, u, nil)
+	require.Equal(t, []string{"u1", "u3", "u4", "u5", "u6"}, resourceIDs(users))
+	require.Equal(t, "Renamed", findResource(t, users, "u1").DisplayName)
+	require.Equal(t, 6, f.requestCount("GET /v1.0/users/delta"))
+}
+
+func TestDeltaListingFiltered(t *testing.T) {
+	f := newFakeTenant(t)
+	c := f.connector(t, WithDeltaSync(true), WithUserFilter("accountEnabled eq true"))
+	require.False(t, c.listsUsersThroughDelta())
+	require.True(t, c.listsGroupsThroughDelta())
+
+	require.Len(t, listAll(t, newUserBuilder(c), nil), 5)
+	require.Equal(t, 0, f.requestCount("GET /v1.0/users/delta"))
+}
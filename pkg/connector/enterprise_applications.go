@@ -1,7 +1,6 @@
 package connector
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -54,6 +53,7 @@ func (e *enterpriseApplicationsBuilder) List(ctx context.Context, parentResource
 	if reqURL == "" {
 		urlValues := setEnterpriseApplicationsKeys()
 		urlValues.Set("$expand", "appRoleAssignedTo")
+		addGraphFilter(urlValues, e.conn.graphFilters.servicePrincipals)
 		reqURL = e.conn.buildBetaURL("servicePrincipals", urlValues)
 	}
 
@@ -73,7 +73,12 @@ func (e *enterpriseApplicationsBuilder) List(ctx context.Context, parentResource
 	}
 
 	entApps, err := slices.ConvertErr(applicationsOwned, func(app *servicePrincipal) (*v2.Resource, error) {
-		return enterpriseApplicationResource(ctx, app, parentResourceID)
+		activity, err := e.conn.getServicePrincipalSignInActivity(ctx, app.AppId)
+		if err != nil {
+			return nil, err
+		}
+
+		return enterpriseApplicationResource(ctx, e.conn.azureCloud(), app, activity, e.conn.applicationLogo(app), parentResourceID)
 	})
 	if err != nil {
 		return nil, "", nil, err
@@ -269,7 +274,14 @@ func (e *enterpriseApplicationsBuilder) Grants(ctx context.Context, resource *v2
 		if err != nil {
 			return nil, "", nil, err
 		}
-		return grants, "", nil, err
+
+		// Move on to the owners page.
+		pageToken, err := b.NextToken("")
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		return grants, pageToken, nil, nil
 	case ownersStr:
 		resp := &membershipList{}
 		err = e.conn.query(ctx, graphReadScopes, http.MethodGet, ps.Token, nil, resp)
@@ -416,20 +428,12 @@ func (o *enterpriseApplicationsBuilder) Grant(ctx context.Context, principal *v2
 	resourceID := entitlement.Resource.Id.Resource
 	switch eaEntId.Type {
 	case "owners":
-		var reqBody *bytes.Reader
 		// https://learn.microsoft.com/en-us/graph/api/serviceprincipal-list-owners?view=graph-rest-1.0&tabs=http
 		// POST /servicePrincipals/{id}/owners/$ref
-		objRef := url.URL{
-			Scheme: "https",
-			Host:   "graph.microsoft.com",
-			Path:   path.Join("v1.0", "directoryObjects", principal.Id.Resource),
-		}
+		objRef := o.conn.azureCloud().directoryObjectURL(principal.Id.Resource)
 		reqURL = o.conn.buildURL(path.Join("servicePrincipals", resourceID, "owners", "$ref"), v)
-		reqBody, err = (&assignment{
-			ObjectRef: objRef.String(),
-		}).MarshalToReader()
-		if err != nil {
-			return nil, err
+		reqBody := &assignment{
+			ObjectRef: objRef,
 		}
 		err = o.conn.query(ctx, graphReadScopes, http.MethodPost, reqURL, reqBody, nil)
 		if err != nil {
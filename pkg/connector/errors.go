@@ -0,0 +1,166 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultRateLimitReset is reported as the reset time of throttled responses that don't say when to come back.
+const defaultRateLimitReset = time.Minute
+
+// requestIDHeaders identify a request to Microsoft support. Graph sends request-id and client-request-id,
+// ARM sends x-ms-request-id and x-ms-correlation-request-id.
+var requestIDHeaders = []string{
+	"request-id",
+	"client-request-id",
+	"x-ms-request-id",
+	"x-ms-correlation-request-id",
+}
+
+// graphErrorResponse is the error body Graph and ARM return.
+// https://learn.microsoft.com/en-us/graph/errors
+type graphErrorResponse struct {
+	Error struct {
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+		InnerError struct {
+			RequestID       string `json:"request-id"`
+			ClientRequestID string `json:"client-request-id"`
+		} `json:"innerError"`
+	} `json:"error"`
+}
+
+// grpcCode maps an HTTP status onto the gRPC code the SDK acts on. Throttling and server errors map to
+// Unavailable, which is what the syncer retries.
+func grpcCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusRequestTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.Unavailable
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	}
+
+	if statusCode >= 500 && statusCode <= 599 {
+		return codes.Unavailable
+	}
+
+	return codes.Unknown
+}
+
+// GRPCStatus lets status.FromError and status.Code see the response as a gRPC status. The Graph or ARM error code
+// and the request IDs are kept in an ErrorInfo detail, throttled responses also carry a RateLimitDescription.
+func (e *HTTPError) GRPCStatus() *status.Status {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.ErrorCode != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.ErrorCode)
+	}
+	if e.ErrorMessage != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.ErrorMessage)
+	}
+	st := status.New(grpcCode(e.StatusCode), msg)
+
+	reason := e.ErrorCode
+	if reason == "" {
+		reason = strconv.Itoa(e.StatusCode)
+	}
+	metadata := map[string]string{
+		"http-status": strconv.Itoa(e.StatusCode),
+	}
+	for key, value := range e.RequestIDs {
+		metadata[key] = value
+	}
+
+	details := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{
+			Reason:   reason,
+			Domain:   e.Domain,
+			Metadata: metadata,
+		},
+	}
+	if e.RateLimited {
+		details = append(details, e.rateLimitDescription())
+	}
+
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+
+	return withDetails
+}
+
+func (e *HTTPError) rateLimitDescription() *v2.RateLimitDescription {
+	wait := defaultRateLimitReset
+	if e.RetryAfter > 0 {
+		wait = time.Duration(e.RetryAfter) * time.Second
+	}
+
+	return &v2.RateLimitDescription{
+		Status:  v2.RateLimitDescription_STATUS_OVERLIMIT,
+		ResetAt: timestamppb.New(time.Now().Add(wait)),
+	}
+}
+
+// parseErrorResponse fills the error code, message and request IDs from the response headers and body.
+func (e *HTTPError) parseErrorResponse(header http.Header, rawResponse string) {
+	e.RequestIDs = make(map[string]string)
+	for _, key := range requestIDHeaders {
+		if value := header.Get(key); value != "" {
+			e.RequestIDs[key] = value
+		}
+	}
+
+	body := &graphErrorResponse{}
+	if err := json.Unmarshal([]byte(rawResponse), body); err != nil {
+		return
+	}
+
+	e.ErrorCode = body.Error.Code
+	e.ErrorMessage = body.Error.Message
+	if _, ok := e.RequestIDs["request-id"]; !ok && body.Error.InnerError.RequestID != "" {
+		e.RequestIDs["request-id"] = body.Error.InnerError.RequestID
+	}
+	if _, ok := e.RequestIDs["client-request-id"]; !ok && body.Error.InnerError.ClientRequestID != "" {
+		e.RequestIDs["client-request-id"] = body.Error.InnerError.ClientRequestID
+	}
+}
+
+// armError translates an azcore.ResponseError returned by the ARM SDK clients into an HTTPError, so ARM failures
+// carry the same gRPC codes and details as Graph failures. Any other error is returned as is.
+func armError(err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.RawResponse == nil {
+		return err
+	}
+
+	httpErr := newHTTPError(respErr.RawResponse, "", err)
+	httpErr.ErrorCode = respErr.ErrorCode
+
+	return httpErr
+}
@@ -0,0 +1,95 @@
+package connector
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPErrorStatus(t *testing.T) {
+	for statusCode, code := range map[int]codes.Code{
+		http.StatusBadRequest:          codes.InvalidArgument,
+		http.StatusUnauthorized:        codes.Unauthenticated,
+		http.StatusForbidden:           codes.PermissionDenied,
+		http.StatusNotFound:            codes.NotFound,
+		http.StatusConflict:            codes.AlreadyExists,
+		http.StatusTooManyRequests:     codes.Unavailable,
+		http.StatusInternalServerError: codes.Unavailable,
+		http.StatusServiceUnavailable:  codes.Unavailable,
+	} {
+		resp := &http.Response{StatusCode: statusCode, Header: http.Header{}}
+		require.Equal(t, code, status.Code(newHTTPError(resp, "", ErrRequestFailed)), statusCode)
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header: http.Header{
+			"Retry-After":       []string{"5"},
+			"Client-Request-Id": []string{"client-1"},
+		},
+	}
+	body := `{"error": {"code": "TooManyRequests", "message": "slow down", "innerError": {"request-id": "req-1"}}}`
+	err := errors.Join(errors.New("GET failed"), newHTTPError(resp, body, ErrRequestFailed))
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, codes.Unavailable, st.Code())
+	require.Contains(t, st.Message(), "slow down")
+
+	var (
+		info      *errdetails.ErrorInfo
+		rateLimit *v2.RateLimitDescription
+	)
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			info = d
+		case *v2.RateLimitDescription:
+			rateLimit = d
+		}
+	}
+	require.NotNil(t, info)
+	require.Equal(t, "TooManyRequests", info.Reason)
+	require.Equal(t, "req-1", info.Metadata["request-id"])
+	require.Equal(t, "client-1", info.Metadata["client-request-id"])
+	require.NotNil(t, rateLimit)
+	require.NotNil(t, rateLimitDescription(err))
+}
+
+func TestARMError(t *testing.T) {
+	reqURL, err := url.Parse("https://management.azure.com/subscriptions/1/resourcegroups")
+	require.NoError(t, err)
+
+	resp := &http.Response{
+		StatusCode: http.StatusForbidden,
+		Header: http.Header{
+			"Content-Type":                []string{"application/json"},
+			"X-Ms-Correlation-Request-Id": []string{"corr-1"},
+		},
+		Body:    io.NopCloser(bytes.NewBufferString(`{"error": {"code": "AuthorizationFailed", "message": "denied"}}`)),
+		Request: &http.Request{Method: http.MethodGet, URL: reqURL},
+	}
+	err = armError(runtime.NewResponseError(resp))
+
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.ErrorIs(t, err, ErrRequestFailed)
+
+	var httpErr *HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	require.Equal(t, "AuthorizationFailed", httpErr.ErrorCode)
+	require.Equal(t, "management.azure.com", httpErr.Domain)
+	require.Equal(t, "corr-1", httpErr.RequestIDs["x-ms-correlation-request-id"])
+
+	plain := errors.New("boom")
+	require.Equal(t, plain, armError(plain))
+}
@@ -0,0 +1,290 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// defaultEventLookback is used when the SDK doesn't ask for events from a specific point in time.
+	defaultEventLookback = 24 * time.Hour
+	// eventIngestionLag is how late a log entry may show up after newer entries were already read, the Activity
+	// Log takes up to 20 minutes. Every pass reads this window before the newest entry seen again, and drops the
+	// events that were already returned.
+	eventIngestionLag = 30 * time.Minute
+)
+
+// eventSource is one of the logs that make up the connector's event feed.
+type eventSource interface {
+	// name identifies the source inside the stream cursor.
+	name() string
+	// listEvents returns one page of events that occurred at or after since, the link to the next page and the
+	// time of the newest log entry on the page, including entries that didn't translate into an event.
+	// reqURL is empty for the first page.
+	listEvents(ctx context.Context, since time.Time, reqURL string, pageSize int) ([]*v2.Event, string, time.Time, error)
+}
+
+// eventFeedCursor tracks every event source separately. Sources are read one after the other and each of
+// them remembers the newest entry it read, the next pass starts eventIngestionLag before it once all sources
+// are done.
+type eventFeedCursor struct {
+	Sources map[string]*eventSourceCursor `json:"sources"`
+}
+
+type eventSourceCursor struct {
+	Since    time.Time `json:"since"`
+	Latest   time.Time `json:"latest,omitempty"`
+	NextLink string    `json:"next_link,omitempty"`
+	Done     bool      `json:"done,omitempty"`
+	// Seen holds when the events returned within eventIngestionLag of Latest occurred, by event ID.
+	Seen map[string]time.Time `json:"seen,omitempty"`
+}
+
+// eventSources returns the Entra directory audits, the sign-in logs when enabled and the Activity Log of
+// every subscription. Subscriptions are listed when a pass starts, while a pass is in progress they are read
+// from the cursor so every page doesn't list them again.
+func (d *Connector) eventSources(ctx context.Context, cursor *eventFeedCursor) ([]eventSource, error) {
+	sources := []eventSource{
+		&directoryAuditSource{conn: d},
+	}
+	if d.signInLookback > 0 {
+		sources = append(sources, &signInSource{
+			conn:     d,
+			lookback: d.signInLookback,
+		})
+	}
+
+	var subscriptionIDs []string
+	if cursor.inProgress() {
+		for name := range cursor.Sources {
+			if subscriptionID, ok := strings.CutPrefix(name, activityLogSourcePrefix); ok {
+				subscriptionIDs = append(subscriptionIDs, subscriptionID)
+			}
+		}
+	} else {
+		var err error
+		subscriptionIDs, err = d.listSubscriptionIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(subscriptionIDs)
+
+	for _, subscriptionID := range subscriptionIDs {
+		sources = append(sources, &activityLogSource{
+			conn:           d,
+			subscriptionID: subscriptionID,
+		})
+	}
+
+	return sources, nil
+}
+
+// ListEvents implements connectorbuilder.EventProvider.
+func (d *Connector) ListEvents(
+	ctx context.Context,
+	earliestEvent *timestamppb.Timestamp,
+	pToken *pagination.StreamToken,
+) ([]*v2.Event, *pagination.StreamState, annotations.Annotations, error) {
+	cursor := &eventFeedCursor{}
+	if pToken != nil && pToken.Cursor != "" {
+		err := json.Unmarshal([]byte(pToken.Cursor), cursor)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("baton-azure-infrastructure: invalid event feed cursor: %w", err)
+		}
+	}
+
+	start := time.Now().Add(-defaultEventLookback)
+	if earliestEvent != nil {
+		start = earliestEvent.AsTime()
+	}
+
+	sources, err := d.eventSources(ctx, cursor)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cursor.startPass(sources, start)
+
+	pageSize := 0
+	if pToken != nil {
+		pageSize = pToken.Size
+	}
+
+	var rv []*v2.Event
+	for _, source := range sources {
+		sc := cursor.Sources[source.name()]
+		if sc.Done {
+			continue
+		}
+
+		events, nextLink, latest, err := source.listEvents(ctx, sc.Since, sc.NextLink, pageSize)
+		if status.Code(err) == codes.PermissionDenied {
+			// A missing permission on one log shouldn't hold back the others. The source is tried again next pass.
+			if _, warned := d.deniedEventSources.LoadOrStore(source.name(), true); !warned {
+				ctxzap.Extract(ctx).Warn("baton-azure-infrastructure: no access to event source, skipping it",
+					zap.String("source", source.name()),
+					zap.Error(err),
+				)
+			}
+			sc.NextLink = ""
+			sc.Done = true
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		rv = sc.record(events, latest)
+		sc.NextLink = nextLink
+		sc.Done = nextLink == ""
+		break
+	}
+
+	hasMore := false
+	for _, sc := range cursor.Sources {
+		if !sc.Done {
+			hasMore = true
+		}
+	}
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return rv, &pagination.StreamState{
+		Cursor:  string(data),
+		HasMore: hasMore,
+	}, nil, nil
+}
+
+// startPass drops sources that no longer exist and, once every source finished reading, starts a new pass
+// eventIngestionLag before the newest entry each source has seen.
+func (c *eventFeedCursor) startPass(sources []eventSource, start time.Time) {
+	inProgress := false
+	for _, source := range sources {
+		if sc, ok := c.Sources[source.name()]; ok && !sc.Done {
+			inProgress = true
+		}
+	}
+
+	rv := make(map[string]*eventSourceCursor, len(sources))
+	for _, source := range sources {
+		sc, ok := c.Sources[source.name()]
+		switch {
+		case !ok:
+			sc = &eventSourceCursor{Since: start}
+		case !inProgress:
+			since := sc.Since
+			if !sc.Latest.IsZero() {
+				since = sc.Latest.Add(-eventIngestionLag)
+			}
+			if start.After(since) {
+				since = start
+			}
+			sc = &eventSourceCursor{Since: since, Latest: sc.Latest, Seen: sc.Seen}
+		}
+		rv[source.name()] = sc
+	}
+	c.Sources = rv
+}
+
+// record drops the events that were already returned and remembers the rest, along with the newest entry of the
+// page. Events older than eventIngestionLag before the newest entry are forgotten, the next pass doesn't read them.
+func (sc *eventSourceCursor) record(events []*v2.Event, latest time.Time) []*v2.Event {
+	if latest.After(sc.Latest) {
+		sc.Latest = latest
+	}
+
+	rv := make([]*v2.Event, 0, len(events))
+	for _, event := range events {
+		if _, ok := sc.Seen[event.Id]; ok {
+			continue
+		}
+		if sc.Seen == nil {
+			sc.Seen = make(map[string]time.Time)
+		}
+		sc.Seen[event.Id] = event.OccurredAt.AsTime()
+		rv = append(rv, event)
+	}
+
+	cutoff := sc.Latest.Add(-eventIngestionLag)
+	for id, occurredAt := range sc.Seen {
+		if occurredAt.Before(cutoff) {
+			delete(sc.Seen, id)
+		}
+	}
+
+	return rv
+}
+
+// inProgress reports whether a source is still reading the current pass.
+func (c *eventFeedCursor) inProgress() bool {
+	for _, sc := range c.Sources {
+		if !sc.Done {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newGrantEvent(id string, occurredAt time.Time, g *v2.Grant) *v2.Event {
+	return &v2.Event{
+		Id:         id,
+		OccurredAt: timestamppb.New(occurredAt),
+		Event: &v2.Event_GrantEvent{
+			GrantEvent: &v2.GrantEvent{
+				Grant: g,
+			},
+		},
+	}
+}
+
+func newRevokeEvent(id string, occurredAt time.Time, entitlement *v2.Entitlement, principal *v2.Resource) *v2.Event {
+	return &v2.Event{
+		Id:         id,
+		OccurredAt: timestamppb.New(occurredAt),
+		Event: &v2.Event_RevokeEvent{
+			RevokeEvent: &v2.RevokeEvent{
+				Entitlement: entitlement,
+				Principal:   principal,
+			},
+		},
+	}
+}
+
+func newUsageEvent(id string, occurredAt time.Time, target *v2.Resource, actor *v2.Resource) *v2.Event {
+	return &v2.Event{
+		Id:         id,
+		OccurredAt: timestamppb.New(occurredAt),
+		Event: &v2.Event_UsageEvent{
+			UsageEvent: &v2.UsageEvent{
+				TargetResource: target,
+				ActorResource:  actor,
+			},
+		},
+	}
+}
+
+// graphFilterTimeLayout keeps the 100ns precision of log timestamps, so filtering on the newest timestamp seen
+// doesn't round down to the second.
+const graphFilterTimeLayout = "2006-01-02T15:04:05.0000000Z07:00"
+
+// graphFilterTime formats t the way OData expects DateTimeOffset literals.
+func graphFilterTime(t time.Time) string {
+	return t.UTC().Format(graphFilterTimeLayout)
+}
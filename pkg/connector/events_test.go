@@ -0,0 +1,372 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDirectoryAuditEvent(t *testing.T) {
+	audits := &directoryAuditList{}
+	err := json.Unmarshal([]byte(`{"value": [
+		{
+			"id": "a1",
+			"activityDateTime": "2024-05-01T10:00:00Z",
+			"activityDisplayName": "Add member to group",
+			"result": "success",
+			"targetResources": [
+				{
+					"id": "u1",
+					"type": "User",
+					"userPrincipalName": "jdoe@example.com",
+					"modifiedProperties": [{"displayName": "Group.ObjectID", "oldValue": null, "newValue": "\"g1\""}]
+				},
+				{"id": "g1", "type": "Group"}
+			]
+		},
+		{
+			"id": "a2",
+			"activityDateTime": "2024-05-01T11:00:00Z",
+			"activityDisplayName": "Remove app role assignment from user",
+			"result": "success",
+			"targetResources": [
+				{
+					"id": "sp1",
+					"type": "ServicePrincipal",
+					"modifiedProperties": [
+						{"displayName": "AppRole.Id", "oldValue": "\"r1\"", "newValue": null},
+						{"displayName": "User.ObjectID", "oldValue": "\"u1\"", "newValue": null}
+					]
+				}
+			]
+		},
+		{
+			"id": "a3",
+			"activityDateTime": "2024-05-01T12:00:00Z",
+			"activityDisplayName": "Add member to group",
+			"result": "failure"
+		}
+	]}`), audits)
+	require.NoError(t, err)
+
+	added := directoryAuditEvent(audits.Value[0])
+	require.NotNil(t, added)
+	require.Equal(t, "group:g1:members", added.GetGrantEvent().GetGrant().GetEntitlement().GetId())
+	require.Equal(t, "u1", added.GetGrantEvent().GetGrant().GetPrincipal().GetId().GetResource())
+	require.Equal(t, userResourceType.Id, added.GetGrantEvent().GetGrant().GetPrincipal().GetId().GetResourceType())
+
+	removed := directoryAuditEvent(audits.Value[1])
+	require.NotNil(t, removed)
+	require.Equal(t, "enterprise_application:sp1:assignment:r1", removed.GetRevokeEvent().GetEntitlement().GetId())
+	require.Equal(t, "u1", removed.GetRevokeEvent().GetPrincipal().GetId().GetResource())
+
+	require.Nil(t, directoryAuditEvent(audits.Value[2]))
+}
+
+func TestDirectoryAuditSourceOffline(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeTenant(t)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	f.addDirectoryAudit("a1", start.Add(time.Minute), "g1", "u4")
+	f.addDirectoryAudit("a2", start.Add(2*time.Minute+500*time.Millisecond), "g1", "u5")
+	source := &directoryAuditSource{conn: f.connector(t)}
+
+	events, nextLink, latest, err := source.listEvents(ctx, start, "", 0)
+	require.NoError(t, err)
+	require.Empty(t, nextLink)
+	require.Equal(t, []string{"a1", "a2"}, []string{events[0].Id, events[1].Id})
+	require.Equal(t, start.Add(2*time.Minute+500*time.Millisecond), latest)
+
+	// Audits at since are included, keeping the 100ns precision of the log.
+	f.addDirectoryAudit("a3", start.Add(2*time.Minute+700*time.Millisecond), "g1", "u3")
+	events, _, _, err = source.listEvents(ctx, latest, "", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a2", "a3"}, []string{events[0].Id, events[1].Id})
+}
+
+func TestListEventsLateAudits(t *testing.T) {
+	f := newFakeTenant(t)
+	f.pageSize = 10
+	now := time.Now().UTC()
+	f.addDirectoryAudit("a1", now.Add(-10*time.Minute), "g1", "u4")
+	// Audits have to be read again every pass, even with the HTTP cache on.
+	t.Setenv("BATON_DISABLE_HTTP_CACHE", "false")
+	c, err := NewConnectorFromToken(context.Background(), f.server.Client(), staticToken{}, false, false,
+		WithBaseURLs(f.server.URL, f.server.URL))
+	require.NoError(t, err)
+
+	var token *pagination.StreamToken
+	listPass := func() []string {
+		var ids []string
+		for {
+			events, state, _, err := c.ListEvents(context.Background(), timestamppb.New(now.Add(-time.Hour)), token)
+			require.NoError(t, err)
+			for _, event := range events {
+				ids = append(ids, event.Id)
+			}
+			token = &pagination.StreamToken{Cursor: state.Cursor}
+			if !state.HasMore {
+				return ids
+			}
+		}
+	}
+
+	require.Equal(t, []string{"a1"}, listPass())
+
+	// An audit ingested late, older than the newest one read, is returned by the next pass, a1 isn't returned again.
+	f.addDirectoryAudit("a2", now.Add(-12*time.Minute), "g1", "u5")
+	require.Equal(t, []string{"a2"}, listPass())
+	// The passes read the same window, which must not come from the cache.
+	f.addDirectoryAudit("a3", now.Add(-11*time.Minute), "g1", "u3")
+	require.Equal(t, []string{"a3"}, listPass())
+	require.Empty(t, listPass())
+}
+
+func TestSignInSourceOffline(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeTenant(t)
+	now := time.Now().UTC()
+	f.addSignIn("s1", now.Add(-time.Hour), "u1", "app-app1")
+	f.addSignIn("s2", now.Add(-30*time.Minute), "u2", "app-unknown")
+	source := &signInSource{conn: f.connector(t), lookback: 24 * time.Hour}
+
+	// Sign-ins to applications without a service principal in the tenant are dropped.
+	events, _, latest, err := source.listEvents(ctx, now.Add(-48*time.Hour), "", 0)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	usage := events[0].GetUsageEvent()
+	require.Equal(t, "app1", usage.GetTargetResource().GetId().GetResource())
+	require.Equal(t, "u1", usage.GetActorResource().GetId().GetResource())
+	require.Equal(t, now.Add(-30*time.Minute), latest)
+
+	// The newest sign-in of a pass isn't returned again by the next one.
+	events, _, _, err = source.listEvents(ctx, latest, "", 0)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	// Throttling is returned to the SDK as Unavailable with a rate limit description.
+	f.throttle("auditLogs/signIns", 3)
+	_, _, _, err = source.listEvents(ctx, latest, "", 0)
+	require.Error(t, err)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.NotNil(t, rateLimitDescription(err))
+
+	// Applications added since are found on the next sync.
+	f.addServicePrincipal("unknown", "Application")
+	events, _, _, err = source.listEvents(ctx, now.Add(-48*time.Hour), "", 0)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	source.conn.syncEpoch.Add(1)
+	events, _, _, err = source.listEvents(ctx, now.Add(-48*time.Hour), "", 0)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	// Without a license the source is refused, ListEvents skips it.
+	f.unlicensed = true
+	_, _, _, err = source.listEvents(ctx, latest, "", 0)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.ErrorContains(t, err, "Entra ID P1 or P2 license")
+}
+
+func TestGraphFilterTime(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 123456700, time.FixedZone("CEST", 2*60*60))
+	require.Equal(t, "2024-05-01T08:00:00.1234567Z", graphFilterTime(at))
+}
+
+func TestActivityLogSourceOffline(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeTenant(t)
+	subscriptionScope := "/subscriptions/" + fakeSubscriptionID
+	f.addActivityLogRoleAssignment(fakeSubscriptionID, "e1", roleAssignmentWriteOperation, activityLogStatusSucceeded, subscriptionScope, fakeRoleID, "u1")
+	f.addActivityLogRoleAssignment(fakeSubscriptionID, "e2", roleAssignmentDeleteOperation, activityLogStatusSucceeded, subscriptionScope+"/resourceGroups/rg1", fakeRoleID, "u2")
+	f.addActivityLogRoleAssignment(fakeSubscriptionID, "e3", roleAssignmentWriteOperation, activityLogStatusSucceeded, subscriptionScope+"/resourceGroups/rg2", fakeRoleID, "u3")
+	f.addActivityLogRoleAssignment(fakeSubscriptionID, "e4", roleAssignmentWriteOperation, "Failed", subscriptionScope, fakeRoleID, "u4")
+	f.addActivityLogRoleAssignment(fakeSubscriptionID, "e5", roleAssignmentWriteOperation, activityLogStatusSucceeded, subscriptionScope, fakeRoleID, "deleted")
+	f.pageSize = 10
+	c := f.connector(t, WithExcludedResourceGroups("rg2"))
+	source := &activityLogSource{conn: c, subscriptionID: fakeSubscriptionID}
+
+	events, _, _, err := source.listEvents(ctx, time.Now().Add(-time.Hour), "", 0)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	// Subscription scope assignments target the subscription's role.
+	require.Equal(t, "e1", events[0].Id)
+	granted := events[0].GetGrantEvent().GetGrant()
+	require.Equal(t, roleResourceType.Id, granted.GetEntitlement().GetResource().GetId().GetResourceType())
+	require.Equal(t, fakeRoleID+":"+fakeSubscriptionID, granted.GetEntitlement().GetResource().GetId().GetResource())
+	require.Equal(t, "u1", granted.GetPrincipal().GetId().GetResource())
+
+	// Resource group assignments target the resource group's role, rg2 is filtered out.
+	require.Equal(t, "e2", events[1].Id)
+	revoked := events[1].GetRevokeEvent()
+	require.Equal(t, roleAssignmentResourceGroupType.Id, revoked.GetEntitlement().GetResource().GetId().GetResourceType())
+	require.Equal(t, getResourceGroupID("rg1", fakeSubscriptionID, fakeRoleID), revoked.GetEntitlement().GetResource().GetId().GetResource())
+	require.Equal(t, "u2", revoked.GetPrincipal().GetId().GetResource())
+
+	// Principals are resolved in one batch.
+	require.Equal(t, 1, f.requestCount("POST /v1.0/$batch"))
+	require.Equal(t, 3, f.requestCount("GET /v1.0/directoryObjects"))
+}
+
+func TestListEventsSubscriptionsPerPass(t *testing.T) {
+	f := newFakeTenant(t)
+	f.addSubscription("s2")
+	c := f.connector(t)
+
+	listPass := func() {
+		var token *pagination.StreamToken
+		for {
+			_, state, _, err := c.ListEvents(context.Background(), timestamppb.Now(), token)
+			require.NoError(t, err)
+			if !state.HasMore {
+				return
+			}
+			token = &pagination.StreamToken{Cursor: state.Cursor}
+		}
+	}
+
+	// Activity Log paths start with the subscription too.
+	subscriptionLists := func() int {
+		return f.requestCount("GET /subscriptions") - f.requestCount("Microsoft.Insights")
+	}
+
+	listPass()
+	require.Equal(t, 1, subscriptionLists())
+	require.Equal(t, 2, f.requestCount("Microsoft.Insights"))
+	listPass()
+	require.Equal(t, 2, subscriptionLists())
+}
+
+func TestListEventsSkipsDeniedSources(t *testing.T) {
+	f := newFakeTenant(t)
+	f.noAuditLogRead = true
+	f.pageSize = 10
+	f.addActivityLogRoleAssignment(fakeSubscriptionID, "e1", roleAssignmentWriteOperation, activityLogStatusSucceeded,
+		"/subscriptions/"+fakeSubscriptionID, fakeRoleID, "u1")
+	c := f.connector(t, WithSignInLookback(time.Hour))
+
+	// Without AuditLog.Read.All the directory audits and sign-ins are skipped, the Activity Log is still read.
+	var (
+		token *pagination.StreamToken
+		ids   []string
+	)
+	for {
+		events, state, _, err := c.ListEvents(context.Background(), timestamppb.New(time.Now().Add(-time.Hour)), token)
+		require.NoError(t, err)
+		for _, event := range events {
+			ids = append(ids, event.Id)
+		}
+		if !state.HasMore {
+			break
+		}
+		token = &pagination.StreamToken{Cursor: state.Cursor}
+	}
+	require.Equal(t, []string{"e1"}, ids)
+	require.Equal(t, 1, f.requestCount("auditLogs/directoryAudits"))
+}
+
+func TestListEventsActivityLogOverlap(t *testing.T) {
+	f := newFakeTenant(t)
+	f.pageSize = 10
+	subscriptionScope := "/subscriptions/" + fakeSubscriptionID
+	f.addActivityLogRoleAssignment(fakeSubscriptionID, "e1", roleAssignmentWriteOperation, activityLogStatusSucceeded, subscriptionScope, fakeRoleID, "u1")
+	c := f.connector(t)
+
+	var token *pagination.StreamToken
+	listPass := func() []string {
+		var ids []string
+		for {
+			events, state, _, err := c.ListEvents(context.Background(), timestamppb.New(time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)), token)
+			require.NoError(t, err)
+			for _, event := range events {
+				ids = append(ids, event.Id)
+			}
+			token = &pagination.StreamToken{Cursor: state.Cursor}
+			if !state.HasMore {
+				return ids
+			}
+		}
+	}
+
+	require.Equal(t, []string{"e1"}, listPass())
+	// Entries at the newest timestamp of the previous pass are read again, only the new one is returned.
+	f.addActivityLogRoleAssignment(fakeSubscriptionID, "e2", roleAssignmentDeleteOperation, activityLogStatusSucceeded, subscriptionScope, fakeRoleID, "u2")
+	require.Equal(t, []string{"e2"}, listPass())
+	require.Empty(t, listPass())
+	require.Equal(t, 3, f.requestCount("Microsoft.Insights"))
+}
+
+type fakeEventSource struct{}
+
+func (f *fakeEventSource) name() string {
+	return "fake"
+}
+
+func (f *fakeEventSource) listEvents(_ context.Context, _ time.Time, _ string, _ int) ([]*v2.Event, string, time.Time, error) {
+	return nil, "", time.Time{}, nil
+}
+
+func TestEventFeedCursorStartPass(t *testing.T) {
+	start := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	sources := []eventSource{&fakeEventSource{}}
+
+	cursor := &eventFeedCursor{}
+	cursor.startPass(sources, start)
+	require.Equal(t, start, cursor.Sources["fake"].Since)
+
+	// A source that is still paging keeps its state.
+	cursor.Sources["fake"].NextLink = "next"
+	cursor.startPass(sources, start)
+	require.Equal(t, "next", cursor.Sources["fake"].NextLink)
+
+	// Once done, the next pass starts eventIngestionLag before the newest entry seen.
+	latest := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	seen := map[string]time.Time{"e1": latest}
+	cursor.Sources["fake"] = &eventSourceCursor{Since: start, Latest: latest, Done: true, Seen: seen}
+	cursor.Sources["removed"] = &eventSourceCursor{Since: start}
+	cursor.startPass(sources, start)
+	require.Equal(t, &eventSourceCursor{Since: latest.Add(-eventIngestionLag), Latest: latest, Seen: seen}, cursor.Sources["fake"])
+	require.NotContains(t, cursor.Sources, "removed")
+}
+
+func TestEventSourceCursorRecord(t *testing.T) {
+	latest := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	event := func(id string, at time.Time) *v2.Event {
+		return &v2.Event{Id: id, OccurredAt: timestamppb.New(at)}
+	}
+
+	sc := &eventSourceCursor{}
+	events := sc.record([]*v2.Event{event("e1", latest.Add(-time.Hour)), event("e2", latest)}, latest)
+	require.Len(t, events, 2)
+	require.Equal(t, latest, sc.Latest)
+	// e1 is too old to be read again.
+	require.Equal(t, map[string]time.Time{"e2": latest}, sc.Seen)
+
+	events = sc.record([]*v2.Event{event("e2", latest), event("e3", latest.Add(-time.Minute))}, time.Time{})
+	require.Equal(t, []string{"e3"}, []string{events[0].Id})
+	require.Equal(t, latest, sc.Latest)
+}
+
+func TestActivityLogRoleAssignment(t *testing.T) {
+	entry := &activityLogEvent{
+		Properties: map[string]string{
+			"requestbody": `{"Id":"a1","Properties":{"PrincipalId":"p1","RoleDefinitionId":"/subscriptions/s1/providers/Microsoft.Authorization/roleDefinitions/r1","Scope":"/subscriptions/s1"}}`,
+		},
+	}
+
+	body := activityLogRoleAssignment(entry)
+	require.NotNil(t, body)
+	require.Equal(t, "p1", body.Properties.PrincipalID)
+	require.Equal(t, "/subscriptions/s1/providers/Microsoft.Authorization/roleDefinitions/r1", body.Properties.RoleDefinitionID)
+
+	require.Nil(t, activityLogRoleAssignment(&activityLogEvent{}))
+}
@@ -0,0 +1,1128 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	fakeTenantID      = "00000000-0000-0000-0000-00000000000a"
+	fakeAuthorization = "/providers/microsoft.authorization/"
+)
+
+// fakeAzure is an in-process stand-in for the Microsoft Graph and Azure Resource Manager endpoints the connector
+// calls. It keeps a small tenant in memory, pages every list through nextLinks and can answer requests with 429 to
+// exercise the retry paths. Graph is served under /v1.0 and /beta, everything else is ARM.
+type fakeAzure struct {
+	server   *httptest.Server
+	pageSize int
+
+	mu sync.Mutex
+	// objects holds users, groups and service principals by ID, objectIDs keeps their order.
+	objects   map[string]map[string]any
+	objectIDs []string
+	// relations holds the member and owner IDs of groups and service principals, keyed by relation and object ID.
+	relations          map[string]map[string][]string
+	mailboxSettings    map[string]string
+	appRoleAssignments map[string][]map[string]any
+	applicationLogos   map[string][]byte
+	subscriptions      []string
+	subscriptionNames  map[string]string
+	resourceGroups     map[string][]string
+	managementGroups   map[string][]string
+	roleDefinitions    []map[string]any
+	roleAssignments    []map[string]any
+	eligibleRoles      []map[string]any
+	spSignInActivities []map[string]any
+	directoryAudits    []map[string]any
+	signIns            []map[string]any
+	activityLogs       map[string][]map[string]any
+	// resourceGraphRows holds the rows Resource Graph returns, keyed by KQL query.
+	resourceGraphRows map[string][]map[string]any
+	// unlicensed makes sign-in activity fail like it does in tenants without Entra ID P1 or P2.
+	unlicensed bool
+	// noAuditLogRead makes sign-in activity and the audit logs fail like they do for an app without
+	// AuditLog.Read.All.
+	noAuditLogRead bool
+	// readOnlyARM makes role assignment and role definition writes fail like they do for the Reader role.
+	readOnlyARM bool
+	// changes records every change to users, groups and group members in order. A delta token holds the number of
+	// changes it has seen and the generation it was issued in, tokens of earlier generations answer 410 Gone.
+	changes         []fakeChange
+	deltaGeneration int
+	throttled       map[string]int
+	requests        []string
+}
+
+type fakeChange struct {
+	objectID  string
+	odataType string
+	// memberID is set when a member was added to or removed from the group objectID.
+	memberID string
+	removed  bool
+}
+
+func newFakeAzure(t *testing.T) *fakeAzure {
+	f := &fakeAzure{
+		pageSize: 2,
+		objects:  make(map[string]map[string]any),
+		relations: map[string]map[string][]string{
+			"members": {},
+			"owners":  {},
+		},
+		mailboxSettings:    make(map[string]string),
+		appRoleAssignments: make(map[string][]map[string]any),
+		applicationLogos:   make(map[string][]byte),
+		subscriptionNames:  make(map[string]string),
+		resourceGroups:     make(map[string][]string),
+		managementGroups:   make(map[string][]string),
+		resourceGraphRows:  make(map[string][]map[string]any),
+		activityLogs:       make(map[string][]map[string]any),
+		throttled:          make(map[string]int),
+	}
+	f.server = httptest.NewTLSServer(f)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// connector returns a connector that sends every request to the fake.
+func (f *fakeAzure) connector(t *testing.T, opts ...Option) *Connector {
+	// The uhttp response cache would hide changes made by Grant and Revoke.
+	t.Setenv("BATON_DISABLE_HTTP_CACHE", "true")
+
+	opts = append([]Option{
+		WithBaseURLs(f.server.URL, f.server.URL),
+		WithMaxRetries(2),
+	}, opts...)
+	c, err := NewConnectorFromToken(context.Background(), f.server.Client(), staticToken{}, false, false, opts...)
+	require.NoError(t, err)
+
+	return c
+}
+
+func (f *fakeAzure) addObject(id string, object map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object["id"] = id
+	f.objects[id] = object
+	f.objectIDs = append(f.objectIDs, id)
+	f.recordChange(id, "", false)
+}
+
+// removeObject deletes a user, group or service principal.
+func (f *fakeAzure) removeObject(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recordChange(id, "", true)
+	delete(f.objects, id)
+	f.objectIDs = slices.DeleteFunc(f.objectIDs, func(objectID string) bool { return objectID == id })
+}
+
+// updateObject sets a property of a user, group or service principal.
+func (f *fakeAzure) updateObject(id, key string, value any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[id][key] = value
+	f.recordChange(id, "", false)
+}
+
+// recordChange appends to the change log read by delta queries. The caller holds f.mu.
+func (f *fakeAzure) recordChange(objectID, memberID string, removed bool) {
+	odataType, _ := f.objects[objectID]["@odata.type"].(string)
+	if memberID != "" {
+		odataType = odataTypeGroup
+	}
+	f.changes = append(f.changes, fakeChange{objectID: objectID, odataType: odataType, memberID: memberID, removed: removed})
+}
+
+// expireDeltaLinks makes every delta link issued so far answer 410 Gone.
+func (f *fakeAzure) expireDeltaLinks() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deltaGeneration++
+}
+
+func (f *fakeAzure) addUser(id, displayName string) {
+	f.addObject(id, map[string]any{
+		"@odata.type":       odataTypeUser,
+		"displayName":       displayName,
+		"userPrincipalName": id + "@example.com",
+		"mail":              id + "@example.com",
+		"accountEnabled":    true,
+	})
+}
+
+func (f *fakeAzure) addGroup(id, displayName string) {
+	f.addObject(id, map[string]any{
+		"@odata.type":     odataTypeGroup,
+		"displayName":     displayName,
+		"securityEnabled": true,
+	})
+}
+
+func (f *fakeAzure) addServicePrincipal(id, servicePrincipalType string, appRoles ...map[string]any) {
+	f.addObject(id, map[string]any{
+		"@odata.type":            odataTypeServicePrincipal,
+		"appId":                  "app-" + id,
+		"displayName":            id,
+		"servicePrincipalType":   servicePrincipalType,
+		"appOwnerOrganizationId": fakeTenantID,
+		"accountEnabled":         true,
+		"appRoles":               appRoles,
+	})
+}
+
+func (f *fakeAzure) addRelation(relation, objectID, relatedID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.relations[relation][objectID] = append(f.relations[relation][objectID], relatedID)
+	if relation == typeMembers {
+		f.recordChange(objectID, relatedID, false)
+	}
+}
+
+func (f *fakeAzure) removeRelation(relation, objectID, relatedID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.relations[relation][objectID] = slices.DeleteFunc(f.relations[relation][objectID], func(id string) bool { return id == relatedID })
+	if relation == typeMembers {
+		f.recordChange(objectID, relatedID, true)
+	}
+}
+
+func (f *fakeAzure) relation(relation, objectID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.relations[relation][objectID])
+}
+
+func (f *fakeAzure) addAppRoleAssignment(servicePrincipalID, principalID, appRoleID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.appRoleAssignments[servicePrincipalID] = append(f.appRoleAssignments[servicePrincipalID], f.newAppRoleAssignment(servicePrincipalID, principalID, appRoleID))
+}
+
+func (f *fakeAzure) newAppRoleAssignment(servicePrincipalID, principalID, appRoleID string) map[string]any {
+	principalType := "User"
+	if principal, ok := f.objects[principalID]; ok && principal["@odata.type"] == odataTypeGroup {
+		principalType = "Group"
+	}
+
+	return map[string]any{
+		"id":            fmt.Sprintf("%s-%s-%s", servicePrincipalID, principalID, appRoleID),
+		"appRoleId":     appRoleID,
+		"principalId":   principalID,
+		"principalType": principalType,
+		"resourceId":    servicePrincipalID,
+	}
+}
+
+func (f *fakeAzure) addSubscription(id string, resourceGroups ...string) {
+	f.addNamedSubscription(id, "Subscription "+id, resourceGroups...)
+}
+
+func (f *fakeAzure) addNamedSubscription(id, displayName string, resourceGroups ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscriptions = append(f.subscriptions, id)
+	f.subscriptionNames[id] = displayName
+	f.resourceGroups[id] = resourceGroups
+}
+
+// addManagementGroup places the subscriptions below the management group.
+func (f *fakeAzure) addManagementGroup(id string, subscriptionIDs ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.managementGroups[strings.ToLower(id)] = subscriptionIDs
+}
+
+func (f *fakeAzure) addRoleDefinition(subscriptionID, name, roleName string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.roleDefinitions = append(f.roleDefinitions, map[string]any{
+		"id":   fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", subscriptionID, name),
+		"name": name,
+		"type": "Microsoft.Authorization/roleDefinitions",
+		"properties": map[string]any{
+			"roleName": roleName,
+			"type":     "BuiltInRole",
+		},
+	})
+}
+
+func (f *fakeAzure) addRoleAssignment(scope, name, roleDefinitionName, principalID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.roleAssignments = append(f.roleAssignments, newFakeRoleAssignment(scope, name, roleDefinitionName, principalID))
+}
+
+func newFakeRoleAssignment(scope, name, roleDefinitionName, principalID string) map[string]any {
+	subscriptionID := strings.Split(strings.Trim(scope, "/"), "/")[1]
+	return map[string]any{
+		"id":   scope + "/providers/Microsoft.Authorization/roleAssignments/" + name,
+		"name": name,
+		"type": "Microsoft.Authorization/roleAssignments",
+		"properties": map[string]any{
+			"scope":            scope,
+			"principalId":      principalID,
+			"roleDefinitionId": fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", subscriptionID, roleDefinitionName),
+		},
+	}
+}
+
+// addEligibleRoleAssignment makes principalID eligible for a role definition at scope.
+func (f *fakeAzure) addEligibleRoleAssignment(scope, roleDefinitionName, principalID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.eligibleRoles = append(f.eligibleRoles, newFakeRoleAssignment(scope, fmt.Sprintf("eligible%d", len(f.eligibleRoles)), roleDefinitionName, principalID))
+}
+
+// addApplicationLogo sets the logo of the application registration with the given app ID.
+func (f *fakeAzure) addApplicationLogo(appID string, logo []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.applicationLogos[appID] = logo
+}
+
+// addServicePrincipalSignInActivity records the last sign-in of the application with appID.
+func (f *fakeAzure) addServicePrincipalSignInActivity(appID string, lastSignIn time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.spSignInActivities = append(f.spSignInActivities, map[string]any{
+		"id":                 appID,
+		"appId":              appID,
+		"lastSignInActivity": map[string]any{"lastSignInDateTime": lastSignIn.Format(time.RFC3339)},
+	})
+}
+
+// roleAssignmentsOf returns the principal IDs assigned a role definition at exactly scope.
+func (f *fakeAzure) roleAssignmentsOf(scope, roleDefinitionName string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rv []string
+	for _, assignment := range f.roleAssignments {
+		properties := assignment["properties"].(map[string]any)
+		if strings.EqualFold(properties["scope"].(string), scope) &&
+			strings.EqualFold(path.Base(properties["roleDefinitionId"].(string)), roleDefinitionName) {
+			rv = append(rv, properties["principalId"].(string))
+		}
+	}
+
+	return rv
+}
+
+// throttle answers the next n requests whose path contains fragment with 429 Too Many Requests.
+func (f *fakeAzure) throttle(fragment string, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.throttled[fragment] = n
+}
+
+// requestCount returns how many requests, including batched ones, had a path containing fragment.
+func (f *fakeAzure) requestCount(fragment string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if strings.Contains(r, fragment) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.route(w, r)
+}
+
+func (f *fakeAzure) route(w http.ResponseWriter, r *http.Request) {
+	// The ARM SDK joins scopes that start with a slash onto the endpoint, which doubles the slash.
+	p := path.Clean(r.URL.Path)
+	f.requests = append(f.requests, r.Method+" "+p)
+
+	for fragment, n := range f.throttled {
+		if n > 0 && strings.Contains(p, fragment) {
+			f.throttled[fragment] = n - 1
+			w.Header().Set("X-Ms-Retry-After-Ms", "1")
+			writeFakeError(w, http.StatusTooManyRequests, "TooManyRequests", "throttled")
+			return
+		}
+	}
+
+	for _, version := range []string{apiVersion, betaVersion} {
+		if rest, ok := strings.CutPrefix(p, "/"+version+"/"); ok {
+			f.serveGraph(w, r, version, strings.Split(rest, "/"))
+			return
+		}
+	}
+
+	f.serveARM(w, r, p)
+}
+
+func (f *fakeAzure) serveGraph(w http.ResponseWriter, r *http.Request, version string, segments []string) {
+	route := func(method string, pattern ...string) bool {
+		if r.Method != method || len(segments) != len(pattern) {
+			return false
+		}
+		for i, s := range pattern {
+			if s != "*" && s != segments[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case route(http.MethodGet, "organization"):
+		writeFakeJSON(w, http.StatusOK, map[string]any{"value": []map[string]any{{"id": fakeTenantID}}})
+	case route(http.MethodPost, "$batch"):
+		f.serveBatch(w, r, version)
+	case route(http.MethodGet, "reports", "servicePrincipalSignInActivities"):
+		if f.refuseAuditLogs(w) {
+			return
+		}
+		items := make([]any, 0, len(f.spSignInActivities))
+		for _, activity := range f.spSignInActivities {
+			items = append(items, activity)
+		}
+		f.writePage(w, r, items, "@odata.nextLink")
+	case route(http.MethodGet, "auditLogs", "signIns"):
+		if f.refuseAuditLogs(w) {
+			return
+		}
+		f.serveLog(w, r, f.signIns, "createdDateTime")
+	case route(http.MethodGet, "auditLogs", "directoryAudits"):
+		if f.noAuditLogRead {
+			writeFakePermissionError(w)
+			return
+		}
+		f.serveLog(w, r, f.directoryAudits, "activityDateTime")
+	case route(http.MethodGet, "directoryObjects", "*"):
+		f.serveObject(w, segments[1], "")
+	case r.Method == http.MethodGet && len(segments) == 2 && strings.HasPrefix(segments[0], "applications(appId=") && segments[1] == "logo":
+		appID := strings.TrimSuffix(strings.TrimPrefix(segments[0], "applications(appId='"), "')")
+		logo, ok := f.applicationLogos[appID]
+		switch {
+		case r.Header.Get("Authorization") == "":
+			writeFakeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "Access token is empty.")
+		case !ok:
+			writeFakeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("no logo for %s", appID))
+		default:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(logo)
+		}
+	case route(http.MethodGet, "users", "delta"):
+		f.serveDelta(w, r, odataTypeUser)
+	case route(http.MethodGet, "groups", "delta"):
+		f.serveDelta(w, r, odataTypeGroup)
+	case route(http.MethodGet, "users"):
+		users := f.objectsOfType(odataTypeUser)
+		if strings.Contains(r.URL.Query().Get("$select"), "signInActivity") {
+			if f.refuseAuditLogs(w) {
+				return
+			}
+		} else {
+			// signInActivity is only returned when selected.
+			for i, object := range users {
+				users[i] = maps.Clone(object)
+				delete(users[i], "signInActivity")
+			}
+		}
+		f.serveObjects(w, r, users)
+	case route(http.MethodGet, "users", "*", "mailboxSettings"):
+		if _, ok := f.objects[segments[1]]; !ok {
+			writeFakeError(w, http.StatusNotFound, "Request_ResourceNotFound", "user not found")
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]any{"userPurpose": f.mailboxSettings[segments[1]]})
+	case route(http.MethodGet, "groups"):
+		f.serveObjects(w, r, f.objectsOfType(odataTypeGroup))
+	case route(http.MethodPost, "groups"):
+		f.createGroup(w, r)
+	case route(http.MethodDelete, "groups", "*"):
+		f.deleteObject(w, segments[1], odataTypeGroup)
+	case route(http.MethodGet, "servicePrincipals"):
+		f.serveServicePrincipals(w, r)
+	case route(http.MethodGet, "groups", "*", "*"), route(http.MethodGet, "servicePrincipals", "*", "owners"):
+		if segments[2] == "appRoleAssignedTo" {
+			writeFakeJSON(w, http.StatusOK, map[string]any{"value": f.appRoleAssignments[segments[1]]})
+			return
+		}
+		f.serveRelation(w, r, segments[2], segments[1])
+	case route(http.MethodPost, "groups", "*", "*", "$ref"), route(http.MethodPost, "servicePrincipals", "*", "owners", "$ref"):
+		f.addReference(w, r, segments[2], segments[1])
+	case route(http.MethodDelete, "groups", "*", "*", "*", "$ref"), route(http.MethodDelete, "servicePrincipals", "*", "owners", "*", "$ref"):
+		f.removeReference(w, segments[2], segments[1], segments[3])
+	case route(http.MethodGet, "servicePrincipals", "*", "appRoleAssignedTo"):
+		writeFakeJSON(w, http.StatusOK, map[string]any{"value": f.appRoleAssignments[segments[1]]})
+	case route(http.MethodPost, "servicePrincipals", "*", "appRoleAssignedTo"):
+		f.createAppRoleAssignment(w, r, segments[1])
+	case route(http.MethodDelete, "servicePrincipals", "*", "appRoleAssignedTo", "*"):
+		f.deleteAppRoleAssignment(w, segments[1], segments[3])
+	default:
+		writeFakeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("no fake for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// serveBatch runs every request of a JSON batch against the fake and collects the responses.
+func (f *fakeAzure) serveBatch(w http.ResponseWriter, r *http.Request, version string) {
+	reqs := &graphBatchRequests{}
+	if err := json.NewDecoder(r.Body).Decode(reqs); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	resp := &graphBatchResponses{}
+	for _, req := range reqs.Requests {
+		rec := httptest.NewRecorder()
+		batched := httptest.NewRequest(req.Method, "/"+version+req.URL, nil)
+		for key, value := range req.Headers {
+			batched.Header.Set(key, value)
+		}
+		f.route(rec, batched)
+
+		headers := make(map[string]string)
+		for key := range rec.Header() {
+			headers[key] = rec.Header().Get(key)
+		}
+		resp.Responses = append(resp.Responses, &graphBatchResponse{
+			ID:      req.ID,
+			Status:  rec.Code,
+			Headers: headers,
+			Body:    rec.Body.Bytes(),
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, resp)
+}
+
+func (f *fakeAzure) objectsOfType(odataType string) []map[string]any {
+	var rv []map[string]any
+	for _, id := range f.objectIDs {
+		if object := f.objects[id]; object["@odata.type"] == odataType {
+			rv = append(rv, object)
+		}
+	}
+
+	return rv
+}
+
+func (f *fakeAzure) serveObject(w http.ResponseWriter, id, odataType string) {
+	object, ok := f.objects[id]
+	if !ok || (odataType != "" && object["@odata.type"] != odataType) {
+		writeFakeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist", id))
+		return
+	}
+
+	writeFakeJSON(w, http.StatusOK, object)
+}
+
+// serveObjects writes a page of the objects that match the request's $filter. Like Graph, it refuses filters using
+// "ne" unless they are sent as advanced queries.
+func (f *fakeAzure) serveObjects(w http.ResponseWriter, r *http.Request, objects []map[string]any) {
+	filter := r.URL.Query().Get("$filter")
+	if strings.Contains(filter, " ne ") && (r.URL.Query().Get("$count") != "true" || r.Header.Get("ConsistencyLevel") != "eventual") {
+		writeFakeError(w, http.StatusBadRequest, "Request_UnsupportedQuery", "Unsupported Query.")
+		return
+	}
+
+	var items []any
+	for _, object := range objects {
+		ok, err := matchFakeFilter(object, filter)
+		if err != nil {
+			writeFakeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		if ok {
+			items = append(items, object)
+		}
+	}
+
+	f.writePage(w, r, items, "@odata.nextLink")
+}
+
+// serveDelta answers users/delta and groups/delta. Without a delta token it returns every object, with one it returns
+// the objects changed since, or the member changes of groups when members are selected. The last page carries a
+// delta link for the current point in time.
+func (f *fakeAzure) serveDelta(w http.ResponseWriter, r *http.Request, odataType string) {
+	q := r.URL.Query()
+	withMembers := strings.Contains(q.Get("$select"), typeMembers)
+	since := len(f.changes)
+	switch token := q.Get("$deltatoken"); token {
+	case "":
+		since = -1
+	case "latest":
+	default:
+		generation, seen, _ := strings.Cut(token, ".")
+		if generation != strconv.Itoa(f.deltaGeneration) {
+			writeFakeError(w, http.StatusGone, "SyncStateNotFound", "The delta token has expired.")
+			return
+		}
+		since, _ = strconv.Atoi(seen)
+	}
+
+	var items []any
+	if since < 0 {
+		for _, object := range f.objectsOfType(odataType) {
+			items = append(items, object)
+		}
+	} else {
+		changed := make(map[string]map[string]any)
+		for _, change := range f.changes[since:] {
+			if change.odataType != odataType || (change.memberID != "") != withMembers {
+				continue
+			}
+
+			item, ok := changed[change.objectID]
+			if !ok {
+				item = map[string]any{"id": change.objectID}
+				changed[change.objectID] = item
+				items = append(items, item)
+			}
+			switch {
+			case change.memberID != "":
+				member := map[string]any{"@odata.type": f.objects[change.memberID]["@odata.type"], "id": change.memberID}
+				if change.removed {
+					member["@removed"] = map[string]any{"reason": "deleted"}
+				}
+				members, _ := item["members@delta"].([]any)
+				item["members@delta"] = append(members, member)
+			case change.removed:
+				item["@removed"] = map[string]any{"reason": "changed"}
+			default:
+				maps.Copy(item, f.objects[change.objectID])
+				delete(item, "@removed")
+			}
+		}
+	}
+
+	resp := f.page(r, items, "@odata.nextLink")
+	if _, ok := resp["@odata.nextLink"]; !ok {
+		q.Del("$skiptoken")
+		q.Set("$deltatoken", fmt.Sprintf("%d.%d", f.deltaGeneration, len(f.changes)))
+		deltaLink, _ := url.Parse(f.server.URL)
+		deltaLink.Path = r.URL.Path
+		deltaLink.RawQuery = q.Encode()
+		resp["@odata.deltaLink"] = deltaLink.String()
+	}
+
+	writeFakeJSON(w, http.StatusOK, resp)
+}
+
+var fakeLogFilter = regexp.MustCompile(`^(\w+) (gt|ge) (\S+)`)
+
+// serveLog writes a page of the log entries newer than the time in the $filter, which must start with a gt or ge
+// comparison of timeKey.
+func (f *fakeAzure) serveLog(w http.ResponseWriter, r *http.Request, entries []map[string]any, timeKey string) {
+	m := fakeLogFilter.FindStringSubmatch(r.URL.Query().Get("$filter"))
+	if m == nil || m[1] != timeKey {
+		writeFakeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("unsupported filter %q", r.URL.Query().Get("$filter")))
+		return
+	}
+	since, err := time.Parse(time.RFC3339Nano, m[3])
+	if err != nil {
+		writeFakeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	var items []any
+	for _, entry := range entries {
+		at, _ := time.Parse(time.RFC3339Nano, entry[timeKey].(string))
+		if at.After(since) || (m[2] == "ge" && at.Equal(since)) {
+			items = append(items, entry)
+		}
+	}
+
+	f.writePage(w, r, items, "@odata.nextLink")
+}
+
+// addActivityLogRoleAssignment records a role assignment write or delete in the subscription's Activity Log. The
+// role assignment is logged the way requests are, without its scope.
+func (f *fakeAzure) addActivityLogRoleAssignment(subscriptionID, id, operation, status, scope, roleID, principalID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	assignmentID := scope + "/providers/Microsoft.Authorization/roleAssignments/" + id
+	body, _ := json.Marshal(map[string]any{
+		"id": assignmentID,
+		"properties": map[string]any{
+			"roleDefinitionId": fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", subscriptionID, roleID),
+			"principalId":      principalID,
+		},
+	})
+	f.activityLogs[strings.ToLower(subscriptionID)] = append(f.activityLogs[strings.ToLower(subscriptionID)], map[string]any{
+		"eventDataId":    id,
+		"operationName":  map[string]any{"value": operation},
+		"status":         map[string]any{"value": status},
+		"eventTimestamp": time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).Format(time.RFC3339Nano),
+		"resourceId":     assignmentID,
+		"subscriptionId": subscriptionID,
+		"properties":     map[string]any{activityLogRequestBodyKey: string(body)},
+	})
+}
+
+// addSignIn records a successful sign-in of the user to the application with appID.
+func (f *fakeAzure) addSignIn(id string, at time.Time, userID, appID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.signIns = append(f.signIns, map[string]any{
+		"id":              id,
+		"createdDateTime": at.Format(time.RFC3339Nano),
+		"userId":          userID,
+		"userDisplayName": "User " + userID,
+		"appId":           appID,
+		"appDisplayName":  appID,
+	})
+}
+
+// addDirectoryAudit records a successful "Add member to group" audit.
+func (f *fakeAzure) addDirectoryAudit(id string, at time.Time, groupID, userID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.directoryAudits = append(f.directoryAudits, map[string]any{
+		"id":                  id,
+		"activityDateTime":    at.Format(time.RFC3339Nano),
+		"activityDisplayName": auditAddGroupMember,
+		"result":              auditResultSuccess,
+		"targetResources": []map[string]any{
+			{
+				"id":   userID,
+				"type": "User",
+				"modifiedProperties": []map[string]any{
+					{"displayName": "Group.ObjectID", "oldValue": nil, "newValue": fmt.Sprintf("%q", groupID)},
+				},
+			},
+			{"id": groupID, "type": "Group"},
+		},
+	})
+}
+
+func (f *fakeAzure) serveServicePrincipals(w http.ResponseWriter, r *http.Request) {
+	objects := f.objectsOfType(odataTypeServicePrincipal)
+	if strings.Contains(r.URL.Query().Get("$expand"), "appRoleAssignedTo") {
+		expanded := make([]map[string]any, 0, len(objects))
+		for _, object := range objects {
+			withAssignments := make(map[string]any, len(object)+1)
+			for key, value := range object {
+				withAssignments[key] = value
+			}
+			withAssignments["appRoleAssignedTo"] = f.appRoleAssignments[object["id"].(string)]
+			expanded = append(expanded, withAssignments)
+		}
+		objects = expanded
+	}
+
+	f.serveObjects(w, r, objects)
+}
+
+func (f *fakeAzure) serveRelation(w http.ResponseWriter, r *http.Request, relation, objectID string) {
+	if _, ok := f.objects[objectID]; !ok {
+		writeFakeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist", objectID))
+		return
+	}
+	if _, ok := f.relations[relation]; !ok {
+		writeFakeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("unsupported relation %s", relation))
+		return
+	}
+
+	var related []map[string]any
+	for _, id := range f.relations[relation][objectID] {
+		related = append(related, f.objects[id])
+	}
+	f.serveObjects(w, r, related)
+}
+
+func (f *fakeAzure) addReference(w http.ResponseWriter, r *http.Request, relation, objectID string) {
+	ref := &assignment{}
+	if err := json.NewDecoder(r.Body).Decode(ref); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	relatedID := path.Base(ref.ObjectRef)
+	if _, ok := f.objects[relatedID]; !ok {
+		writeFakeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist", relatedID))
+		return
+	}
+	if slices.Contains(f.relations[relation][objectID], relatedID) {
+		writeFakeError(w, http.StatusBadRequest, "Request_BadRequest",
+			fmt.Sprintf("One or more added object references already exist for the following modified properties: '%s'.", relation))
+		return
+	}
+
+	f.relations[relation][objectID] = append(f.relations[relation][objectID], relatedID)
+	if relation == typeMembers {
+		f.recordChange(objectID, relatedID, false)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeAzure) removeReference(w http.ResponseWriter, relation, objectID, relatedID string) {
+	related := f.relations[relation][objectID]
+	i := slices.Index(related, relatedID)
+	if i < 0 {
+		writeFakeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist", relatedID))
+		return
+	}
+
+	f.relations[relation][objectID] = slices.Delete(related, i, i+1)
+	if relation == typeMembers {
+		f.recordChange(objectID, relatedID, true)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeAzure) createGroup(w http.ResponseWriter, r *http.Request) {
+	req := map[string]any{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	id := fmt.Sprintf("group-%d", len(f.objectIDs)+1)
+	req["@odata.type"] = odataTypeGroup
+	req["id"] = id
+	delete(req, "owners@odata.bind")
+	f.objects[id] = req
+	f.objectIDs = append(f.objectIDs, id)
+	f.recordChange(id, "", false)
+	writeFakeJSON(w, http.StatusCreated, req)
+}
+
+func (f *fakeAzure) deleteObject(w http.ResponseWriter, id, odataType string) {
+	object, ok := f.objects[id]
+	if !ok || object["@odata.type"] != odataType {
+		writeFakeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist", id))
+		return
+	}
+
+	f.recordChange(id, "", true)
+	delete(f.objects, id)
+	f.objectIDs = slices.DeleteFunc(f.objectIDs, func(objectID string) bool { return objectID == id })
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeAzure) createAppRoleAssignment(w http.ResponseWriter, r *http.Request, servicePrincipalID string) {
+	req := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	created := f.newAppRoleAssignment(servicePrincipalID, req["principalId"], req["appRoleId"])
+	f.appRoleAssignments[servicePrincipalID] = append(f.appRoleAssignments[servicePrincipalID], created)
+	writeFakeJSON(w, http.StatusCreated, created)
+}
+
+func (f *fakeAzure) deleteAppRoleAssignment(w http.ResponseWriter, servicePrincipalID, assignmentID string) {
+	assignments := f.appRoleAssignments[servicePrincipalID]
+	i := slices.IndexFunc(assignments, func(a map[string]any) bool { return a["id"] == assignmentID })
+	if i < 0 {
+		writeFakeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist", assignmentID))
+		return
+	}
+
+	f.appRoleAssignments[servicePrincipalID] = slices.Delete(assignments, i, i+1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeAzure) serveARM(w http.ResponseWriter, r *http.Request, p string) {
+	lower := strings.ToLower(p)
+	scope, provider, _ := strings.Cut(lower, fakeAuthorization)
+	segments := strings.Split(strings.Trim(lower, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && lower == "/subscriptions":
+		var items []any
+		for _, id := range f.subscriptions {
+			items = append(items, map[string]any{
+				"id":             "/subscriptions/" + id,
+				"subscriptionId": id,
+				"displayName":    f.subscriptionNames[id],
+				"state":          "Enabled",
+			})
+		}
+		f.writePage(w, r, items, "nextLink")
+	case r.Method == http.MethodGet && len(segments) == 7 && segments[0] == "subscriptions" && segments[3] == "microsoft.insights":
+		var items []any
+		for _, entry := range f.activityLogs[segments[1]] {
+			items = append(items, entry)
+		}
+		f.writePage(w, r, items, "nextLink")
+	case r.Method == http.MethodGet && lower == "/tenants":
+		f.writePage(w, r, []any{map[string]any{"id": "/tenants/" + fakeTenantID, "tenantId": fakeTenantID}}, "nextLink")
+	case r.Method == http.MethodGet && len(segments) == 3 && segments[0] == "subscriptions" && segments[2] == "resourcegroups":
+		var items []any
+		for _, name := range f.resourceGroups[segments[1]] {
+			items = append(items, map[string]any{
+				"id":       fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", segments[1], name),
+				"name":     name,
+				"location": "eastus",
+			})
+		}
+		f.writePage(w, r, items, "nextLink")
+	case r.Method == http.MethodGet && len(segments) == 5 && segments[1] == "microsoft.management" && segments[4] == "descendants":
+		var items []any
+		for _, id := range f.managementGroups[segments[3]] {
+			items = append(items, map[string]any{
+				"id":   "/subscriptions/" + id,
+				"name": id,
+				"type": "Microsoft.Management/managementGroups/subscriptions",
+			})
+		}
+		f.writePage(w, r, items, "nextLink")
+	case r.Method == http.MethodPost && lower == "/providers/microsoft.resourcegraph/resources":
+		f.serveResourceGraph(w, r)
+	case provider != "":
+		f.serveAuthorization(w, r, p[:len(scope)], provider)
+	default:
+		writeFakeError(w, http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("no fake for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// serveResourceGraph answers a Resource Graph query with a page of the rows registered for it. The $skipToken is
+// the offset of the next row.
+func (f *fakeAzure) serveResourceGraph(w http.ResponseWriter, r *http.Request) {
+	req := &resourceGraphRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	rows, ok := f.resourceGraphRows[req.Query]
+	if !ok {
+		writeFakeError(w, http.StatusBadRequest, "InvalidQuery", fmt.Sprintf("no fake rows for query %q", req.Query))
+		return
+	}
+
+	offset := 0
+	if req.Options != nil {
+		offset, _ = strconv.Atoi(req.Options.SkipToken)
+	}
+	end := min(offset+f.pageSize, len(rows))
+	offset = min(offset, end)
+	resp := map[string]any{
+		"totalRecords": len(rows),
+		"count":        end - offset,
+		"data":         rows[offset:end],
+	}
+	if end < len(rows) {
+		resp["$skipToken"] = strconv.Itoa(end)
+	}
+
+	writeFakeJSON(w, http.StatusOK, resp)
+}
+
+// serveAuthorization serves the Microsoft.Authorization provider below scope.
+func (f *fakeAzure) serveAuthorization(w http.ResponseWriter, r *http.Request, scope, provider string) {
+	kind, name, _ := strings.Cut(provider, "/")
+	switch {
+	case kind == "permissions" && r.Method == http.MethodGet:
+		f.writePage(w, r, []any{map[string]any{"actions": []string{"*"}, "notActions": []string{}}}, "nextLink")
+	case kind == "roledefinitions" && name == "" && r.Method == http.MethodGet:
+		var items []any
+		for _, definition := range f.roleDefinitions {
+			if strings.HasPrefix(strings.ToLower(definition["id"].(string)), strings.ToLower(scope)+"/") {
+				items = append(items, definition)
+			}
+		}
+		f.writePage(w, r, items, "nextLink")
+	case kind == "roledefinitions" && r.Method == http.MethodGet:
+		i := slices.IndexFunc(f.roleDefinitions, func(d map[string]any) bool { return strings.EqualFold(d["name"].(string), name) })
+		if i < 0 {
+			writeFakeError(w, http.StatusNotFound, "RoleDefinitionDoesNotExist", "The specified role definition does not exist.")
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, f.roleDefinitions[i])
+	case f.readOnlyARM && (kind == "roledefinitions" || kind == "roleassignments") && r.Method != http.MethodGet:
+		writeFakeError(w, http.StatusForbidden, "AuthorizationFailed", "The client does not have authorization to perform action.")
+	case kind == "roledefinitions" && r.Method == http.MethodPut:
+		definition := map[string]any{}
+		if err := json.NewDecoder(r.Body).Decode(&definition); err != nil {
+			writeFakeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		definition["id"] = scope + "/providers/Microsoft.Authorization/roleDefinitions/" + name
+		definition["name"] = name
+		f.roleDefinitions = append(f.roleDefinitions, definition)
+		writeFakeJSON(w, http.StatusCreated, definition)
+	case kind == "roledefinitions" && r.Method == http.MethodDelete:
+		i := slices.IndexFunc(f.roleDefinitions, func(d map[string]any) bool { return strings.EqualFold(d["name"].(string), name) })
+		if i < 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		deleted := f.roleDefinitions[i]
+		f.roleDefinitions = slices.Delete(f.roleDefinitions, i, i+1)
+		writeFakeJSON(w, http.StatusOK, deleted)
+	case kind == "roleassignments" && name == "" && r.Method == http.MethodGet:
+		var items []any
+		for _, assignment := range f.roleAssignments {
+			assignmentScope := strings.ToLower(assignment["properties"].(map[string]any)["scope"].(string))
+			if assignmentScope == strings.ToLower(scope) || strings.HasPrefix(assignmentScope, strings.ToLower(scope)+"/") {
+				items = append(items, assignment)
+			}
+		}
+		f.writePage(w, r, items, "nextLink")
+	case kind == "roleeligibilityscheduleinstances" && r.Method == http.MethodGet:
+		var items []any
+		for _, instance := range f.eligibleRoles {
+			instanceScope := strings.ToLower(instance["properties"].(map[string]any)["scope"].(string))
+			if instanceScope == strings.ToLower(scope) || strings.HasPrefix(instanceScope, strings.ToLower(scope)+"/") {
+				items = append(items, instance)
+			}
+		}
+		f.writePage(w, r, items, "nextLink")
+	case kind == "roleassignments" && r.Method == http.MethodPut:
+		req := &struct {
+			Properties struct {
+				PrincipalID      string `json:"principalId"`
+				RoleDefinitionID string `json:"roleDefinitionId"`
+			} `json:"properties"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			writeFakeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		for _, assignment := range f.roleAssignments {
+			properties := assignment["properties"].(map[string]any)
+			if strings.EqualFold(properties["scope"].(string), scope) &&
+				properties["principalId"] == req.Properties.PrincipalID &&
+				strings.EqualFold(properties["roleDefinitionId"].(string), req.Properties.RoleDefinitionID) {
+				writeFakeError(w, http.StatusConflict, "RoleAssignmentExists", "The role assignment already exists.")
+				return
+			}
+		}
+		created := newFakeRoleAssignment(scope, name, path.Base(req.Properties.RoleDefinitionID), req.Properties.PrincipalID)
+		f.roleAssignments = append(f.roleAssignments, created)
+		writeFakeJSON(w, http.StatusCreated, created)
+	case kind == "roleassignments" && r.Method == http.MethodDelete:
+		i := slices.IndexFunc(f.roleAssignments, func(a map[string]any) bool { return strings.EqualFold(a["name"].(string), name) })
+		if i < 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		deleted := f.roleAssignments[i]
+		f.roleAssignments = slices.Delete(f.roleAssignments, i, i+1)
+		writeFakeJSON(w, http.StatusOK, deleted)
+	default:
+		writeFakeError(w, http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("no fake for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// writePage writes up to pageSize items, or $top if that is smaller, starting at the $skiptoken offset. A nextLink
+// for the following page is added under nextLinkKey as long as items are left.
+func (f *fakeAzure) writePage(w http.ResponseWriter, r *http.Request, items []any, nextLinkKey string) {
+	writeFakeJSON(w, http.StatusOK, f.page(r, items, nextLinkKey))
+}
+
+func (f *fakeAzure) page(r *http.Request, items []any, nextLinkKey string) map[string]any {
+	q := r.URL.Query()
+	offset, _ := strconv.Atoi(q.Get("$skiptoken"))
+	limit := f.pageSize
+	if top, err := strconv.Atoi(q.Get("$top")); err == nil && top < limit {
+		limit = top
+	}
+
+	end := min(offset+limit, len(items))
+	offset = min(offset, end)
+	resp := map[string]any{"value": append([]any{}, items[offset:end]...)}
+	if end < len(items) {
+		q.Set("$skiptoken", strconv.Itoa(end))
+		next, _ := url.Parse(f.server.URL)
+		next.Path = r.URL.Path
+		next.RawQuery = q.Encode()
+		resp[nextLinkKey] = next.String()
+	}
+
+	return resp
+}
+
+var fakeFilterClause = regexp.MustCompile(`^(\w+) (eq|ne) (?:'([^']*)'|(true|false))$`)
+
+// matchFakeFilter evaluates the OData filters the connector sends: clauses comparing a property to a string or a
+// boolean, joined with "and".
+func matchFakeFilter(object map[string]any, filter string) (bool, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return true, nil
+	}
+
+	for _, clause := range regexp.MustCompile(`(?i)\s+and\s+`).Split(filter, -1) {
+		clause = strings.Trim(strings.TrimSpace(clause), "()")
+		m := fakeFilterClause.FindStringSubmatch(clause)
+		if m == nil {
+			return false, fmt.Errorf("unsupported filter %q", clause)
+		}
+
+		var want any = m[3]
+		if m[4] != "" {
+			want = m[4] == "true"
+		}
+		got, ok := object[m[1]]
+		if !ok {
+			if _, isBool := want.(bool); isBool {
+				got = false
+			}
+		}
+		if (got == want) != (m[2] == "eq") {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeFakeLicenseError(w http.ResponseWriter) {
+	writeFakeError(w, http.StatusForbidden, "Authentication_RequestFromNonPremiumTenantOrB2CTenant",
+		"Neither tenant is B2C or tenant doesn't have premium license")
+}
+
+// refuseAuditLogs answers a request for sign-in data with the error of an unlicensed tenant or of an app without
+// AuditLog.Read.All, and reports whether it did.
+func (f *fakeAzure) refuseAuditLogs(w http.ResponseWriter) bool {
+	switch {
+	case f.unlicensed:
+		writeFakeLicenseError(w)
+	case f.noAuditLogRead:
+		writeFakePermissionError(w)
+	default:
+		return false
+	}
+	return true
+}
+
+func writeFakePermissionError(w http.ResponseWriter) {
+	writeFakeError(w, http.StatusForbidden, "Authorization_RequestDenied",
+		"Insufficient privileges to complete the operation.")
+}
+
+func writeFakeError(w http.ResponseWriter, status int, code, message string) {
+	writeFakeJSON(w, status, map[string]any{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
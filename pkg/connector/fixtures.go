@@ -0,0 +1,448 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// fixtureOptions select whether the connector's Graph and ARM traffic is recorded to, or replayed from, a
+// directory of fixtures. At most one of them is set.
+type fixtureOptions struct {
+	recordDir string
+	replayDir string
+}
+
+// WithRecording writes every Microsoft Graph and Azure Resource Manager request the connector sends, along with
+// its response, to fixture files in dir. Tokens and personal data are redacted and IDs are pseudonymized before
+// anything is written.
+// Credentials don't use the recorded client, so token requests are never written.
+func WithRecording(dir string) Option {
+	return func(c *Connector) error {
+		c.fixtures.recordDir = dir
+		return nil
+	}
+}
+
+// WithReplay answers the connector's Microsoft Graph and Azure Resource Manager requests from fixtures written by
+// WithRecording instead of the network. New doesn't request tokens while replaying, so no credentials are needed.
+func WithReplay(dir string) Option {
+	return func(c *Connector) error {
+		c.fixtures.replayDir = dir
+		return nil
+	}
+}
+
+func (f fixtureOptions) replaying() bool {
+	return f.replayDir != ""
+}
+
+// client returns httpClient with its transport wrapped for recording or replaying, or httpClient itself if neither
+// is configured.
+func (f fixtureOptions) client(httpClient *http.Client) (*http.Client, error) {
+	var transport http.RoundTripper
+	switch {
+	case f.recordDir != "" && f.replayDir != "":
+		return nil, errors.New("baton-azure-infrastructure: recording and replaying fixtures are mutually exclusive")
+	case f.recordDir != "":
+		next := httpClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		transport = &recordingTransport{dir: f.recordDir, next: next, fixtures: make(map[string]*fixture)}
+	case f.replayDir != "":
+		transport = &replayTransport{dir: f.replayDir, served: make(map[string]int)}
+	default:
+		return httpClient, nil
+	}
+
+	rv := *httpClient
+	rv.Transport = transport
+	return &rv, nil
+}
+
+// fixture holds every response recorded for one request, in the order they were received.
+type fixture struct {
+	Method     string             `json:"method"`
+	URL        string             `json:"url"`
+	Body       json.RawMessage    `json:"body,omitempty"`
+	BodyBase64 []byte             `json:"bodyBase64,omitempty"`
+	Responses  []*fixtureResponse `json:"responses"`
+}
+
+type fixtureResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       json.RawMessage   `json:"body,omitempty"`
+	// BodyBase64 holds a body that isn't JSON, e.g. an application logo.
+	BodyBase64 []byte `json:"bodyBase64,omitempty"`
+}
+
+// fixtureBody is a redacted request or response body. JSON bodies are kept readable, anything else is base64
+// encoded by encoding/json.
+type fixtureBody struct {
+	data   []byte
+	isJSON bool
+}
+
+func (b fixtureBody) json() json.RawMessage {
+	if !b.isJSON {
+		return nil
+	}
+	return b.data
+}
+
+func (b fixtureBody) base64() []byte {
+	if b.isJSON {
+		return nil
+	}
+	return b.data
+}
+
+// fixtureHeaders are the only response headers kept in fixtures, everything else may identify the tenant.
+var fixtureHeaders = []string{
+	"Content-Type",
+	"Location",
+	"Retry-After",
+	retryAfterMsHeader,
+	"Retry-After-Ms",
+}
+
+// redactedProperties are the Graph and ARM properties that hold personal data. Their values are replaced with
+// stable pseudonyms, so the same value is redacted the same way in every fixture and lookups still line up.
+var redactedProperties = map[string]bool{
+	"businessPhones":              true,
+	"city":                        true,
+	"companyName":                 true,
+	"country":                     true,
+	"department":                  true,
+	"displayName":                 true,
+	"employeeId":                  true,
+	"faxNumber":                   true,
+	"givenName":                   true,
+	"imAddresses":                 true,
+	"jobTitle":                    true,
+	"mail":                        true,
+	"mailNickname":                true,
+	"mobilePhone":                 true,
+	"officeLocation":              true,
+	"onPremisesDistinguishedName": true,
+	"onPremisesSamAccountName":    true,
+	"onPremisesUserPrincipalName": true,
+	"otherMails":                  true,
+	"postalCode":                  true,
+	"proxyAddresses":              true,
+	"state":                       true,
+	"streetAddress":               true,
+	"surname":                     true,
+	"userPrincipalName":           true,
+}
+
+var (
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// guidPattern matches object, tenant, subscription and application IDs, on their own or inside ARM IDs and URLs.
+	guidPattern = regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	// filterLiteralPattern matches the quoted string literals of an OData $filter.
+	filterLiteralPattern = regexp.MustCompile(`'(?:[^']|'')*'`)
+)
+
+// pseudonymIDPrefix starts every pseudonymized ID, so IDs that are already pseudonyms are left alone.
+const (
+	pseudonymIDPrefix = "00000000-0000-4000-8000-"
+	pseudonymPrefix   = "redacted-"
+)
+
+// wellKnownIDs are the same in every tenant and the connector compares IDs with them, so they aren't pseudonymized.
+var wellKnownIDs = []string{
+	defaultAppRoleAssignmentID,
+	microsoftBuiltinAppsOwnerID,
+}
+
+// fixtureKey identifies a request by its method, redacted URL and redacted body. It is also the fixture's file name.
+func fixtureKey(method, rawURL string, body fixtureBody) string {
+	sum := sha256.Sum256([]byte(method + " " + rawURL + "\n" + string(body.data)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// readRequestBody reads and restores the body of req, and returns it redacted.
+func readRequestBody(req *http.Request) (fixtureBody, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return fixtureBody{}, nil
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return fixtureBody{}, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+
+	return redactBody(data), nil
+}
+
+// redactBody returns data with personal data, IDs and tokens redacted. Only tokens are redacted from bodies that
+// aren't JSON.
+func redactBody(data []byte) fixtureBody {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return fixtureBody{isJSON: true}
+	}
+
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fixtureBody{data: jwtPattern.ReplaceAll(data, []byte("redacted-token"))}
+	}
+
+	// Marshaling sorts object keys, which keeps the body stable for fixtureKey.
+	rv, err := json.Marshal(redactJSON(v, false))
+	if err != nil {
+		return fixtureBody{}
+	}
+
+	return fixtureBody{data: rv, isJSON: true}
+}
+
+// redactJSON pseudonymizes the values of redactedProperties and the IDs and URLs anywhere in v, and replaces tokens.
+// Every string in v is pseudonymized when redact is set.
+func redactJSON(v any, redact bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = redactJSON(value, redact || redactedProperties[key])
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = redactJSON(value, redact)
+		}
+		return v
+	case string:
+		if redact {
+			return pseudonym(v)
+		}
+		return redactString(v)
+	default:
+		return v
+	}
+}
+
+// redactString replaces tokens and IDs in s. URLs are redacted with redactURL.
+func redactString(s string) string {
+	s = jwtPattern.ReplaceAllString(s, "redacted-token")
+	if strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://") {
+		return redactURL(s)
+	}
+
+	return guidPattern.ReplaceAllStringFunc(s, pseudonymID)
+}
+
+// redactURL pseudonymizes the IDs in rawURL and the string literals of its $filter. Redacting a URL twice gives
+// the same URL, so requests built from replayed responses still find their fixtures.
+func redactURL(rawURL string) string {
+	rawURL = guidPattern.ReplaceAllStringFunc(rawURL, pseudonymID)
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	filter := q.Get("$filter")
+	if filter == "" {
+		return rawURL
+	}
+
+	q.Set("$filter", filterLiteralPattern.ReplaceAllStringFunc(filter, func(literal string) string {
+		value := strings.ReplaceAll(literal[1:len(literal)-1], "''", "'")
+		if guidPattern.FindString(value) == value {
+			return literal
+		}
+		return "'" + pseudonym(value) + "'"
+	}))
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// pseudonymID replaces the ID id with a stable ID derived from it.
+func pseudonymID(id string) string {
+	lower := strings.ToLower(id)
+	if strings.HasPrefix(lower, pseudonymIDPrefix) || slices.Contains(wellKnownIDs, lower) {
+		return id
+	}
+
+	sum := sha256.Sum256([]byte(lower))
+	return pseudonymIDPrefix + hex.EncodeToString(sum[:6])
+}
+
+// pseudonym replaces s with a stable value derived from it. Email addresses stay email addresses, and pseudonyms
+// are returned as is.
+func pseudonym(s string) string {
+	if s == "" || strings.HasPrefix(s, pseudonymPrefix) {
+		return s
+	}
+
+	sum := sha256.Sum256([]byte(s))
+	rv := pseudonymPrefix + hex.EncodeToString(sum[:4])
+	if strings.Contains(s, "@") {
+		rv += "@example.invalid"
+	}
+
+	return rv
+}
+
+// recordingTransport sends requests on to next and writes them, with their responses, to fixtures in dir.
+type recordingTransport struct {
+	dir  string
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	fixtures map[string]*fixture
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	recorded := &fixtureResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    make(map[string]string),
+	}
+	for _, header := range fixtureHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			recorded.Headers[header] = redactString(value)
+		}
+	}
+	body := redactBody(data)
+	recorded.Body = body.json()
+	recorded.BodyBase64 = body.base64()
+
+	err = t.record(req.Method, redactURL(req.URL.String()), reqBody, recorded)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (t *recordingTransport) record(method, rawURL string, reqBody fixtureBody, resp *fixtureResponse) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := fixtureKey(method, rawURL, reqBody)
+	f, ok := t.fixtures[key]
+	if !ok {
+		f = &fixture{Method: method, URL: rawURL, Body: reqBody.json(), BodyBase64: reqBody.base64()}
+		t.fixtures[key] = f
+	}
+	f.Responses = append(f.Responses, resp)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(t.dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("baton-azure-infrastructure: failed to create fixture directory: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(t.dir, key+".json"), data, 0o600)
+}
+
+// replayTransport answers requests from the fixtures in dir. Repeated requests get the recorded responses in
+// order, and the last one once those run out.
+type replayTransport struct {
+	dir string
+
+	mu     sync.Mutex
+	served map[string]int
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fixtureKey(req.Method, redactURL(req.URL.String()), reqBody)
+	data, err := os.ReadFile(filepath.Join(t.dir, key+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("baton-azure-infrastructure: no fixture recorded for %s %s", req.Method, req.URL)
+		}
+		return nil, err
+	}
+
+	f := &fixture{}
+	err = json.Unmarshal(data, f)
+	if err != nil {
+		return nil, fmt.Errorf("baton-azure-infrastructure: invalid fixture %s: %w", key, err)
+	}
+	if len(f.Responses) == 0 {
+		return nil, fmt.Errorf("baton-azure-infrastructure: fixture %s has no responses", key)
+	}
+
+	t.mu.Lock()
+	n := t.served[key]
+	t.served[key] = n + 1
+	t.mu.Unlock()
+
+	recorded := f.Responses[min(n, len(f.Responses)-1)]
+	body := []byte(recorded.Body)
+	if recorded.BodyBase64 != nil {
+		body = recorded.BodyBase64
+	}
+
+	header := make(http.Header)
+	for key, value := range recorded.Headers {
+		header.Set(key, value)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// replayToken is the credential used while replaying, fixtures don't depend on the token.
+type replayToken struct{}
+
+func (replayToken) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "replay"}, nil
+}
@@ -0,0 +1,124 @@
+package connector
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f := newFakeTenant(t)
+	// Three members on pages of two: the first page comes with a nextLink that groupBuilder.Grants drops because
+	// it holds 50 members or fewer.
+	f.addRelation("members", "g1", "u5")
+	// Object IDs are pseudonymized, and the pseudonyms lead back to the recorded requests.
+	const groupID = "6f1d2c3b-4a59-4e68-8f7a-9b0c1d2e3f40"
+	f.addGroup(groupID, "Group with a GUID")
+	f.addRelation("members", groupID, "u4")
+	f.throttle("/users", 1)
+	baseURL := f.server.URL
+
+	sync := func(c *Connector) ([]string, []string, []string) {
+		users := listAll(t, newUserBuilder(c), nil)
+		groups := listAll(t, newGroupBuilder(c), nil)
+		var grants []string
+		for _, group := range groups {
+			grants = append(grants, grantPrincipals(grantsAll(t, newGroupBuilder(c), group))...)
+		}
+		return resourceIDs(users), resourceIDs(groups), grants
+	}
+
+	recordedUsers, recordedGroups, recordedGrants := sync(f.connector(t, WithRecording(dir)))
+	require.Contains(t, recordedGroups, groupID)
+	f.server.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.NotContains(t, string(data), "@example.com")
+		require.NotContains(t, string(data), "User u1")
+		require.NotContains(t, string(data), "Bearer")
+		require.NotContains(t, string(data), groupID)
+	}
+
+	c, err := New(ctx, false, "", "", "", false, false, WithBaseURLs(baseURL, baseURL), WithReplay(dir), WithMaxRetries(2))
+	require.NoError(t, err)
+	replayedUsers, replayedGroups, replayedGrants := sync(c)
+	require.Equal(t, recordedUsers, replayedUsers)
+	require.ElementsMatch(t, []string{"g1", pseudonymID(groupID)}, replayedGroups)
+	require.ElementsMatch(t, recordedGrants, replayedGrants)
+
+	_, _, _, err = newGroupBuilder(c).Grants(ctx, &v2.Resource{
+		Id: &v2.ResourceId{ResourceType: groupResourceType.Id, Resource: "g2"},
+	}, &pagination.Token{})
+	require.ErrorContains(t, err, "no fixture recorded")
+
+	_, err = newConnector(ctx, f.server.Client(), false, false, WithRecording(dir), WithReplay(dir))
+	require.Error(t, err)
+}
+
+func TestRedactBody(t *testing.T) {
+	const objectID = "6F1D2C3B-4A59-4E68-8F7A-9B0C1D2E3F40"
+	redacted := redactBody([]byte(`{"value":[{"id":"` + objectID + `","mail":"a@contoso.com","otherMails":["a@contoso.com"],` +
+		`"userPurpose":"shared","token":"eyJhbGciOiJub25lIn0.eyJzdWIiOiIxIn0.sig",` +
+		`"scope":"/subscriptions/` + strings.ToLower(objectID) + `/resourceGroups/rg"}]}`))
+	require.True(t, redacted.isJSON)
+	body := string(redacted.json())
+	require.NotContains(t, body, "contoso")
+	require.NotContains(t, body, "eyJ")
+	require.NotContains(t, strings.ToLower(body), strings.ToLower(objectID))
+	require.Contains(t, body, `"userPurpose":"shared"`)
+	require.Equal(t, 2, strings.Count(body, pseudonym("a@contoso.com")))
+	require.Equal(t, 2, strings.Count(body, pseudonymID(objectID)), "IDs are pseudonymized the same way whatever their case")
+	require.True(t, strings.HasSuffix(pseudonym("a@contoso.com"), "@example.invalid"))
+	require.Equal(t, body, string(redactBody([]byte(body)).json()), "redacting twice changes nothing")
+
+	redacted = redactBody([]byte("not json"))
+	require.False(t, redacted.isJSON)
+	require.Nil(t, redacted.json())
+	require.Equal(t, "not json", string(redacted.base64()))
+}
+
+func TestRedactURL(t *testing.T) {
+	const objectID = "6f1d2c3b-4a59-4e68-8f7a-9b0c1d2e3f40"
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "object id in path",
+			url:  "https://graph.microsoft.com/v1.0/groups/" + objectID + "/members",
+			want: "https://graph.microsoft.com/v1.0/groups/" + pseudonymID(objectID) + "/members",
+		},
+		{
+			name: "filter values",
+			url:  "https://graph.microsoft.com/v1.0/users?%24filter=mail+eq+%27a%40contoso.com%27+or+id+eq+%27" + objectID + "%27",
+			want: "https://graph.microsoft.com/v1.0/users?%24filter=mail+eq+%27" + url.QueryEscape(pseudonym("a@contoso.com")) +
+				"%27+or+id+eq+%27" + pseudonymID(objectID) + "%27",
+		},
+		{
+			name: "well-known id",
+			url:  "https://graph.microsoft.com/v1.0/servicePrincipals?%24filter=appOwnerOrganizationId+eq+" + microsoftBuiltinAppsOwnerID,
+			want: "https://graph.microsoft.com/v1.0/servicePrincipals?%24filter=appOwnerOrganizationId+eq+" + microsoftBuiltinAppsOwnerID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, redactURL(tt.url))
+			require.Equal(t, tt.want, redactURL(redactURL(tt.url)))
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// graphFilters are OData $filter expressions narrowing down the users, groups and service principals the connector
+// syncs. An empty expression doesn't filter.
+type graphFilters struct {
+	users             string
+	groups            string
+	servicePrincipals string
+}
+
+// WithUserFilter only syncs the users matching the OData $filter expression, e.g.
+// "accountEnabled eq true and userType eq 'Member'".
+func WithUserFilter(filter string) Option {
+	return func(c *Connector) error {
+		c.graphFilters.users = strings.TrimSpace(filter)
+		return nil
+	}
+}
+
+// WithGroupFilter only syncs the groups matching the OData $filter expression. It is combined with the filter
+// set by skipping Active Directory groups.
+func WithGroupFilter(filter string) Option {
+	return func(c *Connector) error {
+		c.graphFilters.groups = strings.TrimSpace(filter)
+		return nil
+	}
+}
+
+// WithServicePrincipalFilter only syncs the enterprise applications and managed identities matching the OData
+// $filter expression.
+func WithServicePrincipalFilter(filter string) Option {
+	return func(c *Connector) error {
+		c.graphFilters.servicePrincipals = strings.TrimSpace(filter)
+		return nil
+	}
+}
+
+// addGraphFilter adds filter to the $filter of v, joining it with "and" to a filter that is already set. A custom
+// filter may use operators Graph only accepts in advanced queries, which need $count=true, so it is always set.
+// The ConsistencyLevel header they need as well is sent with every Graph request.
+// https://learn.microsoft.com/en-us/graph/aad-advanced-queries
+func addGraphFilter(v url.Values, filter string) {
+	if filter == "" {
+		return
+	}
+
+	if existing := v.Get("$filter"); existing != "" {
+		filter = fmt.Sprintf("(%s) and (%s)", existing, filter)
+	}
+	v.Set("$filter", filter)
+	v.Set("$count", "true") // Required to prevent MS Graph from returning a 400
+}
+
+// validateGraphFilters sends every configured filter to Graph in a single batch, so that a filter Graph refuses
+// fails at startup rather than in the middle of a sync.
+func (d *Connector) validateGraphFilters(ctx context.Context) error {
+	type probe struct {
+		name   string
+		path   string
+		filter string
+		item   *graphBatchItem
+	}
+
+	var (
+		probes []*probe
+		items  []*graphBatchItem
+	)
+	for _, p := range []*probe{
+		{name: "user", path: "users", filter: d.graphFilters.users},
+		{name: "group", path: "groups", filter: d.graphFilters.groups},
+		{name: "service principal", path: "servicePrincipals", filter: d.graphFilters.servicePrincipals},
+	} {
+		if p.filter == "" {
+			continue
+		}
+
+		v := url.Values{"$top": {"1"}, "$select": {"id"}}
+		addGraphFilter(v, p.filter)
+		p.item = &graphBatchItem{URL: d.buildURL(p.path, v)}
+		probes = append(probes, p)
+		items = append(items, p.item)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	err := d.batchGet(ctx, items)
+	if err != nil {
+		return fmt.Errorf("baton-azure-infrastructure: failed to validate filters: %w", err)
+	}
+	for _, p := range probes {
+		if p.item.Err != nil {
+			return fmt.Errorf("baton-azure-infrastructure: invalid %s filter %q: %w", p.name, p.filter, p.item.Err)
+		}
+	}
+
+	return nil
+}
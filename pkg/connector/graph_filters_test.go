@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphFilters(t *testing.T) {
+	f := newFakeTenant(t)
+	f.addGroup("g2", "Group 2")
+	f.objects["u2"]["userType"] = "Guest"
+	f.objects["u3"]["accountEnabled"] = false
+	c := f.connector(t,
+		WithUserFilter("accountEnabled eq true and userType ne 'Guest'"),
+		WithGroupFilter("displayName eq 'Group 2'"),
+		WithServicePrincipalFilter("displayName ne 'mi1'"),
+	)
+	// All three filters are probed in a single batch.
+	require.Equal(t, 1, f.requestCount("$batch"))
+
+	require.Equal(t, []string{"u1", "u4", "u5"}, resourceIDs(listAll(t, newUserBuilder(c), nil)))
+	require.Equal(t, []string{"g2"}, resourceIDs(listAll(t, newGroupBuilder(c), nil)))
+	require.Equal(t, []string{"app1"}, resourceIDs(listAll(t, newEnterpriseApplicationsBuilder(c), nil)))
+	require.Empty(t, listAll(t, newManagedIdentityBuilder(c), nil))
+
+	_, err := NewConnectorFromToken(context.Background(), f.server.Client(), staticToken{}, false, false,
+		WithBaseURLs(f.server.URL, f.server.URL), WithGroupFilter("startswith(displayName, 'Group')"))
+	require.ErrorContains(t, err, "invalid group filter")
+}
+
+func TestAddGraphFilter(t *testing.T) {
+	for _, tc := range []struct {
+		existing string
+		filter   string
+		want     string
+		count    bool
+	}{
+		{filter: "", want: ""},
+		{existing: "securityEnabled eq true", want: "securityEnabled eq true"},
+		{filter: "accountEnabled eq true", want: "accountEnabled eq true", count: true},
+		{filter: "userType ne 'Guest'", want: "userType ne 'Guest'", count: true},
+		{filter: "NOT(startswith(displayName, 'x'))", want: "NOT(startswith(displayName, 'x'))", count: true},
+		{filter: "endsWith(mail, '@contoso.com')", want: "endsWith(mail, '@contoso.com')", count: true},
+		{filter: "owners/$count eq 0", want: "owners/$count eq 0", count: true},
+		{filter: "displayName eq 'Connect'", want: "displayName eq 'Connect'", count: true},
+		{
+			existing: "servicePrincipalType eq 'Application'",
+			filter:   "tags/any(t: t eq 'prod')",
+			want:     "(servicePrincipalType eq 'Application') and (tags/any(t: t eq 'prod'))",
+			count:    true,
+		},
+	} {
+		v := url.Values{}
+		if tc.existing != "" {
+			v.Set("$filter", tc.existing)
+		}
+		addGraphFilter(v, tc.filter)
+		require.Equal(t, tc.want, v.Get("$filter"), tc.filter)
+		require.Equal(t, tc.count, v.Get("$count") == "true", tc.filter)
+	}
+}
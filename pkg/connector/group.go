@@ -14,8 +14,10 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	zap "go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type groupBuilder struct {
@@ -46,25 +48,46 @@ func (g *groupBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId
 		return nil, "", nil, err
 	}
 
+	delta := g.conn.listsGroupsThroughDelta()
 	reqURL := bag.PageToken()
 	if reqURL == "" {
 		v := setGroupKeys()
-		if g.conn.SkipAdGroups {
-			v.Set("$filter", "(onPremisesSyncEnabled ne true)")
-			v.Set("$count", "true") // Required to prevent MS Graph from returning a 400
+		if delta {
+			reqURL = g.conn.deltaListURL("groups", v)
+		} else {
+			if g.conn.SkipAdGroups {
+				v.Set("$filter", "(onPremisesSyncEnabled ne true)")
+				v.Set("$count", "true") // Required to prevent MS Graph from returning a 400
+			}
+			addGraphFilter(v, g.conn.graphFilters.groups)
+			reqURL = g.conn.buildURL("groups", v)
 		}
-
-		reqURL = g.conn.buildURL("groups", v)
 	}
 
 	resp := &groupsList{}
-	err = g.conn.query(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+	if delta {
+		err = g.conn.queryUncached(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+	} else {
+		err = g.conn.query(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+	}
 	if err != nil {
 		return nil, "", nil, err
 	}
 
+	// Delta queries don't support the filter above, so synced groups are dropped here.
+	if delta && g.conn.SkipAdGroups {
+		cloudGroups := resp.Groups[:0]
+		for _, gr := range resp.Groups {
+			if !gr.OnPremisesSyncEnabled {
+				cloudGroups = append(cloudGroups, gr)
+			}
+		}
+		resp.Groups = cloudGroups
+	}
+
+	cloud := g.conn.azureCloud()
 	groups, err := slices.ConvertErr(resp.Groups, func(g *group) (*v2.Resource, error) {
-		return groupResource(ctx, g, parentResourceID)
+		return groupResource(ctx, cloud, g, parentResourceID)
 	})
 	if err != nil {
 		return nil, "", nil, err
@@ -116,7 +139,19 @@ func (g *groupBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 	// https://learn.microsoft.com/en-us/graph/api/group-list-members?view=graph-rest-1.0&tabs=http
 	//
 	// NOTE #2: This applies to both the members and owners endpoints.
+	var (
+		annos       annotations.Annotations
+		deltaGrants []*v2.Grant
+	)
 	if b.Current() == nil {
+		reuseMembers := false
+		if g.conn.deltaSync {
+			reuseMembers, deltaGrants, err = g.applyMembershipDelta(ctx, resource, &annos)
+			if err != nil {
+				return nil, "", nil, err
+			}
+		}
+
 		owenrsQuery := url.Values{}
 		owenrsQuery.Set("$select", strings.Join([]string{"id"}, ","))
 		ownersURL := g.conn.buildBetaURL(path.Join("groups", resource.Id.Resource, "owners"), owenrsQuery)
@@ -125,17 +160,19 @@ func (g *groupBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 			Token:          ownersURL,
 		})
 
-		memberQuery := setMemberQuery()
-		if g.conn.SkipAdGroups {
-			memberQuery.Set("$filter", "(onPremisesSyncEnabled ne true)")
-			memberQuery.Set("$count", "true") // Required to prevent MS Graph from returning a 400
+		if !reuseMembers {
+			memberQuery := setMemberQuery()
+			if g.conn.SkipAdGroups {
+				memberQuery.Set("$filter", "(onPremisesSyncEnabled ne true)")
+				memberQuery.Set("$count", "true") // Required to prevent MS Graph from returning a 400
+			}
+
+			membersURL := g.conn.buildBetaURL(path.Join("groups", resource.Id.Resource, "members"), memberQuery)
+			b.Push(pagination.PageState{
+				ResourceTypeID: typeMembers,
+				Token:          membersURL,
+			})
 		}
-
-		membersURL := g.conn.buildBetaURL(path.Join("groups", resource.Id.Resource, "members"), memberQuery)
-		b.Push(pagination.PageState{
-			ResourceTypeID: typeMembers,
-			Token:          membersURL,
-		})
 	}
 
 	ps := b.Current()
@@ -173,7 +210,49 @@ func (g *groupBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 		return nil, "", nil, err
 	}
 
-	return grants, pageToken, nil, nil
+	return append(deltaGrants, grants...), pageToken, annos, nil
+}
+
+// applyMembershipDelta asks the SDK to reuse the previous sync's members when Graph reports that they only changed
+// in ways we can apply, and returns grants for the members added since. Otherwise the members are listed again and
+// the group is stamped with this sync's delta link. It returns whether the members listing can be skipped.
+func (g *groupBuilder) applyMembershipDelta(ctx context.Context, resource *v2.Resource, annos *annotations.Annotations) (bool, []*v2.Grant, error) {
+	membersEntitlementID := groupMembersEntitlementID(resource.Id.Resource)
+	prevETag, err := previousGroupETag(resource)
+	if err != nil {
+		return false, nil, err
+	}
+
+	prevLink := ""
+	if prevETag != nil && prevETag.EntitlementId == membersEntitlementID {
+		prevLink = prevETag.Value
+	}
+
+	delta := g.conn.groupMembershipChanges(ctx, prevLink)
+	if delta.valid {
+		change := delta.changed[resource.Id.Resource]
+		switch {
+		case change == nil:
+			annos.Update(&v2.ETagMatch{EntitlementId: membersEntitlementID})
+			return true, nil, nil
+		case !change.needsRelist:
+			grants, err := getGroupGrants(ctx, &membershipList{Members: change.added}, resource, g, &pagination.PageState{ResourceTypeID: typeMembers})
+			if err != nil {
+				return false, nil, err
+			}
+			annos.Update(&v2.ETagMatch{EntitlementId: membersEntitlementID})
+			return true, grants, nil
+		}
+	}
+
+	if delta.nextLink != "" {
+		annos.Update(&v2.ETag{
+			Value:         delta.nextLink,
+			EntitlementId: membersEntitlementID,
+		})
+	}
+
+	return false, nil, nil
 }
 
 func (g *groupBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
@@ -201,16 +280,12 @@ func (g *groupBuilder) Grant(ctx context.Context, principal *v2.Resource, entitl
 		return nil, errors.New("baton-azure-infrastructure: only members can provision membership or owners entitlements to a group")
 	}
 
-	objRef := getGroupGrantURL(principal)
+	objRef := getGroupGrantURL(g.conn.azureCloud(), principal)
 	assign := &assignment{
 		ObjectRef: objRef,
 	}
-	body, err := assign.MarshalToReader()
-	if err != nil {
-		return nil, err
-	}
 
-	err = g.conn.query(ctx, graphReadScopes, http.MethodPost, reqURL, body, nil)
+	err := g.conn.query(ctx, graphReadScopes, http.MethodPost, reqURL, assign, nil)
 	if err != nil {
 		if strings.Contains(err.Error(), "added object references already exist") {
 			l.Info("Attempted to grant a group membership that already exists, treating as successful")
@@ -263,6 +338,126 @@ func (g *groupBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations
 	return nil, nil
 }
 
+// Create provisions a new security or Microsoft 365 group from the group trait profile.
+// https://learn.microsoft.com/en-us/graph/api/group-post-groups?view=graph-rest-1.0&tabs=http
+func (g *groupBuilder) Create(ctx context.Context, resource *v2.Resource) (*v2.Resource, annotations.Annotations, error) {
+	if resource.Id != nil && resource.Id.ResourceType != groupResourceType.Id {
+		return nil, nil, fmt.Errorf("baton-azure-infrastructure: cannot create resource of type %s as a group", resource.Id.ResourceType)
+	}
+
+	if IsEmpty(resource.DisplayName) {
+		return nil, nil, errors.New("baton-azure-infrastructure: group display name is required")
+	}
+
+	groupTrait, err := rs.GetGroupTrait(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reqBody, err := newGroupCreateRequest(g.conn.azureCloud(), resource, groupTrait.GetProfile())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	created := &group{}
+	reqURL := g.conn.buildURL("groups", nil)
+	err = g.conn.query(ctx, graphReadScopes, http.MethodPost, reqURL, reqBody, created)
+	if err != nil {
+		return nil, nil, fmt.Errorf("baton-azure-infrastructure: failed to create group %s: %w", resource.DisplayName, err)
+	}
+
+	rv, err := groupResource(ctx, g.conn.azureCloud(), created, resource.ParentResourceId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rv, nil, nil
+}
+
+// Delete removes the group. Entra ID keeps deleted groups in the recycle bin for 30 days,
+// so the group can still be restored from the portal.
+// https://learn.microsoft.com/en-us/graph/api/group-delete?view=graph-rest-1.0&tabs=http
+func (g *groupBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	if resourceId.ResourceType != groupResourceType.Id {
+		return nil, fmt.Errorf("baton-azure-infrastructure: cannot delete resource of type %s as a group", resourceId.ResourceType)
+	}
+
+	reqURL := g.conn.buildURL(path.Join("groups", resourceId.Resource), nil)
+	err := g.conn.query(ctx, graphReadScopes, http.MethodDelete, reqURL, nil, nil)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			l.Info("Group to delete not found; treating as successful because the end state is achieved",
+				zap.String("group_id", resourceId.Resource),
+			)
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func newGroupCreateRequest(cloud *azureCloud, resource *v2.Resource, profile *structpb.Struct) (*groupCreateRequest, error) {
+	req := &groupCreateRequest{
+		Description:        resource.Description,
+		DisplayName:        resource.DisplayName,
+		GroupTypes:         []string{},
+		IsAssignableToRole: getProfileBoolValue(profile, "is_assignable_to_role"),
+	}
+
+	if description, ok := rs.GetProfileStringValue(profile, "description"); ok && !IsEmpty(description) {
+		req.Description = description
+	}
+
+	groupType, _ := rs.GetProfileStringValue(profile, "group_type")
+	switch groupType {
+	case "microsoft_365":
+		req.GroupTypes = append(req.GroupTypes, "Unified")
+		req.MailEnabled = true
+		// Role assignable Microsoft 365 groups must also be security enabled.
+		req.SecurityEnabled = req.IsAssignableToRole
+	case "security", "":
+		req.SecurityEnabled = true
+	default:
+		return nil, fmt.Errorf("baton-azure-infrastructure: unsupported group type %q, only security and microsoft_365 groups can be created", groupType)
+	}
+
+	req.MailNickname, _ = rs.GetProfileStringValue(profile, "mail_nickname")
+	if IsEmpty(req.MailNickname) {
+		req.MailNickname = mailNicknameFromDisplayName(resource.DisplayName)
+	}
+	if IsEmpty(req.MailNickname) {
+		return nil, fmt.Errorf("baton-azure-infrastructure: unable to derive a mail nickname for group %s", resource.DisplayName)
+	}
+
+	for _, ownerID := range getProfileStringList(profile, "owners") {
+		req.Owners = append(req.Owners, cloud.directoryObjectURL(ownerID))
+	}
+
+	return req, nil
+}
+
+// mailNicknameFromDisplayName keeps only the characters Graph accepts in a mailNickname.
+// https://learn.microsoft.com/en-us/graph/api/resources/group?view=graph-rest-1.0#properties
+func mailNicknameFromDisplayName(displayName string) string {
+	const maxMailNicknameLength = 64
+	var sb strings.Builder
+	for _, r := range displayName {
+		if sb.Len() >= maxMailNicknameLength {
+			break
+		}
+
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			sb.WriteRune(r)
+		}
+	}
+
+	return strings.Trim(sb.String(), ".")
+}
+
 func newGroupBuilder(c *Connector) *groupBuilder {
 	return &groupBuilder{
 		conn: c,
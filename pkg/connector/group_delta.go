@@ -0,0 +1,200 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// Incremental group membership sync.
+//
+// Group membership is where large tenants spend most of their time: one or more members requests per group.
+//
+// When a group's members are listed, the group is stamped with a v2.ETag holding a groups/delta link, which the
+// SDK keeps in the sync's state. On the next sync the link is replayed once for the whole tenant, and the
+// members@delta it returns tell us which groups changed.
+//   - Unchanged groups answer with a v2.ETagMatch, and the SDK copies their members from the previous sync.
+//   - Groups that only gained users (or groups) get the previous members plus the additions.
+//   - Anything else (removals, service principals, an expired delta link) falls back to listing members, and
+//     the group is stamped with a new link.
+//
+// The SDK keeps the previous ETag on a match, so a group replays the link of the sync that last listed its
+// members until they are listed again. Replays never come from the HTTP cache, the same link is sent every sync.
+//
+// https://learn.microsoft.com/en-us/graph/api/group-delta?view=graph-rest-1.0
+// https://learn.microsoft.com/en-us/graph/delta-query-groups
+
+// groupDeltaState caches the result of replaying a delta link during one sync, keyed by the link that was
+// replayed. Groups keep the ETag of the sync that last listed their members, so a sync can replay a few
+// different links. The empty key holds the latest delta link for groups that have no previous ETag.
+type groupDeltaState struct {
+	mu      sync.Mutex
+	results map[string]*groupDeltaResult
+}
+
+type groupDeltaResult struct {
+	// valid is false when the previous delta link could not be replayed, e.g. because it expired.
+	valid bool
+	// nextLink is the delta link to stamp on the groups whose members this sync lists.
+	nextLink string
+	changed  map[string]*groupMembershipDelta
+}
+
+type groupMembershipDelta struct {
+	added []*membership
+	// needsRelist is set when the change can't be expressed on top of the previous members.
+	needsRelist bool
+}
+
+type groupDeltaItem struct {
+	ID           string                 `json:"id"`
+	MembersDelta []*membershipDelta     `json:"members@delta,omitempty"`
+	Removed      map[string]interface{} `json:"@removed,omitempty"`
+}
+
+type membershipDelta struct {
+	membership
+	Removed map[string]interface{} `json:"@removed,omitempty"`
+}
+
+type groupDeltaList struct {
+	NextLink  string            `json:"@odata.nextLink"`
+	DeltaLink string            `json:"@odata.deltaLink"`
+	Value     []*groupDeltaItem `json:"value"`
+}
+
+func newGroupDeltaState() *groupDeltaState {
+	return &groupDeltaState{
+		results: make(map[string]*groupDeltaResult),
+	}
+}
+
+func groupMembersEntitlementID(groupID string) string {
+	return fmt.Sprintf("group:%s:%s", groupID, typeMembers)
+}
+
+// groupMembershipChanges replays prevLink and returns the groups that changed since it was issued.
+func (d *Connector) groupMembershipChanges(ctx context.Context, prevLink string) *groupDeltaResult {
+	state, _ := d.groupDelta.get(ctx, func(context.Context) (*groupDeltaState, error) {
+		return newGroupDeltaState(), nil
+	})
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if result, ok := state.results[prevLink]; ok {
+		return result
+	}
+
+	l := ctxzap.Extract(ctx)
+	result := &groupDeltaResult{
+		changed: make(map[string]*groupMembershipDelta),
+	}
+	if prevLink != "" {
+		err := d.replayGroupDelta(ctx, prevLink, result)
+		if err != nil {
+			l.Warn(
+				"baton-azure-infrastructure: unable to replay group delta link, listing all group members",
+				zap.Error(err),
+			)
+			result.changed = make(map[string]*groupMembershipDelta)
+		} else {
+			result.valid = true
+		}
+	}
+
+	if result.nextLink == "" {
+		nextLink, err := d.latestGroupDeltaLink(ctx)
+		if err != nil {
+			l.Warn("baton-azure-infrastructure: unable to get group delta link", zap.Error(err))
+		}
+		result.nextLink = nextLink
+	}
+
+	state.results[prevLink] = result
+	return result
+}
+
+func (d *Connector) replayGroupDelta(ctx context.Context, reqURL string, result *groupDeltaResult) error {
+	for reqURL != "" {
+		resp := &groupDeltaList{}
+		err := d.queryUncached(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range resp.Value {
+			delta, ok := result.changed[item.ID]
+			if !ok {
+				delta = &groupMembershipDelta{}
+				result.changed[item.ID] = delta
+			}
+
+			if item.Removed != nil {
+				delta.needsRelist = true
+				continue
+			}
+
+			for _, md := range item.MembersDelta {
+				if md.Removed != nil || !d.canApplyMemberAddition(&md.membership) {
+					delta.needsRelist = true
+					continue
+				}
+
+				m := md.membership
+				delta.added = append(delta.added, &m)
+			}
+		}
+
+		reqURL = resp.NextLink
+		if resp.DeltaLink != "" {
+			result.nextLink = resp.DeltaLink
+		}
+	}
+
+	return nil
+}
+
+// canApplyMemberAddition reports whether a member from members@delta carries enough information to build a grant.
+// Delta results don't include servicePrincipalType or onPremisesSyncEnabled.
+func (d *Connector) canApplyMemberAddition(m *membership) bool {
+	switch m.Type {
+	case odataTypeUser:
+		return true
+	case odataTypeGroup:
+		return !d.SkipAdGroups
+	default:
+		return false
+	}
+}
+
+// latestGroupDeltaLink returns a delta link for the current point in time without enumerating any groups.
+func (d *Connector) latestGroupDeltaLink(ctx context.Context) (string, error) {
+	v := url.Values{}
+	v.Set("$select", typeMembers)
+	v.Set("$deltaToken", "latest")
+	resp := &groupDeltaList{}
+	err := d.queryUncached(ctx, graphReadScopes, http.MethodGet, d.buildURL("groups/delta", v), nil, resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.DeltaLink, nil
+}
+
+// previousGroupETag returns the delta link stored on the group by the previous sync.
+func previousGroupETag(resource *v2.Resource) (*v2.ETag, error) {
+	etag := &v2.ETag{}
+	annos := annotations.Annotations(resource.GetAnnotations())
+	ok, err := annos.Pick(etag)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return etag, nil
+}
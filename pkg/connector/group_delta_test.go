@@ -0,0 +1,195 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// syncGroupGrants lists the grants of a group the way the SDK does with delta sync: the ETag stored by the previous
+// sync is put on the resource. It returns the grants along with the annotations of the first page.
+func syncGroupGrants(t *testing.T, g *groupBuilder, group *v2.Resource, prevETag *v2.ETag) ([]*v2.Grant, annotations.Annotations) {
+	resource := proto.Clone(group).(*v2.Resource)
+	if prevETag != nil {
+		annos := annotations.Annotations(resource.Annotations)
+		annos.Update(prevETag)
+		resource.Annotations = annos
+	}
+
+	var (
+		rv    []*v2.Grant
+		first annotations.Annotations
+		token string
+	)
+	for {
+		grants, next, annos, err := g.Grants(context.Background(), resource, &pagination.Token{Token: token})
+		require.NoError(t, err)
+		if token == "" {
+			first = annos
+		}
+		rv = append(rv, grants...)
+		if next == "" {
+			return rv, first
+		}
+		token = next
+	}
+}
+
+func groupETag(t *testing.T, annos annotations.Annotations) *v2.ETag {
+	etag := &v2.ETag{}
+	ok, err := annos.Pick(etag)
+	require.NoError(t, err)
+	require.True(t, ok, "no ETag on the grants response")
+
+	return etag
+}
+
+// keptGroupETag returns the ETag the SDK stores on the group after listing its grants: the previous one on a match,
+// the new one otherwise. A match never comes with a new ETag.
+func keptGroupETag(t *testing.T, prev *v2.ETag, annos annotations.Annotations) *v2.ETag {
+	if annos.Contains(&v2.ETagMatch{}) {
+		require.False(t, annos.Contains(&v2.ETag{}), "a match must not stamp a new link")
+		return prev
+	}
+
+	return groupETag(t, annos)
+}
+
+func TestGroupMembershipDeltaOffline(t *testing.T) {
+	f := newFakeTenant(t)
+	f.addGroup("g2", "Group 2")
+	f.addRelation("members", "g2", "u4")
+	// Grants skips the next page of small groups, so members must fit on one page.
+	f.pageSize = 10
+	c := f.connector(t, WithDeltaSync(true))
+	g := newGroupBuilder(c)
+	groups := listAll(t, g, nil)
+	g1 := findResource(t, groups, "g1")
+	g2 := findResource(t, groups, "g2")
+	deltaRequests := f.requestCount("GET /v1.0/groups/delta")
+
+	// The first sync lists every group's members and stamps both groups with the same latest delta link.
+	grants, annos := syncGroupGrants(t, g, g1, nil)
+	require.ElementsMatch(t, []string{"owners/u3", "members/u1", "members/u2"}, grantPrincipals(grants))
+	require.False(t, annos.Contains(&v2.ETagMatch{}))
+	g1ETag := keptGroupETag(t, nil, annos)
+	require.Equal(t, groupMembersEntitlementID("g1"), g1ETag.EntitlementId)
+
+	grants, annos = syncGroupGrants(t, g, g2, nil)
+	require.Equal(t, []string{"members/u4"}, grantPrincipals(grants))
+	g2ETag := keptGroupETag(t, nil, annos)
+	require.Equal(t, g1ETag.Value, g2ETag.Value)
+	require.Equal(t, deltaRequests+1, f.requestCount("GET /v1.0/groups/delta"))
+
+	f.addRelation("members", "g1", "u5")
+	f.removeRelation("members", "g2", "u4")
+
+	// g1 only gained a user: its previous members are reused and the addition is granted. g2 lost one and is listed.
+	c.syncEpoch.Add(1)
+	membersRequests := f.requestCount("GET /beta/groups/g1/members")
+	grants, annos = syncGroupGrants(t, g, g1, g1ETag)
+	require.ElementsMatch(t, []string{"owners/u3", "members/u5"}, grantPrincipals(grants))
+	require.True(t, annos.Contains(&v2.ETagMatch{}))
+	g1ETag = keptGroupETag(t, g1ETag, annos)
+	require.Equal(t, membersRequests, f.requestCount("GET /beta/groups/g1/members"))
+
+	grants, annos = syncGroupGrants(t, g, g2, g2ETag)
+	require.Empty(t, grants)
+	require.False(t, annos.Contains(&v2.ETagMatch{}))
+	prevValue := g2ETag.Value
+	g2ETag = keptGroupETag(t, g2ETag, annos)
+	require.NotEqual(t, prevValue, g2ETag.Value, "listed members are stamped with a new link")
+	require.Equal(t, deltaRequests+2, f.requestCount("GET /v1.0/groups/delta"), "the link shared by both groups is replayed once")
+
+	// g1 kept its first link, so the next sync replays it again and still sees the member added before. The replay
+	// isn't reused across syncs: the member added since shows up too. Service principals can't be added on top of
+	// the previous members.
+	f.addRelation("members", "g1", "u4")
+	f.addRelation("members", "g2", "app1")
+	c.syncEpoch.Add(1)
+	grants, annos = syncGroupGrants(t, g, g1, g1ETag)
+	require.ElementsMatch(t, []string{"owners/u3", "members/u5", "members/u4"}, grantPrincipals(grants))
+	require.True(t, annos.Contains(&v2.ETagMatch{}))
+	g1ETag = keptGroupETag(t, g1ETag, annos)
+
+	grants, annos = syncGroupGrants(t, g, g2, g2ETag)
+	require.Equal(t, []string{"members/app1"}, grantPrincipals(grants))
+	require.False(t, annos.Contains(&v2.ETagMatch{}))
+
+	// An expired link lists the members again and stamps a new link.
+	f.expireDeltaLinks()
+	c.syncEpoch.Add(1)
+	grants, annos = syncGroupGrants(t, g, g1, g1ETag)
+	require.ElementsMatch(t, []string{"owners/u3", "members/u1", "members/u2", "members/u5", "members/u4"}, grantPrincipals(grants))
+	require.False(t, annos.Contains(&v2.ETagMatch{}))
+	require.NotEqual(t, g1ETag.Value, keptGroupETag(t, g1ETag, annos).Value)
+}
+
+func TestApplyMembershipDelta(t *testing.T) {
+	f := newFakeTenant(t)
+	c := f.connector(t, WithDeltaSync(true))
+	g := newGroupBuilder(c)
+	g1 := findResource(t, listAll(t, g, nil), "g1")
+
+	_, annos := syncGroupGrants(t, g, g1, nil)
+	prevETag := groupETag(t, annos)
+
+	tests := []struct {
+		name       string
+		prevETag   *v2.ETag
+		change     func()
+		wantReuse  bool
+		wantGrants []string
+	}{
+		{
+			name:     "no previous etag",
+			prevETag: nil,
+		},
+		{
+			name:     "etag of another entitlement",
+			prevETag: &v2.ETag{Value: prevETag.Value, EntitlementId: groupMembersEntitlementID("g2")},
+		},
+		{
+			name:      "unchanged",
+			prevETag:  prevETag,
+			wantReuse: true,
+		},
+		{
+			name:       "user added",
+			prevETag:   prevETag,
+			change:     func() { f.addRelation("members", "g1", "u4") },
+			wantReuse:  true,
+			wantGrants: []string{"members/u4"},
+		},
+		{
+			name:     "user removed",
+			prevETag: prevETag,
+			change:   func() { f.removeRelation("members", "g1", "u4") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.change != nil {
+				tt.change()
+			}
+			c.syncEpoch.Add(1)
+
+			resource := proto.Clone(g1).(*v2.Resource)
+			if tt.prevETag != nil {
+				resource.Annotations = annotations.New(tt.prevETag)
+			}
+			var annos annotations.Annotations
+			reuse, grants, err := g.applyMembershipDelta(context.Background(), resource, &annos)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantReuse, reuse)
+			require.Equal(t, tt.wantReuse, annos.Contains(&v2.ETagMatch{}))
+			require.ElementsMatch(t, tt.wantGrants, grantPrincipals(grants))
+			require.Equal(t, groupMembersEntitlementID("g1"), keptGroupETag(t, tt.prevETag, annos).EntitlementId)
+		})
+	}
+}
@@ -1,17 +1,16 @@
 package connector
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/mail"
 	"net/url"
 	"path"
 	"strings"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	armresources "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
 	armsubscription "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/subscription/armsubscription"
 	"github.com/conductorone/baton-azure-infrastructure/pkg/internal/slices"
@@ -20,9 +19,11 @@ import (
 	pagination "github.com/conductorone/baton-sdk/pkg/pagination"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	expSlices "golang.org/x/exp/slices"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 const (
+	signInActivityKey            = "signInActivity"
 	managerIDProfileKey          = "managerId"
 	employeeNumberProfileKey     = "employeeNumber"
 	managerEmailProfileKey       = "managerEmail"
@@ -31,14 +32,17 @@ const (
 	supervisorFullNameProfileKey = "supervisor"
 )
 
-var graphReadScopes = []string{
-	"https://graph.microsoft.com/.default",
-}
-
 // Create a new connector resource for an Entra User.
-func userResource(ctx context.Context, u *user, parentResourceID *v2.ResourceId, userTraitOptions ...rs.UserTraitOption) (*v2.Resource, error) {
+func userResource(ctx context.Context, cloud *azureCloud, u *user, attributes []*userAttribute, parentResourceID *v2.ResourceId, userTraitOptions ...rs.UserTraitOption) (*v2.Resource, error) {
 	primaryEmail := fetchEmailAddresses(u.Email, u.UserPrincipalName)
-	profile := make(map[string]interface{})
+	profile, err := userAttributeProfile(u, attributes)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		profile = make(map[string]interface{})
+	}
+
 	profile["id"] = u.ID
 	profile["mail"] = primaryEmail
 	profile["displayName"] = u.DisplayName
@@ -57,11 +61,27 @@ func userResource(ctx context.Context, u *user, parentResourceID *v2.ResourceId,
 		profile[supervisorFullNameProfileKey] = u.Manager.DisplayName
 	}
 
+	if u.SignInActivity != nil {
+		if t := u.SignInActivity.LastSignInDateTime; t != nil {
+			profile["lastSignInDateTime"] = t.Format(time.RFC3339)
+		}
+		if t := u.SignInActivity.LastNonInteractiveSignInDateTime; t != nil {
+			profile["lastNonInteractiveSignInDateTime"] = t.Format(time.RFC3339)
+		}
+		if t := u.SignInActivity.LastSuccessfulSignInDateTime; t != nil {
+			profile["lastSuccessfulSignInDateTime"] = t.Format(time.RFC3339)
+		}
+	}
+
 	options := []rs.UserTraitOption{
 		rs.WithEmail(primaryEmail, true),
 		rs.WithUserProfile(profile),
 	}
 
+	if lastLogin := u.SignInActivity.lastLogin(); lastLogin != nil {
+		options = append(options, rs.WithLastLogin(*lastLogin))
+	}
+
 	options = append(options, userTraitOptions...)
 	if !IsEmpty(u.UserPrincipalName) {
 		options = append(options, rs.WithUserLogin(u.UserPrincipalName))
@@ -80,7 +100,7 @@ func userResource(ctx context.Context, u *user, parentResourceID *v2.ResourceId,
 		options,
 		rs.WithParentResourceID(parentResourceID),
 		rs.WithAnnotation(&v2.ExternalLink{
-			Url: userURL(u),
+			Url: userURL(cloud, u),
 		}),
 	)
 	if err != nil {
@@ -90,13 +110,32 @@ func userResource(ctx context.Context, u *user, parentResourceID *v2.ResourceId,
 	return ret, nil
 }
 
-func userURL(u *user) string {
-	return (&url.URL{
-		Scheme:   "https",
-		Host:     "entra.microsoft.com",
-		Path:     "/",
-		Fragment: path.Join("view/Microsoft_AAD_UsersAndTenants/UserProfileMenuBlade/~/overview/userId", u.ID),
-	}).String()
+// lastLogin returns the most recent of the recorded sign-in times, or nil if none are recorded.
+func (s *signInActivity) lastLogin() *time.Time {
+	if s == nil {
+		return nil
+	}
+
+	var rv *time.Time
+	for _, t := range []*time.Time{
+		s.LastSignInDateTime,
+		s.LastNonInteractiveSignInDateTime,
+		s.LastSuccessfulSignInDateTime,
+	} {
+		if t == nil || t.IsZero() {
+			continue
+		}
+
+		if rv == nil || t.After(*rv) {
+			rv = t
+		}
+	}
+
+	return rv
+}
+
+func userURL(cloud *azureCloud, u *user) string {
+	return cloud.portalURL(path.Join("view/Microsoft_AAD_UsersAndTenants/UserProfileMenuBlade/~/overview/userId", u.ID))
 }
 
 func parsePageToken(i string, resourceID *v2.ResourceId) (*pagination.Bag, error) {
@@ -131,9 +170,11 @@ func fetchEmailAddresses(email string, upn string) string {
 	return primaryEmail
 }
 
-func setUserKeys() url.Values {
-	v := url.Values{}
-	v.Set("$select", strings.Join([]string{
+// setUserKeys returns the query used to list users. signInActivity is only selected when
+// requested because it needs AuditLog.Read.All and an Entra ID P1 or P2 license.
+// extraKeys are additional properties configured through the user attributes option.
+func setUserKeys(withSignInActivity bool, extraKeys ...string) url.Values {
+	keys := []string{
 		"id",
 		"displayName",
 		"mail",
@@ -145,7 +186,19 @@ func setUserKeys() url.Values {
 		"employeeHireDate",
 		"employeeId",
 		"department",
-	}, ","))
+	}
+	if withSignInActivity {
+		keys = append(keys, signInActivityKey)
+	}
+
+	for _, key := range extraKeys {
+		if !expSlices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	v := url.Values{}
+	v.Set("$select", strings.Join(keys, ","))
 	v.Set("$expand", "manager($select=id,employeeId,mail,displayName)")
 	v.Set("$top", "999")
 	return v
@@ -159,7 +212,7 @@ func setUserResponseKeys() url.Values {
 	return v
 }
 
-func groupResource(ctx context.Context, g *group, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+func groupResource(ctx context.Context, cloud *azureCloud, g *group, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
 	profile := map[string]interface{}{
 		"object_id":           g.ID,
 		"group_type":          groupTypeValue(g),
@@ -173,10 +226,22 @@ func groupResource(ctx context.Context, g *group, parentResourceID *v2.ResourceI
 		profile["mail"] = g.Mail
 	}
 
+	if !IsEmpty(g.MailNickname) {
+		profile["mail_nickname"] = g.MailNickname
+	}
+
 	if !IsEmpty(g.Classification) {
 		profile["classification"] = g.Classification
 	}
 
+	if !IsEmpty(g.Description) {
+		profile["description"] = g.Description
+	}
+
+	if g.IsAssignableToRole {
+		profile["is_assignable_to_role"] = g.IsAssignableToRole
+	}
+
 	if g.OnPremisesSecurityIdentifier != nil {
 		profile["on_premises_security_identifier"] = *g.OnPremisesSecurityIdentifier
 	}
@@ -192,7 +257,7 @@ func groupResource(ctx context.Context, g *group, parentResourceID *v2.ResourceI
 		g.ID,
 		groupTraitOptions,
 		rs.WithAnnotation(&v2.ExternalLink{
-			Url: groupURL(g),
+			Url: groupURL(cloud, g),
 		}),
 	)
 	if err != nil {
@@ -206,13 +271,51 @@ func IsEmpty(field string) bool {
 	return field == ""
 }
 
-func groupURL(g *group) string {
-	return (&url.URL{
-		Scheme:   "https",
-		Host:     "entra.microsoft.com",
-		Path:     "/",
-		Fragment: path.Join("view/Microsoft_AAD_IAM/GroupDetailsMenuBlade/~/Overview/groupId/", g.ID),
-	}).String()
+// getProfileBoolValue returns the bool stored under k in the profile, or false if it is missing.
+func getProfileBoolValue(profile *structpb.Struct, k string) bool {
+	if profile == nil {
+		return false
+	}
+
+	v, ok := profile.Fields[k]
+	if !ok {
+		return false
+	}
+
+	return v.GetBoolValue()
+}
+
+// getProfileStringList returns the strings stored under k in the profile. A single string
+// value is returned as a one element list so callers can accept either shape.
+func getProfileStringList(profile *structpb.Struct, k string) []string {
+	if profile == nil {
+		return nil
+	}
+
+	v, ok := profile.Fields[k]
+	if !ok {
+		return nil
+	}
+
+	if s, ok := v.Kind.(*structpb.Value_StringValue); ok {
+		if IsEmpty(s.StringValue) {
+			return nil
+		}
+		return []string{s.StringValue}
+	}
+
+	var rv []string
+	for _, item := range v.GetListValue().GetValues() {
+		if str := item.GetStringValue(); !IsEmpty(str) {
+			rv = append(rv, str)
+		}
+	}
+
+	return rv
+}
+
+func groupURL(cloud *azureCloud, g *group) string {
+	return cloud.portalURL(path.Join("view/Microsoft_AAD_IAM/GroupDetailsMenuBlade/~/Overview/groupId/", g.ID))
 }
 
 func groupTypeValue(g *group) string {
@@ -253,6 +356,7 @@ func setGroupKeys() url.Values {
 		"id",
 		"mail",
 		"mailEnabled",
+		"mailNickname",
 		"onPremisesSecurityIdentifier",
 		"onPremisesSyncEnabled",
 		"securityEnabled",
@@ -332,20 +436,8 @@ func getGroupGrants(ctx context.Context, resp *membershipList, resource *v2.Reso
 	return grants, err
 }
 
-func (a *assignment) MarshalToReader() (*bytes.Reader, error) {
-	data, err := json.Marshal(a)
-	if err != nil {
-		return nil, err
-	}
-	return bytes.NewReader(data), nil
-}
-
-func getGroupGrantURL(principal *v2.Resource) string {
-	return (&url.URL{
-		Scheme: "https",
-		Host:   "graph.microsoft.com",
-		Path:   path.Join("v1.0", "directoryObjects", principal.Id.Resource),
-	}).String()
+func getGroupGrantURL(cloud *azureCloud, principal *v2.Resource) string {
+	return cloud.directoryObjectURL(principal.Id.Resource)
 }
 
 // https://learn.microsoft.com/es-es/rest/api/subscription/subscriptions/list?view=rest-subscription-2021-10-01&tabs=HTTP
@@ -471,6 +563,28 @@ func StringValue(v *string) string {
 	return ""
 }
 
+// stringPtrsToProfileList converts a list of string pointers into a list that can be stored in a resource profile.
+func stringPtrsToProfileList(values []*string) []interface{} {
+	rv := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			rv = append(rv, *v)
+		}
+	}
+
+	return rv
+}
+
+// stringsToPtrs is the inverse of StringValue for a list of strings.
+func stringsToPtrs(values []string) []*string {
+	rv := make([]*string, 0, len(values))
+	for i := range values {
+		rv = append(rv, &values[i])
+	}
+
+	return rv
+}
+
 // BoolValue returns the value of the bool pointer passed in or
 // false if the pointer is nil.
 func BoolValue(v *bool) bool {
@@ -493,7 +607,20 @@ func roleResource(ctx context.Context, role *armauthorization.RoleDefinition, pa
 		"description":        StringValue(role.Properties.Description),
 		"type":               StringValue(role.Properties.RoleType),
 		"role-definition-id": StringValue(role.ID),
+		"assignable_scopes":  stringPtrsToProfileList(role.Properties.AssignableScopes),
 	}
+
+	var actions, notActions, dataActions, notDataActions []*string
+	for _, permission := range role.Properties.Permissions {
+		actions = append(actions, permission.Actions...)
+		notActions = append(notActions, permission.NotActions...)
+		dataActions = append(dataActions, permission.DataActions...)
+		notDataActions = append(notDataActions, permission.NotDataActions...)
+	}
+	profile["actions"] = stringPtrsToProfileList(actions)
+	profile["not_actions"] = stringPtrsToProfileList(notActions)
+	profile["data_actions"] = stringPtrsToProfileList(dataActions)
+	profile["not_data_actions"] = stringPtrsToProfileList(notDataActions)
 	roleTraitOptions := []rs.RoleTraitOption{
 		rs.WithRoleProfile(profile),
 	}
@@ -556,15 +683,62 @@ func getPrincipalType(ctx context.Context, cn *Connector, principalID string) (s
 	return "", nil
 }
 
-func managedIdentityResource(ctx context.Context, sp *servicePrincipal, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+// getPrincipalTypes resolves the type of many principals at once, the same way getPrincipalType does, by sending
+// the directoryObjects lookups through Graph batching. Principals that can't be resolved are left out.
+func getPrincipalTypes(ctx context.Context, cn *Connector, principalIDs []string) (map[string]string, error) {
+	batch := make([]*graphBatchItem, 0, len(principalIDs))
+	for _, principalID := range principalIDs {
+		batch = append(batch, &graphBatchItem{
+			URL:    cn.buildURL(fmt.Sprintf("directoryObjects/%s", principalID), nil),
+			Result: &map[string]interface{}{},
+		})
+	}
+
+	err := cn.batchGet(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(map[string]string, len(principalIDs))
+	for i, principalID := range principalIDs {
+		if batch[i].Err != nil {
+			continue
+		}
+
+		principalData, _ := batch[i].Result.(*map[string]interface{})
+		principalType, ok := (*principalData)["@odata.type"].(string)
+		if !ok {
+			continue
+		}
+
+		// Service Principal can be an Enterprise Application or Managed Identity.
+		if principalType == "#microsoft.graph.servicePrincipal" {
+			servicePrincipalType, ok := (*principalData)["servicePrincipalType"].(string)
+			if !ok {
+				continue
+			}
+			principalType = servicePrincipalType
+		}
+		rv[principalID] = principalType
+	}
+
+	return rv, nil
+}
+
+func managedIdentityResource(ctx context.Context, cloud *azureCloud, sp *servicePrincipal, activity *servicePrincipalSignInActivity, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
 	profile := make(map[string]interface{})
 	profile["id"] = sp.ID
 	profile["app_id"] = sp.AppId
+	addWorkloadIdentityProfile(profile, sp, activity)
 	options := []rs.UserTraitOption{
 		rs.WithUserProfile(profile),
 		rs.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE),
 	}
 
+	if lastActivity := activity.lastActivity(); lastActivity != nil {
+		options = append(options, rs.WithLastLogin(*lastActivity))
+	}
+
 	if !IsEmpty(sp.Info.LogoUrl) {
 		options = append(options, rs.WithUserIcon(&v2.AssetRef{
 			Id: sp.Info.LogoUrl,
@@ -583,7 +757,7 @@ func managedIdentityResource(ctx context.Context, sp *servicePrincipal, parentRe
 		options,
 		rs.WithParentResourceID(parentResourceID),
 		rs.WithAnnotation(&v2.ExternalLink{
-			Url: sp.externalURL(),
+			Url: sp.externalURL(cloud),
 		}),
 	)
 	if err != nil {
@@ -609,10 +783,11 @@ func setEnterpriseApplicationsKeys() url.Values {
 	return v
 }
 
-func enterpriseApplicationResource(ctx context.Context, app *servicePrincipal, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+func enterpriseApplicationResource(ctx context.Context, cloud *azureCloud, app *servicePrincipal, activity *servicePrincipalSignInActivity, logo *v2.AssetRef, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
 	profile := make(map[string]interface{})
 	profile["id"] = app.ID
 	profile["app_id"] = app.AppId
+	addWorkloadIdentityProfile(profile, app, activity)
 	if expSlices.Contains(app.Tags, "WindowsAzureActiveDirectoryIntegratedApp") {
 		profile["is_integrated"] = true
 	}
@@ -624,10 +799,8 @@ func enterpriseApplicationResource(ctx context.Context, app *servicePrincipal, p
 	options := []rs.AppTraitOption{
 		rs.WithAppProfile(profile),
 	}
-	if !IsEmpty(app.Info.LogoUrl) {
-		options = append(options, rs.WithAppLogo(&v2.AssetRef{
-			Id: app.Info.LogoUrl,
-		}))
+	if logo != nil {
+		options = append(options, rs.WithAppLogo(logo))
 	}
 
 	if !IsEmpty(app.Homepage) {
@@ -646,7 +819,7 @@ func enterpriseApplicationResource(ctx context.Context, app *servicePrincipal, p
 		options,
 		rs.WithParentResourceID(parentResourceID),
 		rs.WithAnnotation(&v2.ExternalLink{
-			Url: app.externalURL(),
+			Url: app.externalURL(cloud),
 		}),
 	)
 	if err != nil {
@@ -658,28 +831,114 @@ func enterpriseApplicationResource(ctx context.Context, app *servicePrincipal, p
 
 func getAllRoles(ctx context.Context, conn *Connector, subscriptionID string) ([]string, error) {
 	lstRoles := []string{}
+	if conn.useResourceGraph() {
+		snapshot, err := conn.resourceGraphSnapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, role := range snapshot.roleDefinitions[subscriptionID] {
+			lstRoles = append(lstRoles, StringValue(role.Name))
+		}
+
+		return lstRoles, nil
+	}
+
+	var roles []*armauthorization.RoleDefinition
+	if conn.useSubscriptionScan() {
+		scan, err := conn.subscriptionScanSnapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = scan.roleDefinitions[subscriptionID]
+	}
+
+	if roles == nil {
+		var err error
+		roles, err = listRoleDefinitions(ctx, conn, subscriptionID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, role := range roles {
+		lstRoles = append(lstRoles, *role.Name)
+	}
+
+	return lstRoles, nil
+}
+
+// listRoleDefinitions returns the role definitions available in a subscription.
+func listRoleDefinitions(ctx context.Context, conn *Connector, subscriptionID string) ([]*armauthorization.RoleDefinition, error) {
 	// Initialize the RoleDefinitionsClient
-	roleDefinitionsClient, err := armauthorization.NewRoleDefinitionsClient(conn.token, nil)
+	roleDefinitionsClient, err := conn.newRoleDefinitionsClient()
 	if err != nil {
 		return nil, err
 	}
 
+	rv := []*armauthorization.RoleDefinition{}
 	scope := fmt.Sprintf("/subscriptions/%s", subscriptionID)
 	// Get the list of role definitions
 	pagerRoles := roleDefinitionsClient.NewListPager(scope, nil)
 	for pagerRoles.More() {
 		resp, err := pagerRoles.NextPage(ctx)
 		if err != nil {
-			return nil, err
+			return nil, armError(err)
 		}
 
-		// Iterate over role definitions
-		for _, role := range resp.Value {
-			lstRoles = append(lstRoles, *role.Name)
+		rv = append(rv, resp.Value...)
+	}
+
+	return rv, nil
+}
+
+// listRoleAssignments returns every role assignment that applies to a subscription, except those made inside
+// filtered resource groups.
+func listRoleAssignments(ctx context.Context, conn *Connector, subscriptionID string) ([]*armauthorization.RoleAssignment, error) {
+	// Create a Role Assignments Client
+	roleAssignmentsClient, err := conn.newRoleAssignmentsClient(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := []*armauthorization.RoleAssignment{}
+	// Iterate over all role assignments
+	pagerRoles := roleAssignmentsClient.NewListForSubscriptionPager(nil)
+	for pagerRoles.More() {
+		page, err := pagerRoles.NextPage(ctx)
+		if err != nil {
+			return nil, armError(err)
 		}
+
+		rv = append(rv, page.Value...)
 	}
 
-	return lstRoles, nil
+	return conn.filterRoleAssignments(rv), nil
+}
+
+// listResourceGroups returns the resource groups of a subscription that pass the resource group filters.
+func listResourceGroups(ctx context.Context, conn *Connector, subscriptionID string) ([]*armresources.ResourceGroup, error) {
+	client, err := conn.newResourceGroupsClient(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := []*armresources.ResourceGroup{}
+	for pager := client.NewListPager(nil); pager.More(); {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, armError(err)
+		}
+
+		for _, resourceGroup := range page.Value {
+			if conn.includeResourceGroup(StringValue(resourceGroup.Name)) {
+				rv = append(rv, resourceGroup)
+			}
+		}
+	}
+
+	return rv, nil
 }
 
 func getPrincipalIDResource(principalType string, assignment *armauthorization.RoleAssignment) *v2.ResourceId {
@@ -711,30 +970,51 @@ func getPrincipalIDResource(principalType string, assignment *armauthorization.R
 
 func getResourceGroups(ctx context.Context, conn *Connector) ([]string, error) {
 	lstResourceGroups := []string{}
-	pagerSubscriptions := conn.clientFactory.NewSubscriptionsClient().NewListPager(nil)
-	for pagerSubscriptions.More() {
-		page, err := pagerSubscriptions.NextPage(ctx)
+	if conn.useResourceGraph() {
+		snapshot, err := conn.resourceGraphSnapshot(ctx)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, subscription := range page.Value {
-			client, err := armresources.NewResourceGroupsClient(*subscription.SubscriptionID, conn.token, nil)
-			if err != nil {
-				return nil, err
+		for _, resourceGroups := range snapshot.resourceGroups {
+			for _, resourceGroup := range resourceGroups {
+				lstResourceGroups = append(lstResourceGroups, StringValue(resourceGroup.Name))
 			}
+		}
 
-			for pager := client.NewListPager(nil); pager.More(); {
-				page, err := pager.NextPage(ctx)
-				if err != nil {
-					return nil, err
-				}
+		return lstResourceGroups, nil
+	}
 
-				for _, groupList := range page.Value {
-					lstResourceGroups = append(lstResourceGroups, *groupList.Name)
-				}
+	var scan *subscriptionScan
+	if conn.useSubscriptionScan() {
+		var err error
+		scan, err = conn.subscriptionScanSnapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	subscriptionIDs, err := conn.listSubscriptionIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		var resourceGroups []*armresources.ResourceGroup
+		if scan != nil {
+			resourceGroups = scan.resourceGroups[subscriptionID]
+		}
+
+		if resourceGroups == nil {
+			resourceGroups, err = listResourceGroups(ctx, conn, subscriptionID)
+			if err != nil {
+				return nil, err
 			}
 		}
+
+		for _, groupList := range resourceGroups {
+			lstResourceGroups = append(lstResourceGroups, *groupList.Name)
+		}
 	}
 
 	return lstResourceGroups, nil
@@ -742,7 +1022,7 @@ func getResourceGroups(ctx context.Context, conn *Connector) ([]string, error) {
 
 func getAssignmentID(ctx context.Context, conn *Connector, scope, subscriptionID, roleId, principalID string) (string, error) {
 	// Create a Role Assignments Client
-	roleAssignmentsClient, err := armauthorization.NewRoleAssignmentsClient(subscriptionID, conn.token, nil)
+	roleAssignmentsClient, err := conn.newRoleAssignmentsClient(subscriptionID)
 	if err != nil {
 		return "", err
 	}
@@ -752,7 +1032,7 @@ func getAssignmentID(ctx context.Context, conn *Connector, scope, subscriptionID
 	for pagerResourceGroup.More() {
 		page, err := pagerResourceGroup.NextPage(ctx)
 		if err != nil {
-			return "", err
+			return "", armError(err)
 		}
 
 		for _, assignment := range page.Value {
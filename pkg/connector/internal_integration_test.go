@@ -8,7 +8,7 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
 	"github.com/conductorone/baton-azure-infrastructure/pkg/internal/slices"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -526,7 +526,7 @@ func TestEnterpriseApplicationsGrants(t *testing.T) {
 	require.Nil(t, err)
 
 	entApps, err := slices.ConvertErr(resp.Value, func(app *servicePrincipal) (*v2.Resource, error) {
-		return enterpriseApplicationResource(ctxTest, app, nil)
+		return enterpriseApplicationResource(ctxTest, connTest.azureCloud(), app, nil, connTest.applicationLogo(app), nil)
 	})
 	require.Nil(t, err)
 
@@ -27,7 +27,9 @@ func (m *managedIdentityBuilder) List(ctx context.Context, parentResourceID *v2.
 
 	reqURL := bag.PageToken()
 	if reqURL == "" {
-		reqURL = m.conn.buildURL("servicePrincipals", setManagedIdentityKeys())
+		v := setManagedIdentityKeys()
+		addGraphFilter(v, m.conn.graphFilters.servicePrincipals)
+		reqURL = m.conn.buildURL("servicePrincipals", v)
 	}
 
 	resp := &servicePrincipalsList{}
@@ -37,7 +39,12 @@ func (m *managedIdentityBuilder) List(ctx context.Context, parentResourceID *v2.
 	}
 
 	users, err := slices.ConvertErr(resp.Value, func(mi *servicePrincipal) (*v2.Resource, error) {
-		return managedIdentityResource(ctx, mi, parentResourceID)
+		activity, err := m.conn.getServicePrincipalSignInActivity(ctx, mi.AppId)
+		if err != nil {
+			return nil, err
+		}
+
+		return managedIdentityResource(ctx, m.conn.azureCloud(), mi, activity, parentResourceID)
 	})
 	if err != nil {
 		return nil, "", nil, err
@@ -1,5 +1,10 @@
 package connector
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type manager struct {
 	Id          string `json:"id,omitempty"`
 	EmployeeId  string `json:"employeeId,omitempty"`
@@ -12,22 +17,33 @@ type mailboxSettings struct {
 }
 
 type user struct {
-	ID                string   `json:"id,omitempty"`
-	Email             string   `json:"mail,omitempty"`
-	DisplayName       string   `json:"displayName,omitempty"`
-	UserPrincipalName string   `json:"userPrincipalName,omitempty"`
-	JobTitle          string   `json:"jobTitle,omitempty"`
-	AccountEnabled    bool     `json:"accountEnabled,omitempty"`
-	EmployeeType      string   `json:"employeeType,omitempty"`
-	EmployeeID        string   `json:"employeeId,omitempty"`
-	Department        string   `json:"department,omitempty"`
-	Manager           *manager `json:"manager,omitempty"`
+	ID                string          `json:"id,omitempty"`
+	Email             string          `json:"mail,omitempty"`
+	DisplayName       string          `json:"displayName,omitempty"`
+	UserPrincipalName string          `json:"userPrincipalName,omitempty"`
+	JobTitle          string          `json:"jobTitle,omitempty"`
+	AccountEnabled    bool            `json:"accountEnabled,omitempty"`
+	EmployeeType      string          `json:"employeeType,omitempty"`
+	EmployeeID        string          `json:"employeeId,omitempty"`
+	Department        string          `json:"department,omitempty"`
+	Manager           *manager        `json:"manager,omitempty"`
+	SignInActivity    *signInActivity `json:"signInActivity,omitempty"`
+	raw               json.RawMessage
+}
+
+// https://learn.microsoft.com/en-us/graph/api/resources/signinactivity?view=graph-rest-1.0
+type signInActivity struct {
+	LastSignInDateTime               *time.Time `json:"lastSignInDateTime,omitempty"`
+	LastNonInteractiveSignInDateTime *time.Time `json:"lastNonInteractiveSignInDateTime,omitempty"`
+	LastSuccessfulSignInDateTime     *time.Time `json:"lastSuccessfulSignInDateTime,omitempty"`
 }
 
 type usersList struct {
 	Context  string  `json:"@odata.context"`
 	NextLink string  `json:"@odata.nextLink"`
 	Users    []*user `json:"value,omitempty"`
+	// keepRaw is set before decoding when user attributes are configured, see UnmarshalJSON.
+	keepRaw bool
 }
 
 // https://learn.microsoft.com/en-us/graph/api/resources/group?view=graph-rest-1.0#properties
@@ -39,6 +55,7 @@ type group struct {
 	ID                           string   `json:"id,omitempty"`
 	Mail                         string   `json:"mail,omitempty"`
 	MailEnabled                  bool     `json:"mailEnabled,omitempty"`
+	MailNickname                 string   `json:"mailNickname,omitempty"`
 	OnPremisesSecurityIdentifier *string  `json:"onPremisesSecurityIdentifier,omitempty"`
 	OnPremisesSyncEnabled        bool     `json:"onPremisesSyncEnabled,omitempty"`
 	SecurityEnabled              bool     `json:"securityEnabled,omitempty"`
@@ -48,6 +65,18 @@ type group struct {
 	CreatedDateTime              string   `json:"createdDateTime,omitempty"`
 }
 
+// https://learn.microsoft.com/en-us/graph/api/group-post-groups?view=graph-rest-1.0#request-body
+type groupCreateRequest struct {
+	Description        string   `json:"description,omitempty"`
+	DisplayName        string   `json:"displayName"`
+	GroupTypes         []string `json:"groupTypes"`
+	MailEnabled        bool     `json:"mailEnabled"`
+	MailNickname       string   `json:"mailNickname"`
+	SecurityEnabled    bool     `json:"securityEnabled"`
+	IsAssignableToRole bool     `json:"isAssignableToRole,omitempty"`
+	Owners             []string `json:"owners@odata.bind,omitempty"`
+}
+
 type groupsList struct {
 	Context  string   `json:"@odata.context"`
 	NextLink string   `json:"@odata.nextLink"`
@@ -86,6 +115,39 @@ type servicePrincipal struct {
 	Tags                   []string             `json:"tags,omitempty"`
 	AppRoles               []*appRole           `json:"appRoles,omitempty"`
 	AppRolesAssignedTo     []*appRoleAssignment `json:"appRoleAssignedTo,omitempty"`
+	KeyCredentials         []*credential        `json:"keyCredentials,omitempty"`
+	PasswordCredentials    []*credential        `json:"passwordCredentials,omitempty"`
+}
+
+// https://learn.microsoft.com/en-us/graph/api/resources/keycredential?view=graph-rest-1.0
+// https://learn.microsoft.com/en-us/graph/api/resources/passwordcredential?view=graph-rest-1.0
+type credential struct {
+	KeyId         string     `json:"keyId,omitempty"`
+	DisplayName   string     `json:"displayName,omitempty"`
+	StartDateTime *time.Time `json:"startDateTime,omitempty"`
+	EndDateTime   *time.Time `json:"endDateTime,omitempty"`
+}
+
+// https://learn.microsoft.com/en-us/graph/api/resources/serviceprincipalsigninactivity?view=graph-rest-beta
+type servicePrincipalSignInActivity struct {
+	ID                                              string               `json:"id,omitempty"`
+	AppId                                           string               `json:"appId,omitempty"`
+	LastSignInActivity                              *signInActivityEntry `json:"lastSignInActivity,omitempty"`
+	DelegatedClientSignInActivity                   *signInActivityEntry `json:"delegatedClientSignInActivity,omitempty"`
+	DelegatedResourceSignInActivity                 *signInActivityEntry `json:"delegatedResourceSignInActivity,omitempty"`
+	ApplicationAuthenticationClientSignInActivity   *signInActivityEntry `json:"applicationAuthenticationClientSignInActivity,omitempty"`
+	ApplicationAuthenticationResourceSignInActivity *signInActivityEntry `json:"applicationAuthenticationResourceSignInActivity,omitempty"`
+}
+
+type signInActivityEntry struct {
+	LastSignInDateTime  *time.Time `json:"lastSignInDateTime,omitempty"`
+	LastSignInRequestId string     `json:"lastSignInRequestId,omitempty"`
+}
+
+type servicePrincipalSignInActivityList struct {
+	Context  string                            `json:"@odata.context"`
+	NextLink string                            `json:"@odata.nextLink"`
+	Value    []*servicePrincipalSignInActivity `json:"value,omitempty"`
 }
 
 type info struct {
@@ -126,3 +188,101 @@ type appRoleAssignment struct {
 	ResourceDisplayName  string `json:"resourceDisplayName"`
 	ResourceId           string `json:"resourceId"`
 }
+
+// https://learn.microsoft.com/en-us/graph/api/resources/directoryaudit?view=graph-rest-1.0
+type directoryAudit struct {
+	ID                  string                  `json:"id"`
+	Category            string                  `json:"category,omitempty"`
+	ActivityDateTime    time.Time               `json:"activityDateTime"`
+	ActivityDisplayName string                  `json:"activityDisplayName"`
+	Result              string                  `json:"result,omitempty"`
+	InitiatedBy         *auditActivityInitiator `json:"initiatedBy,omitempty"`
+	TargetResources     []*auditTargetResource  `json:"targetResources,omitempty"`
+}
+
+type auditActivityInitiator struct {
+	User *auditUserIdentity `json:"user,omitempty"`
+	App  *auditAppIdentity  `json:"app,omitempty"`
+}
+
+type auditUserIdentity struct {
+	ID                string `json:"id,omitempty"`
+	DisplayName       string `json:"displayName,omitempty"`
+	UserPrincipalName string `json:"userPrincipalName,omitempty"`
+}
+
+type auditAppIdentity struct {
+	AppID              string `json:"appId,omitempty"`
+	DisplayName        string `json:"displayName,omitempty"`
+	ServicePrincipalID string `json:"servicePrincipalId,omitempty"`
+}
+
+type auditTargetResource struct {
+	ID                 string                   `json:"id,omitempty"`
+	DisplayName        string                   `json:"displayName,omitempty"`
+	Type               string                   `json:"type,omitempty"` // User, Group, ServicePrincipal, Role, ...
+	UserPrincipalName  string                   `json:"userPrincipalName,omitempty"`
+	ModifiedProperties []*auditModifiedProperty `json:"modifiedProperties,omitempty"`
+}
+
+type auditModifiedProperty struct {
+	DisplayName string `json:"displayName,omitempty"`
+	OldValue    string `json:"oldValue,omitempty"`
+	NewValue    string `json:"newValue,omitempty"`
+}
+
+type directoryAuditList struct {
+	Context  string            `json:"@odata.context"`
+	NextLink string            `json:"@odata.nextLink"`
+	Value    []*directoryAudit `json:"value,omitempty"`
+}
+
+// https://learn.microsoft.com/en-us/rest/api/monitor/activity-logs/list?view=rest-monitor-2015-04-01
+type activityLogEvent struct {
+	EventDataID    string            `json:"eventDataId"`
+	OperationName  *activityLogValue `json:"operationName,omitempty"`
+	Status         *activityLogValue `json:"status,omitempty"`
+	EventTimestamp time.Time         `json:"eventTimestamp"`
+	Caller         string            `json:"caller,omitempty"`
+	ResourceID     string            `json:"resourceId,omitempty"`
+	SubscriptionID string            `json:"subscriptionId,omitempty"`
+	Properties     map[string]string `json:"properties,omitempty"`
+}
+
+type activityLogValue struct {
+	Value          string `json:"value"`
+	LocalizedValue string `json:"localizedValue,omitempty"`
+}
+
+type activityLogList struct {
+	NextLink string              `json:"nextLink"`
+	Value    []*activityLogEvent `json:"value,omitempty"`
+}
+
+// roleAssignmentLogBody is the role assignment carried in the requestbody and responseBody activity log properties.
+type roleAssignmentLogBody struct {
+	ID         string `json:"id"`
+	Properties struct {
+		RoleDefinitionID string `json:"roleDefinitionId"`
+		PrincipalID      string `json:"principalId"`
+		PrincipalType    string `json:"principalType"`
+		Scope            string `json:"scope"`
+	} `json:"properties"`
+}
+
+// https://learn.microsoft.com/en-us/graph/api/resources/signin?view=graph-rest-1.0
+type signIn struct {
+	ID                string    `json:"id"`
+	CreatedDateTime   time.Time `json:"createdDateTime"`
+	UserID            string    `json:"userId"`
+	UserDisplayName   string    `json:"userDisplayName,omitempty"`
+	UserPrincipalName string    `json:"userPrincipalName,omitempty"`
+	AppID             string    `json:"appId"`
+	AppDisplayName    string    `json:"appDisplayName,omitempty"`
+}
+
+type signInList struct {
+	Context  string    `json:"@odata.context"`
+	NextLink string    `json:"@odata.nextLink"`
+	Value    []*signIn `json:"value,omitempty"`
+}
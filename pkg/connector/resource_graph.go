@@ -0,0 +1,307 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	armresources "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	armsubscription "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/subscription/armsubscription"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// Azure Resource Graph backend.
+//
+// Instead of walking subscriptions, resource groups, role definitions and role assignments one subscription at
+// a time through the ARM pagers, the whole tenant is read with four Resource Graph queries. Rows are decoded into
+// the same ARM SDK models the pagers return, so the resource constructors and grant logic are shared.
+//
+// https://learn.microsoft.com/en-us/azure/governance/resource-graph/reference/supported-tables-resources
+// https://learn.microsoft.com/en-us/rest/api/azureresourcegraph/resourcegraph/resources/resources
+
+const (
+	resourceGraphAPIVersion = "2022-10-01"
+	resourceGraphPageSize   = 1000
+	resourceGraphPath       = "providers/Microsoft.ResourceGraph/resources"
+
+	resourceGraphSubscriptionsQuery = `resourcecontainers
+| where type =~ 'microsoft.resources/subscriptions'
+| project id, name, subscriptionId, properties`
+	resourceGraphResourceGroupsQuery = `resourcecontainers
+| where type =~ 'microsoft.resources/subscriptions/resourcegroups'
+| project id, name, type, location, tags, managedBy, properties, subscriptionId`
+	resourceGraphRoleDefinitionsQuery = `authorizationresources
+| where type =~ 'microsoft.authorization/roledefinitions'
+| project id, name, type, properties, subscriptionId`
+	resourceGraphRoleAssignmentsQuery = `authorizationresources
+| where type =~ 'microsoft.authorization/roleassignments'
+| project id, name, type, properties, subscriptionId`
+)
+
+type resourceGraphRequest struct {
+	Query   string                `json:"query"`
+	Options *resourceGraphOptions `json:"options,omitempty"`
+}
+
+type resourceGraphOptions struct {
+	SkipToken    string `json:"$skipToken,omitempty"`
+	Top          int    `json:"$top,omitempty"`
+	ResultFormat string `json:"resultFormat,omitempty"`
+}
+
+type resourceGraphResponse struct {
+	TotalRecords    int64             `json:"totalRecords"`
+	Count           int64             `json:"count"`
+	ResultTruncated string            `json:"resultTruncated"`
+	SkipToken       string            `json:"$skipToken"`
+	Data            []json.RawMessage `json:"data"`
+}
+
+type resourceGraphSubscription struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	SubscriptionID string `json:"subscriptionId"`
+	Properties     struct {
+		State string `json:"state"`
+		// ManagementGroupAncestorsChain lists the management groups above the subscription, up to the tenant root group.
+		ManagementGroupAncestorsChain []struct {
+			Name string `json:"name"`
+		} `json:"managementGroupAncestorsChain"`
+	} `json:"properties"`
+}
+
+// resourceGraphCache holds the tenant wide snapshot read from Resource Graph, grouped by subscription ID.
+type resourceGraphCache struct {
+	subscriptions   []*armsubscription.Subscription
+	resourceGroups  map[string][]*armresources.ResourceGroup
+	roleDefinitions map[string][]*armauthorization.RoleDefinition
+	roleAssignments map[string][]*armauthorization.RoleAssignment
+}
+
+func newResourceGraphCache() *resourceGraphCache {
+	return &resourceGraphCache{
+		resourceGroups:  make(map[string][]*armresources.ResourceGroup),
+		roleDefinitions: make(map[string][]*armauthorization.RoleDefinition),
+		roleAssignments: make(map[string][]*armauthorization.RoleAssignment),
+	}
+}
+
+// useResourceGraph reports whether ARM data is read through Resource Graph.
+func (d *Connector) useResourceGraph() bool {
+	return d.resourceGraph != nil
+}
+
+// resourceGraphSnapshot loads the Resource Graph snapshot on first use in each sync.
+func (d *Connector) resourceGraphSnapshot(ctx context.Context) (*resourceGraphCache, error) {
+	return d.resourceGraph.get(ctx, d.loadResourceGraph)
+}
+
+// loadResourceGraph reads the snapshot, leaving out filtered subscriptions and resource groups along with their
+// role definitions and role assignments.
+func (d *Connector) loadResourceGraph(ctx context.Context) (*resourceGraphCache, error) {
+	cache := newResourceGraphCache()
+	included := make(map[string]bool)
+	// managementGroupSubscriptions maps lower cased management group names to the included subscriptions below them.
+	managementGroupSubscriptions := make(map[string][]string)
+	err := d.queryResourceGraph(ctx, resourceGraphSubscriptionsQuery, func(row json.RawMessage) error {
+		s := &resourceGraphSubscription{}
+		if err := json.Unmarshal(row, s); err != nil {
+			return err
+		}
+
+		state := armsubscription.SubscriptionState(s.Properties.State)
+		subscription := &armsubscription.Subscription{
+			ID:             &s.ID,
+			SubscriptionID: &s.SubscriptionID,
+			DisplayName:    &s.Name,
+			State:          &state,
+		}
+		ok, err := d.includeSubscription(ctx, subscription)
+		if err != nil || !ok {
+			return err
+		}
+
+		included[s.SubscriptionID] = true
+		cache.subscriptions = append(cache.subscriptions, subscription)
+		for _, ancestor := range s.Properties.ManagementGroupAncestorsChain {
+			name := strings.ToLower(ancestor.Name)
+			managementGroupSubscriptions[name] = append(managementGroupSubscriptions[name], s.SubscriptionID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.queryResourceGraph(ctx, resourceGraphResourceGroupsQuery, func(row json.RawMessage) error {
+		rg := &armresources.ResourceGroup{}
+		if err := json.Unmarshal(row, rg); err != nil {
+			return err
+		}
+
+		subscriptionID := resourceGraphSubscriptionID(row)
+		if !included[subscriptionID] || !d.includeResourceGroup(StringValue(rg.Name)) {
+			return nil
+		}
+		cache.resourceGroups[subscriptionID] = append(cache.resourceGroups[subscriptionID], rg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tenantRoles []*armauthorization.RoleDefinition
+	err = d.queryResourceGraph(ctx, resourceGraphRoleDefinitionsQuery, func(row json.RawMessage) error {
+		role := &armauthorization.RoleDefinition{}
+		if err := json.Unmarshal(row, role); err != nil {
+			return err
+		}
+
+		// Built-in roles live at the tenant root and are available in every subscription.
+		subscriptionID := resourceGraphSubscriptionID(row)
+		if subscriptionID == "" {
+			tenantRoles = append(tenantRoles, role)
+			return nil
+		}
+		if !included[subscriptionID] {
+			return nil
+		}
+		cache.roleDefinitions[subscriptionID] = append(cache.roleDefinitions[subscriptionID], role)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The ARM pagers return role definitions with subscription scoped IDs, which roleResource relies on.
+	for _, s := range cache.subscriptions {
+		subscriptionID := StringValue(s.SubscriptionID)
+		roles := make([]*armauthorization.RoleDefinition, 0, len(tenantRoles)+len(cache.roleDefinitions[subscriptionID]))
+		for _, defs := range [][]*armauthorization.RoleDefinition{tenantRoles, cache.roleDefinitions[subscriptionID]} {
+			for _, role := range defs {
+				scoped := *role
+				id := subscriptionRoleDefinitionID(subscriptionID, StringValue(role.Name))
+				scoped.ID = &id
+				roles = append(roles, &scoped)
+			}
+		}
+		cache.roleDefinitions[subscriptionID] = roles
+	}
+
+	// Like the ARM pager, every subscription also lists the assignments it inherits from the management groups
+	// above it and from the root scope. Those rows have no subscription ID of their own.
+	err = d.queryResourceGraph(ctx, resourceGraphRoleAssignmentsQuery, func(row json.RawMessage) error {
+		assignment := &armauthorization.RoleAssignment{}
+		if err := json.Unmarshal(row, assignment); err != nil {
+			return err
+		}
+
+		if assignment.Properties == nil || !d.includeRoleAssignment(assignment) {
+			return nil
+		}
+
+		subscriptionIDs := []string{resourceGraphSubscriptionID(row)}
+		if subscriptionIDs[0] == "" {
+			subscriptionIDs = inheritingSubscriptions(StringValue(assignment.Properties.Scope), cache.subscriptions, managementGroupSubscriptions)
+		}
+
+		for _, subscriptionID := range subscriptionIDs {
+			if !included[subscriptionID] {
+				continue
+			}
+
+			scoped := *assignment
+			properties := *assignment.Properties
+			roleDefinitionID := subscriptionRoleDefinitionID(subscriptionID, path.Base(StringValue(assignment.Properties.RoleDefinitionID)))
+			properties.RoleDefinitionID = &roleDefinitionID
+			scoped.Properties = &properties
+			cache.roleAssignments[subscriptionID] = append(cache.roleAssignments[subscriptionID], &scoped)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctxzap.Extract(ctx).Debug("baton-azure-infrastructure: loaded resource graph snapshot",
+		zap.Int("subscriptions", len(cache.subscriptions)),
+	)
+
+	return cache, nil
+}
+
+// queryResourceGraph runs query across every subscription the connector can read and calls fn for each row.
+func (d *Connector) queryResourceGraph(ctx context.Context, query string, fn func(row json.RawMessage) error) error {
+	v := url.Values{}
+	v.Set("api-version", resourceGraphAPIVersion)
+	reqURL := d.buildARMURL(resourceGraphPath, v)
+
+	skipToken := ""
+	for {
+		body := &resourceGraphRequest{
+			Query: query,
+			Options: &resourceGraphOptions{
+				SkipToken:    skipToken,
+				Top:          resourceGraphPageSize,
+				ResultFormat: "objectArray",
+			},
+		}
+
+		resp := &resourceGraphResponse{}
+		err := d.query(ctx, armScopes, http.MethodPost, reqURL, body, resp)
+		if err != nil {
+			return fmt.Errorf("baton-azure-infrastructure: resource graph query failed: %w", err)
+		}
+
+		for _, row := range resp.Data {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+
+		if resp.SkipToken == "" {
+			return nil
+		}
+		skipToken = resp.SkipToken
+	}
+}
+
+// inheritingSubscriptions returns the subscriptions that inherit an assignment made at a management group or the
+// root scope. Other scopes are never inherited by a subscription.
+func inheritingSubscriptions(scope string, subscriptions []*armsubscription.Subscription, managementGroupSubscriptions map[string][]string) []string {
+	if scope == "/" {
+		rv := make([]string, 0, len(subscriptions))
+		for _, s := range subscriptions {
+			rv = append(rv, StringValue(s.SubscriptionID))
+		}
+		return rv
+	}
+
+	managementGroup, ok := strings.CutPrefix(strings.ToLower(scope), "/providers/microsoft.management/managementgroups/")
+	if !ok || strings.Contains(managementGroup, "/") {
+		return nil
+	}
+
+	return managementGroupSubscriptions[managementGroup]
+}
+
+func resourceGraphSubscriptionID(row json.RawMessage) string {
+	v := struct {
+		SubscriptionID string `json:"subscriptionId"`
+	}{}
+	if err := json.Unmarshal(row, &v); err != nil {
+		return ""
+	}
+
+	return v.SubscriptionID
+}
+
+func subscriptionRoleDefinitionID(subscriptionID, roleID string) string {
+	return fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", subscriptionID, roleID)
+}
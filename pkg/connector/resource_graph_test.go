@@ -0,0 +1,139 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	graphSubscription1 = "bbbbbbbb-0000-0000-0000-000000000001"
+	graphSubscription2 = "bbbbbbbb-0000-0000-0000-000000000002"
+	graphSubscription3 = "bbbbbbbb-0000-0000-0000-000000000003"
+	graphCustomRoleID  = "cccccccc-0000-0000-0000-000000000001"
+)
+
+func graphSubscriptionRow(subscriptionID, name string, managementGroups ...string) map[string]any {
+	ancestors := make([]map[string]any, 0, len(managementGroups))
+	for _, mg := range managementGroups {
+		ancestors = append(ancestors, map[string]any{"name": mg, "displayName": mg})
+	}
+
+	return map[string]any{
+		"id":             "/subscriptions/" + subscriptionID,
+		"name":           name,
+		"subscriptionId": subscriptionID,
+		"properties": map[string]any{
+			"state":                         "Enabled",
+			"managementGroupAncestorsChain": ancestors,
+		},
+	}
+}
+
+func graphRoleAssignmentRow(scope, subscriptionID, name, roleID, principalID string) map[string]any {
+	return map[string]any{
+		"id":             scope + "/providers/Microsoft.Authorization/roleAssignments/" + name,
+		"name":           name,
+		"type":           "microsoft.authorization/roleassignments",
+		"subscriptionId": subscriptionID,
+		"properties": map[string]any{
+			"scope":            scope,
+			"principalId":      principalID,
+			"roleDefinitionId": "/providers/Microsoft.Authorization/RoleDefinitions/" + roleID,
+		},
+	}
+}
+
+// newResourceGraphTenant registers Resource Graph rows for three subscriptions. The first and third sit below
+// management group mg1, the second below mg2, and all of them below the tenant root group.
+func newResourceGraphTenant(t *testing.T) *fakeAzure {
+	f := newFakeAzure(t)
+	f.resourceGraphRows[resourceGraphSubscriptionsQuery] = []map[string]any{
+		graphSubscriptionRow(graphSubscription1, "Production", "mg1", fakeTenantID),
+		graphSubscriptionRow(graphSubscription2, "Sandbox", "mg2", fakeTenantID),
+		graphSubscriptionRow(graphSubscription3, "Shared", "mg1", fakeTenantID),
+	}
+	f.resourceGraphRows[resourceGraphResourceGroupsQuery] = []map[string]any{
+		{"id": "/subscriptions/" + graphSubscription1 + "/resourceGroups/rg1", "name": "rg1", "location": "eastus", "subscriptionId": graphSubscription1},
+		{"id": "/subscriptions/" + graphSubscription2 + "/resourceGroups/rg2", "name": "rg2", "location": "eastus", "subscriptionId": graphSubscription2},
+	}
+	f.resourceGraphRows[resourceGraphRoleDefinitionsQuery] = []map[string]any{
+		{
+			"id":             "/providers/Microsoft.Authorization/RoleDefinitions/" + fakeRoleID,
+			"name":           fakeRoleID,
+			"subscriptionId": "",
+			"properties":     map[string]any{"roleName": "Reader", "type": "BuiltInRole"},
+		},
+		{
+			"id":             "/subscriptions/" + graphSubscription1 + "/providers/Microsoft.Authorization/roleDefinitions/" + graphCustomRoleID,
+			"name":           graphCustomRoleID,
+			"subscriptionId": graphSubscription1,
+			"properties":     map[string]any{"roleName": "Custom", "type": "CustomRole"},
+		},
+	}
+	f.resourceGraphRows[resourceGraphRoleAssignmentsQuery] = []map[string]any{
+		graphRoleAssignmentRow("/subscriptions/"+graphSubscription1, graphSubscription1, "ra-sub", graphCustomRoleID, "u1"),
+		graphRoleAssignmentRow("/subscriptions/"+graphSubscription2+"/resourceGroups/rg2", graphSubscription2, "ra-rg", fakeRoleID, "u2"),
+		graphRoleAssignmentRow("/providers/Microsoft.Management/managementGroups/mg1", "", "ra-mg1", fakeRoleID, "u3"),
+		graphRoleAssignmentRow("/providers/Microsoft.Management/managementGroups/mg2", "", "ra-mg2", fakeRoleID, "u4"),
+		graphRoleAssignmentRow("/", "", "ra-root", fakeRoleID, "u5"),
+	}
+
+	return f
+}
+
+func TestResourceGraphSnapshot(t *testing.T) {
+	ctx := context.Background()
+	f := newResourceGraphTenant(t)
+	c := f.connector(t, WithResourceGraph(true), WithExcludedSubscriptionIDs(graphSubscription3))
+
+	snapshot, err := c.resourceGraphSnapshot(ctx)
+	require.NoError(t, err)
+
+	var subscriptionIDs []string
+	for _, s := range snapshot.subscriptions {
+		subscriptionIDs = append(subscriptionIDs, StringValue(s.SubscriptionID))
+	}
+	require.Equal(t, []string{graphSubscription1, graphSubscription2}, subscriptionIDs)
+	require.Len(t, snapshot.resourceGroups[graphSubscription1], 1)
+	require.Len(t, snapshot.resourceGroups[graphSubscription2], 1)
+	require.NotContains(t, snapshot.roleAssignments, graphSubscription3)
+
+	// Built-in roles are listed in every subscription, custom roles only in their own. Both get subscription IDs.
+	require.Len(t, snapshot.roleDefinitions[graphSubscription1], 2)
+	require.Len(t, snapshot.roleDefinitions[graphSubscription2], 1)
+	require.Equal(t, subscriptionRoleDefinitionID(graphSubscription2, fakeRoleID), StringValue(snapshot.roleDefinitions[graphSubscription2][0].ID))
+
+	// Subscriptions list the assignments inherited from the management groups above them and from the root scope.
+	assignments := func(subscriptionID string) map[string]string {
+		rv := make(map[string]string)
+		for _, assignment := range snapshot.roleAssignments[subscriptionID] {
+			rv[StringValue(assignment.Name)] = StringValue(assignment.Properties.RoleDefinitionID)
+		}
+		return rv
+	}
+	require.Equal(t, map[string]string{
+		"ra-sub":  subscriptionRoleDefinitionID(graphSubscription1, graphCustomRoleID),
+		"ra-mg1":  subscriptionRoleDefinitionID(graphSubscription1, fakeRoleID),
+		"ra-root": subscriptionRoleDefinitionID(graphSubscription1, fakeRoleID),
+	}, assignments(graphSubscription1))
+	require.Equal(t, map[string]string{
+		"ra-rg":   subscriptionRoleDefinitionID(graphSubscription2, fakeRoleID),
+		"ra-mg2":  subscriptionRoleDefinitionID(graphSubscription2, fakeRoleID),
+		"ra-root": subscriptionRoleDefinitionID(graphSubscription2, fakeRoleID),
+	}, assignments(graphSubscription2))
+
+	// The snapshot is read once per sync.
+	requests := f.requestCount("Microsoft.ResourceGraph")
+	require.Positive(t, requests)
+	_, err = c.resourceGraphSnapshot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, requests, f.requestCount("Microsoft.ResourceGraph"))
+
+	f.resourceGraphRows[resourceGraphRoleAssignmentsQuery] = nil
+	c.syncEpoch.Add(1)
+	snapshot, err = c.resourceGraphSnapshot(ctx)
+	require.NoError(t, err)
+	require.Empty(t, snapshot.roleAssignments)
+}
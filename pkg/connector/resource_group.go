@@ -2,6 +2,9 @@ package connector
 
 import (
 	"context"
+	"net/http"
+	"net/url"
+	"path"
 
 	armresources "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -9,6 +12,9 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 )
 
+// resourceGroupsAPIVersion is the Microsoft.Resources API version used to list resource groups.
+const resourceGroupsAPIVersion = "2021-04-01"
+
 type resourceGroupBuilder struct {
 	conn *Connector
 }
@@ -24,38 +30,93 @@ func (rg *resourceGroupBuilder) List(ctx context.Context, parentResourceID *v2.R
 
 	var rv []*v2.Resource
 	subscriptionID := parentResourceID.Resource
-
-	client, err := armresources.NewResourceGroupsClient(subscriptionID, rg.conn.token, nil)
+	ok, err := rg.conn.subscriptionIncluded(ctx, subscriptionID)
 	if err != nil {
 		return nil, "", nil, err
 	}
+	if !ok {
+		return nil, "", nil, nil
+	}
 
-	for pager := client.NewListPager(nil); pager.More(); {
-		page, err := pager.NextPage(ctx)
+	// Prefetched resource groups are listed in one page. Without them, or when the subscription failed to
+	// prefetch, they are paged from ARM.
+	var (
+		resourceGroups []*armresources.ResourceGroup
+		prefetched     bool
+	)
+	switch {
+	case rg.conn.useResourceGraph():
+		snapshot, err := rg.conn.resourceGraphSnapshot(ctx)
 		if err != nil {
 			return nil, "", nil, err
 		}
+		resourceGroups, prefetched = snapshot.resourceGroups[subscriptionID], true
+	case rg.conn.useSubscriptionScan():
+		scan, err := rg.conn.subscriptionScanSnapshot(ctx)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		resourceGroups, prefetched = scan.resourceGroups[subscriptionID]
+	}
 
-		// NOTE: The service desides how many items to return on a page.
-		// If a page has 0 items, then, get the next page.
-		// Other clients may be adding/deleting items from the collection while
-		// this code is paging; some items may be skipped or returned multiple times.
-		for _, resourceGroup := range page.Value {
-			gr, err := resourceGroupResource(ctx,
-				resourceGroup,
-				&v2.ResourceId{
-					ResourceType: subscriptionsResourceType.Id,
-					Resource:     StringValue(&subscriptionID),
-				})
+	if prefetched {
+		for _, resourceGroup := range resourceGroups {
+			gr, err := resourceGroupResource(ctx, resourceGroup, parentResourceID)
 			if err != nil {
 				return nil, "", nil, err
 			}
 
 			rv = append(rv, gr)
 		}
+
+		return rv, "", nil, nil
+	}
+
+	bag, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: resourceGroupResourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	reqURL := bag.PageToken()
+	if reqURL == "" {
+		v := url.Values{}
+		v.Set("api-version", resourceGroupsAPIVersion)
+		reqURL = rg.conn.buildARMURL(path.Join("subscriptions", subscriptionID, "resourcegroups"), v)
+	}
+
+	// NOTE: The service decides how many items to return on a page, and may return an empty page with a nextLink.
+	// Other clients may be adding/deleting items from the collection while
+	// this code is paging; some items may be skipped or returned multiple times.
+	resp := &armresources.ResourceGroupListResult{}
+	err = rg.conn.queryUncached(ctx, armScopes, http.MethodGet, reqURL, nil, resp)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	for _, resourceGroup := range resp.Value {
+		if !rg.conn.includeResourceGroup(StringValue(resourceGroup.Name)) {
+			continue
+		}
+
+		gr, err := resourceGroupResource(ctx,
+			resourceGroup,
+			&v2.ResourceId{
+				ResourceType: subscriptionsResourceType.Id,
+				Resource:     StringValue(&subscriptionID),
+			})
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		rv = append(rv, gr)
+	}
+
+	pageToken, err := bag.NextToken(StringValue(resp.NextLink))
+	if err != nil {
+		return nil, "", nil, err
 	}
 
-	return rv, "", nil, nil
+	return rv, pageToken, nil, nil
 }
 
 func (rg *resourceGroupBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
@@ -8,7 +8,7 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	armresources "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -31,52 +31,54 @@ func (ra *roleAssignmentResourceGroupBuilder) ResourceType(ctx context.Context)
 }
 
 func (ra *roleAssignmentResourceGroupBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var scan *subscriptionScan
+	if ra.conn.useSubscriptionScan() {
+		var err error
+		scan, err = ra.conn.subscriptionScanSnapshot(ctx)
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	subscriptionIDs, err := ra.conn.listSubscriptionIDs(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
 	var rv []*v2.Resource
-	pagerSubscriptions := ra.conn.clientFactory.NewSubscriptionsClient().NewListPager(nil)
-	for pagerSubscriptions.More() {
-		page, err := pagerSubscriptions.NextPage(ctx)
+	for _, subscriptionID := range subscriptionIDs {
+		lstRoles, err := getAllRoles(ctx, ra.conn, subscriptionID)
 		if err != nil {
 			return nil, "", nil, err
 		}
 
-		for _, subscription := range page.Value {
-			lstRoles, err := getAllRoles(ctx, ra.conn, *subscription.SubscriptionID)
-			if err != nil {
-				return nil, "", nil, err
-			}
+		var resourceGroups []*armresources.ResourceGroup
+		if scan != nil {
+			resourceGroups = scan.resourceGroups[subscriptionID]
+		}
 
-			client, err := armresources.NewResourceGroupsClient(*subscription.SubscriptionID, ra.conn.token, nil)
+		if resourceGroups == nil {
+			resourceGroups, err = listResourceGroups(ctx, ra.conn, subscriptionID)
 			if err != nil {
 				return nil, "", nil, err
 			}
+		}
 
-			for pager := client.NewListPager(nil); pager.More(); {
-				page, err := pager.NextPage(ctx)
+		for _, resourceGroup := range resourceGroups {
+			for _, roleID := range lstRoles {
+				gr, err := roleAssignmentResourceGroupResource(ctx,
+					subscriptionID,
+					roleID,
+					resourceGroup,
+					&v2.ResourceId{
+						ResourceType: subscriptionsResourceType.Id,
+						Resource:     subscriptionID,
+					})
 				if err != nil {
 					return nil, "", nil, err
 				}
 
-				// NOTE: The service decides how many items to return on a page.
-				// If a page has 0 items, then, get the next page.
-				// Other clients may be adding/deleting items from the collection while
-				// this code is paging; some items may be skipped or returned multiple times.
-				for _, resourceGroup := range page.Value {
-					for _, roleID := range lstRoles {
-						gr, err := roleAssignmentResourceGroupResource(ctx,
-							*subscription.SubscriptionID,
-							roleID,
-							resourceGroup,
-							&v2.ResourceId{
-								ResourceType: subscriptionsResourceType.Id,
-								Resource:     StringValue(subscription.SubscriptionID),
-							})
-						if err != nil {
-							return nil, "", nil, err
-						}
-
-						rv = append(rv, gr)
-					}
-				}
+				rv = append(rv, gr)
 			}
 		}
 	}
@@ -118,7 +120,7 @@ func (ra *roleAssignmentResourceGroupBuilder) Grants(ctx context.Context, resour
 	}
 
 	// Create a Role Assignments Client
-	roleAssignmentsClient, err := armauthorization.NewRoleAssignmentsClient(subscriptionID, ra.conn.token, nil)
+	roleAssignmentsClient, err := ra.conn.newRoleAssignmentsClient(subscriptionID)
 	if err != nil {
 		return nil, "", nil, err
 	}
@@ -130,9 +132,13 @@ func (ra *roleAssignmentResourceGroupBuilder) Grants(ctx context.Context, resour
 	for pagerResourceGroup.More() {
 		page, err := pagerResourceGroup.NextPage(ctx)
 		if err != nil {
-			return nil, "", nil, err
+			return nil, "", nil, armError(err)
 		}
 
+		var (
+			assignments  []*armauthorization.RoleAssignment
+			principalIDs []string
+		)
 		for _, roleAssignment := range page.Value {
 			roleDefinitionID := fmt.Sprintf(
 				"/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s",
@@ -142,8 +148,18 @@ func (ra *roleAssignmentResourceGroupBuilder) Grants(ctx context.Context, resour
 				continue
 			}
 
-			principalType, err := getPrincipalType(ctx, ra.conn, *roleAssignment.Properties.PrincipalID)
-			if err != nil {
+			assignments = append(assignments, roleAssignment)
+			principalIDs = append(principalIDs, *roleAssignment.Properties.PrincipalID)
+		}
+
+		principalTypes, err := getPrincipalTypes(ctx, ra.conn, principalIDs)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		for _, roleAssignment := range assignments {
+			principalType, ok := principalTypes[*roleAssignment.Properties.PrincipalID]
+			if !ok {
 				continue
 			}
 
@@ -183,7 +199,7 @@ func (ra *roleAssignmentResourceGroupBuilder) Grant(ctx context.Context, princip
 	roleId := entitlementIDs[2]
 	principalID := principal.Id.Resource // Object ID of the user, group, or service principal
 	// Initialize the client
-	roleAssignmentsClient, err := armauthorization.NewRoleAssignmentsClient(subscriptionId, ra.conn.token, nil)
+	roleAssignmentsClient, err := ra.conn.newRoleAssignmentsClient(subscriptionId)
 	if err != nil {
 		return nil, err
 	}
@@ -209,19 +225,17 @@ func (ra *roleAssignmentResourceGroupBuilder) Grant(ctx context.Context, princip
 	if err != nil {
 		var azureErr *azcore.ResponseError
 		switch {
-		case errors.As(err, &azureErr):
-			if azureErr.StatusCode == http.StatusConflict {
-				l.Warn(
-					"azure-infrastructure-connector: failed to perform request",
-					zap.Int("StatusCode", azureErr.StatusCode),
-					zap.String("ErrorCode", azureErr.ErrorCode),
-					zap.String("ErrorMsg", azureErr.Error()),
-				)
-
-				// return annotations.New(&v2.GrantAlreadyExists{}), nil
-			}
+		case errors.As(err, &azureErr) && azureErr.StatusCode == http.StatusConflict:
+			l.Warn(
+				"azure-infrastructure-connector: failed to perform request",
+				zap.Int("StatusCode", azureErr.StatusCode),
+				zap.String("ErrorCode", azureErr.ErrorCode),
+				zap.String("ErrorMsg", azureErr.Error()),
+			)
+
+			// return annotations.New(&v2.GrantAlreadyExists{}), nil
 		default:
-			return nil, err
+			return nil, armError(err)
 		}
 	}
 
@@ -281,7 +295,7 @@ func (ra *roleAssignmentResourceGroupBuilder) Revoke(ctx context.Context, grant
 	}
 
 	// Create a RoleAssignmentsClient
-	client, err := armauthorization.NewRoleAssignmentsClient(subscriptionId, ra.conn.token, nil)
+	client, err := ra.conn.newRoleAssignmentsClient(subscriptionId)
 	if err != nil {
 		return nil, err
 	}
@@ -289,7 +303,7 @@ func (ra *roleAssignmentResourceGroupBuilder) Revoke(ctx context.Context, grant
 	// Delete the role assignment
 	roleAssignmentDeleteResponse, err := client.Delete(ctx, scope, roleAssignmentName, nil)
 	if err != nil {
-		return nil, err
+		return nil, armError(err)
 	}
 
 	if roleAssignmentDeleteResponse.ID == nil {
@@ -0,0 +1,200 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultMaxRetries     = 5
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = time.Minute
+
+	// ARM reports the requests left in each throttling bucket, e.g. x-ms-ratelimit-remaining-subscription-reads.
+	rateLimitRemainingHeaderPrefix = "X-Ms-Ratelimit-Remaining-"
+	retryAfterMsHeader             = "X-Ms-Retry-After-Ms"
+)
+
+// retryableStatusCodes are the responses Graph and ARM document as transient. Only idempotent requests are sent
+// again after them, since the service may have processed the request before failing.
+var retryableStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// throttledStatusCodes reject a request before it is processed. Requests that aren't idempotent are only sent
+// again after them when the service says when to come back.
+var throttledStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusServiceUnavailable,
+}
+
+// retryPolicy decides if and when a failed Graph or ARM request is sent again. The same settings are handed to the
+// ARM SDK clients through armClientOptions, so both paths back off the same way.
+// https://learn.microsoft.com/en-us/graph/throttling
+// https://learn.microsoft.com/en-us/azure/azure-resource-manager/management/request-limits-and-throttling
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+func defaultRetryPolicy() retryPolicy {
+	return retryPolicy{
+		maxRetries: defaultMaxRetries,
+		baseDelay:  defaultRetryBaseDelay,
+		maxDelay:   defaultRetryMaxDelay,
+	}
+}
+
+// shouldRetry reports whether a response with statusCode is worth another attempt after attempt retries.
+// idempotent tells whether the request can safely be sent twice, see idempotentRequest.
+func (p retryPolicy) shouldRetry(idempotent bool, statusCode int, header http.Header, attempt int) bool {
+	return attempt < p.maxRetries && retryableResponse(idempotent, statusCode, header)
+}
+
+// shouldRetryError reports whether a request that got no response at all is worth another attempt. Only timeouts
+// of idempotent requests are.
+func (p retryPolicy) shouldRetryError(idempotent bool, err error, attempt int) bool {
+	return attempt < p.maxRetries && idempotent && isTimeout(err)
+}
+
+func retryableResponse(idempotent bool, statusCode int, header http.Header) bool {
+	if idempotent {
+		return slices.Contains(retryableStatusCodes, statusCode)
+	}
+
+	_, ok := retryAfter(header)
+	return ok && slices.Contains(throttledStatusCodes, statusCode)
+}
+
+// idempotentRequest reports whether a request can safely be sent twice. Besides GET, HEAD, PUT and DELETE, that
+// covers the POST endpoints that only read: Graph JSON batches, which the connector only fills with GET requests,
+// and Resource Graph queries.
+func idempotentRequest(method string, u *url.URL) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		p := strings.ToLower(u.Path)
+		return strings.HasSuffix(p, "/$batch") || strings.HasSuffix(p, strings.ToLower(resourceGraphPath))
+	default:
+		return false
+	}
+}
+
+// isTimeout reports whether err is a transport timeout, either mapped onto DeadlineExceeded by uhttp or
+// returned as is to the ARM SDK.
+func isTimeout(err error) bool {
+	if status.Code(err) == codes.DeadlineExceeded || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// delay returns how long to wait before retry attempt. A Retry-After sent by the service wins. Otherwise the
+// delay grows exponentially with full jitter, and jumps to the top of the current range once ARM reports an
+// exhausted throttling bucket.
+func (p retryPolicy) delay(header http.Header, attempt int) time.Duration {
+	if wait, ok := retryAfter(header); ok {
+		return min(wait, p.maxDelay)
+	}
+
+	backoff := p.maxDelay
+	if attempt < 32 {
+		backoff = min(p.baseDelay<<attempt, p.maxDelay)
+	}
+	if backoff <= 0 {
+		return 0
+	}
+
+	if rateLimitExhausted(header) {
+		return backoff
+	}
+
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// armRetryOptions translates the policy into the azcore retry options used by the ARM SDK clients.
+func (p retryPolicy) armRetryOptions() policy.RetryOptions {
+	maxRetries := int32(p.maxRetries)
+	if maxRetries == 0 {
+		// azcore treats zero as "use the default", disabling retries takes a negative value.
+		maxRetries = -1
+	}
+
+	return policy.RetryOptions{
+		MaxRetries:    maxRetries,
+		RetryDelay:    p.baseDelay,
+		MaxRetryDelay: p.maxDelay,
+		ShouldRetry: func(resp *http.Response, err error) bool {
+			// The ARM clients only send GET, PUT and DELETE requests, unless told otherwise by the response.
+			if resp == nil {
+				return isTimeout(err)
+			}
+
+			idempotent := resp.Request == nil || idempotentRequest(resp.Request.Method, resp.Request.URL)
+			return retryableResponse(idempotent, resp.StatusCode, resp.Header)
+		},
+	}
+}
+
+// retryAfter reads the server requested delay from x-ms-retry-after-ms or Retry-After, which is either
+// a number of seconds or an HTTP date.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	if v := header.Get(retryAfterMsHeader); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms >= 0 {
+			return time.Duration(ms) * time.Millisecond, true
+		}
+	}
+
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+
+	return 0, false
+}
+
+// rateLimitExhausted reports whether any of ARM's x-ms-ratelimit-remaining-* counters has run out.
+func rateLimitExhausted(header http.Header) bool {
+	for key, values := range header {
+		if !strings.HasPrefix(http.CanonicalHeaderKey(key), rateLimitRemainingHeaderPrefix) {
+			continue
+		}
+
+		for _, v := range values {
+			if remaining, err := strconv.Atoi(v); err == nil && remaining <= 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
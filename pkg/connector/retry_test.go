@@ -0,0 +1,131 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	uhttp "github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := retryPolicy{maxRetries: 3, baseDelay: time.Second, maxDelay: 10 * time.Second}
+
+	require.Equal(t, 2*time.Second, p.delay(http.Header{"Retry-After": []string{"2"}}, 0))
+	require.Equal(t, 1500*time.Millisecond, p.delay(http.Header{"X-Ms-Retry-After-Ms": []string{"1500"}}, 0))
+	require.Equal(t, 10*time.Second, p.delay(http.Header{"Retry-After": []string{"120"}}, 0))
+
+	for attempt := 0; attempt < 6; attempt++ {
+		wait := p.delay(nil, attempt)
+		upper := min(time.Second<<attempt, 10*time.Second)
+		require.GreaterOrEqual(t, wait, upper/2)
+		require.LessOrEqual(t, wait, upper)
+	}
+
+	exhausted := http.Header{"X-Ms-Ratelimit-Remaining-Subscription-Reads": []string{"0"}}
+	require.Equal(t, 4*time.Second, p.delay(exhausted, 2))
+
+	retryAfter := http.Header{"Retry-After": []string{"1"}}
+	require.True(t, p.shouldRetry(true, http.StatusTooManyRequests, nil, 2))
+	require.False(t, p.shouldRetry(true, http.StatusTooManyRequests, nil, 3))
+	require.False(t, p.shouldRetry(true, http.StatusBadRequest, nil, 0))
+	require.True(t, p.shouldRetry(true, http.StatusBadGateway, nil, 0))
+	require.False(t, p.shouldRetry(false, http.StatusInternalServerError, retryAfter, 0))
+	require.False(t, p.shouldRetry(false, http.StatusTooManyRequests, nil, 0))
+	require.True(t, p.shouldRetry(false, http.StatusTooManyRequests, retryAfter, 0))
+	require.True(t, p.shouldRetry(false, http.StatusServiceUnavailable, retryAfter, 0))
+
+	timeout := status.Error(codes.DeadlineExceeded, "i/o timeout")
+	require.True(t, p.shouldRetryError(true, timeout, 0))
+	require.False(t, p.shouldRetryError(false, timeout, 0))
+	require.False(t, p.shouldRetryError(true, timeout, 3))
+	require.False(t, p.shouldRetryError(true, status.Error(codes.Unavailable, "connection reset"), 0))
+}
+
+func TestIdempotentRequest(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		want   bool
+	}{
+		{http.MethodGet, "https://graph.microsoft.com/v1.0/users", true},
+		{http.MethodDelete, "https://graph.microsoft.com/v1.0/groups/g1/members/u1/$ref", true},
+		{http.MethodPut, "https://management.azure.com/subscriptions/s/providers/Microsoft.Authorization/roleAssignments/a", true},
+		{http.MethodPost, "https://graph.microsoft.com/v1.0/$batch", true},
+		{http.MethodPost, "https://management.azure.com/providers/Microsoft.ResourceGraph/resources", true},
+		{http.MethodPost, "https://graph.microsoft.com/v1.0/groups/g1/members/$ref", false},
+		{http.MethodPatch, "https://graph.microsoft.com/v1.0/users/u1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, idempotentRequest(tt.method, u))
+		})
+	}
+}
+
+func TestDoRequestRetries(t *testing.T) {
+	calls := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		switch req.URL.Path {
+		case "/v1.0/throttled":
+			if calls == 1 {
+				resp, err := jsonResponse(http.StatusTooManyRequests, map[string]interface{}{
+					"error": map[string]string{"code": "TooManyRequests"},
+				})
+				resp.Header.Set("Retry-After", "0")
+				return resp, err
+			}
+			return jsonResponse(http.StatusOK, map[string]string{"id": "1"})
+		case "/v1.0/failing":
+			return jsonResponse(http.StatusInternalServerError, map[string]interface{}{
+				"error": map[string]string{"code": "InternalServerError"},
+			})
+		default:
+			return jsonResponse(http.StatusNotFound, map[string]interface{}{
+				"error": map[string]string{"code": "Request_ResourceNotFound"},
+			})
+		}
+	})
+
+	c := &Connector{
+		token:      staticToken{},
+		httpClient: uhttp.NewBaseHttpClient(&http.Client{Transport: transport}),
+		retry:      retryPolicy{maxRetries: 2, baseDelay: time.Millisecond, maxDelay: time.Millisecond},
+	}
+
+	resp := &struct {
+		ID string `json:"id"`
+	}{}
+	require.NoError(t, c.query(context.Background(), graphReadScopes, http.MethodGet, c.buildURL("throttled", nil), nil, resp))
+	require.Equal(t, 2, calls)
+	require.Equal(t, "1", resp.ID)
+
+	calls = 0
+	err := c.query(context.Background(), graphReadScopes, http.MethodGet, c.buildURL("missing", nil), nil, resp)
+	require.Equal(t, 1, calls)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.ErrorContains(t, err, "Request_ResourceNotFound")
+
+	var httpErr *HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	require.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+
+	// Server errors are retried for reads, but a POST may already have been applied.
+	calls = 0
+	require.Error(t, c.query(context.Background(), graphReadScopes, http.MethodGet, c.buildURL("failing", nil), nil, resp))
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	require.Error(t, c.query(context.Background(), graphReadScopes, http.MethodPost, c.buildURL("failing", nil), nil, resp))
+	require.Equal(t, 1, calls)
+}
@@ -5,41 +5,78 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	azcore "github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	uuid "github.com/google/uuid"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	zap "go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// roleDefinitionsAPIVersion is the Microsoft.Authorization API version used to list role definitions.
+const roleDefinitionsAPIVersion = "2022-04-01"
+
 type roleBuilder struct {
 	conn                  *Connector
 	roleDefinitionsClient *armauthorization.RoleDefinitionsClient
+	// state is started over every sync, so a connector running in service mode picks up role changes.
+	state *syncCache[*roleSyncState]
+}
+
+// roleSyncState is what the role builder caches during a sync.
+type roleSyncState struct {
+	mu sync.RWMutex
 	// key subscriptionID
 	// value array of role assignments for that subscriptionID
 	subIdRoleAssignmentsCache map[string][]*armauthorization.RoleAssignment
-	mu                        sync.RWMutex
+	// assignedRolesCache holds the result of assignedRoleIDs per subscription.
+	assignedRolesCache map[string]map[string]bool
+	// eligibilityUnavailable is set once eligible role assignments can't be read, usually because the tenant has
+	// no Entra ID P2 license or the connector lacks access to them.
+	eligibilityUnavailable atomic.Bool
+}
+
+func newRoleSyncState(context.Context) (*roleSyncState, error) {
+	return &roleSyncState{
+		subIdRoleAssignmentsCache: make(map[string][]*armauthorization.RoleAssignment),
+		assignedRolesCache:        make(map[string]map[string]bool),
+	}, nil
 }
 
-func (r *roleBuilder) cacheGet(id string) ([]*armauthorization.RoleAssignment, bool) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	value, ok := r.subIdRoleAssignmentsCache[id]
+// syncState returns the state of the current sync.
+func (r *roleBuilder) syncState(ctx context.Context) *roleSyncState {
+	// newRoleSyncState never fails.
+	state, _ := r.state.get(ctx, newRoleSyncState)
+	return state
+}
+
+func (r *roleBuilder) cacheGet(ctx context.Context, id string) ([]*armauthorization.RoleAssignment, bool) {
+	state := r.syncState(ctx)
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	value, ok := state.subIdRoleAssignmentsCache[id]
 	return value, ok
 }
 
-func (r *roleBuilder) cacheSet(id string, value []*armauthorization.RoleAssignment) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.subIdRoleAssignmentsCache[id] = value
+func (r *roleBuilder) cacheSet(ctx context.Context, id string, value []*armauthorization.RoleAssignment) {
+	state := r.syncState(ctx)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.subIdRoleAssignmentsCache[id] = value
 }
 
 func (r *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -52,31 +89,102 @@ func (r *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 	}
 	var rv []*v2.Resource
 	subscriptionID := parentResourceID.Resource
+	ok, err := r.conn.subscriptionIncluded(ctx, subscriptionID)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !ok {
+		return nil, "", nil, nil
+	}
 
-	scope := fmt.Sprintf("/subscriptions/%s", subscriptionID)
-	// Get the list of role definitions
-	pagerRoles := r.roleDefinitionsClient.NewListPager(scope, nil)
-	for pagerRoles.More() {
-		resp, err := pagerRoles.NextPage(ctx)
+	var assigned map[string]bool
+	if r.conn.assignedRoles.enabled {
+		assigned, err = r.assignedRoleIDs(ctx, subscriptionID)
 		if err != nil {
 			return nil, "", nil, err
 		}
+	}
 
-		// Iterate over role definitions
-		for _, role := range resp.Value {
-			rs, err := roleResource(ctx, role, &v2.ResourceId{
-				ResourceType: subscriptionsResourceType.Id,
-				Resource:     StringValue(&subscriptionID),
-			})
+	// Prefetched role definitions are listed in one page. Without them, or when the subscription failed to
+	// prefetch, they are paged from ARM.
+	var (
+		roles      []*armauthorization.RoleDefinition
+		prefetched bool
+	)
+	switch {
+	case r.conn.useResourceGraph():
+		snapshot, err := r.conn.resourceGraphSnapshot(ctx)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		roles, prefetched = snapshot.roleDefinitions[subscriptionID], true
+	case r.conn.useSubscriptionScan():
+		scan, err := r.conn.subscriptionScanSnapshot(ctx)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		roles, prefetched = scan.roleDefinitions[subscriptionID]
+	}
+
+	if prefetched {
+		for _, role := range roles {
+			if assigned != nil && !r.includeRole(role, assigned) {
+				continue
+			}
+
+			rs, err := roleResource(ctx, role, parentResourceID)
 			if err != nil {
 				return nil, "", nil, err
 			}
 
 			rv = append(rv, rs)
 		}
+
+		return rv, "", nil, nil
 	}
 
-	return rv, "", nil, nil
+	bag, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: roleResourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	reqURL := bag.PageToken()
+	if reqURL == "" {
+		v := url.Values{}
+		v.Set("api-version", roleDefinitionsAPIVersion)
+		reqURL = r.conn.buildARMURL(path.Join("subscriptions", subscriptionID, "providers/Microsoft.Authorization/roleDefinitions"), v)
+	}
+
+	// Get a page of role definitions
+	resp := &armauthorization.RoleDefinitionListResult{}
+	err = r.conn.queryUncached(ctx, armScopes, http.MethodGet, reqURL, nil, resp)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// Iterate over role definitions
+	for _, role := range resp.Value {
+		if assigned != nil && !r.includeRole(role, assigned) {
+			continue
+		}
+
+		rs, err := roleResource(ctx, role, &v2.ResourceId{
+			ResourceType: subscriptionsResourceType.Id,
+			Resource:     StringValue(&subscriptionID),
+		})
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		rv = append(rv, rs)
+	}
+
+	pageToken, err := bag.NextToken(StringValue(resp.NextLink))
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, pageToken, nil, nil
 }
 
 func (r *roleBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
@@ -116,8 +224,12 @@ func (r *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 		return nil, "", nil, err
 	}
 
-	assignments, _ := r.cacheGet(subscriptionID)
-	for _, assignment := range assignments {
+	var (
+		assignments  []*armauthorization.RoleAssignment
+		principalIDs []string
+	)
+	cached, _ := r.cacheGet(ctx, subscriptionID)
+	for _, assignment := range cached {
 		roleDefinitionID := fmt.Sprintf(
 			"/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s",
 			subscriptionID,
@@ -126,8 +238,18 @@ func (r *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 			continue
 		}
 
-		principalType, err := getPrincipalType(ctx, r.conn, *assignment.Properties.PrincipalID)
-		if err != nil {
+		assignments = append(assignments, assignment)
+		principalIDs = append(principalIDs, *assignment.Properties.PrincipalID)
+	}
+
+	principalTypes, err := getPrincipalTypes(ctx, r.conn, principalIDs)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	for _, assignment := range assignments {
+		principalType, ok := principalTypes[*assignment.Properties.PrincipalID]
+		if !ok {
 			continue
 		}
 
@@ -165,7 +287,7 @@ func (r *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitle
 	principalID := principal.Id.Resource // Object ID of the user, group, or service principal
 
 	// Initialize the client
-	roleAssignmentsClient, err := armauthorization.NewRoleAssignmentsClient(subscriptionId, r.conn.token, nil)
+	roleAssignmentsClient, err := r.conn.newRoleAssignmentsClient(subscriptionId)
 	if err != nil {
 		return nil, err
 	}
@@ -189,17 +311,15 @@ func (r *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitle
 	if err != nil {
 		var azureErr *azcore.ResponseError
 		switch {
-		case errors.As(err, &azureErr):
-			if azureErr.StatusCode == http.StatusConflict {
-				l.Warn(
-					"azure-infrastructure-connector: failed to perform request",
-					zap.Int("StatusCode", azureErr.StatusCode),
-					zap.String("ErrorCode", azureErr.ErrorCode),
-					zap.String("ErrorMsg", azureErr.Error()),
-				)
-			}
+		case errors.As(err, &azureErr) && azureErr.StatusCode == http.StatusConflict:
+			l.Warn(
+				"azure-infrastructure-connector: failed to perform request",
+				zap.Int("StatusCode", azureErr.StatusCode),
+				zap.String("ErrorCode", azureErr.ErrorCode),
+				zap.String("ErrorMsg", azureErr.Error()),
+			)
 		default:
-			return nil, err
+			return nil, armError(err)
 		}
 	}
 
@@ -258,7 +378,7 @@ func (r *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.
 	}
 
 	// Create a RoleAssignmentsClient
-	roleAssignmentsClient, err := armauthorization.NewRoleAssignmentsClient(subscriptionId, r.conn.token, nil)
+	roleAssignmentsClient, err := r.conn.newRoleAssignmentsClient(subscriptionId)
 	if err != nil {
 		return nil, err
 	}
@@ -266,7 +386,7 @@ func (r *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.
 	// Delete the role assignment
 	roleAssignmentResponse, err := roleAssignmentsClient.Delete(ctx, scope, roleAssignmentName, nil)
 	if err != nil {
-		return nil, err
+		return nil, armError(err)
 	}
 
 	if roleAssignmentResponse.ID == nil {
@@ -281,36 +401,232 @@ func (r *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.
 	return nil, nil
 }
 
+// Create provisions a custom role definition in the parent subscription. Permissions and
+// assignable scopes are read from the role trait profile.
+// https://learn.microsoft.com/en-us/rest/api/authorization/role-definitions/create-or-update
+func (r *roleBuilder) Create(ctx context.Context, resource *v2.Resource) (*v2.Resource, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	parentResourceID := resource.ParentResourceId
+	if parentResourceID == nil || parentResourceID.ResourceType != subscriptionsResourceType.Id {
+		return nil, nil, errors.New("azure-infrastructure-connector: custom roles must be created in a subscription")
+	}
+
+	if IsEmpty(resource.DisplayName) {
+		return nil, nil, errors.New("azure-infrastructure-connector: role name is required")
+	}
+
+	roleTrait, err := rs.GetRoleTrait(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profile := roleTrait.GetProfile()
+	subscriptionID := parentResourceID.Resource
+	scope := fmt.Sprintf("/subscriptions/%s", subscriptionID)
+	actions := getProfileStringList(profile, "actions")
+	dataActions := getProfileStringList(profile, "data_actions")
+	if len(actions) == 0 && len(dataActions) == 0 {
+		return nil, nil, errors.New("azure-infrastructure-connector: a custom role needs at least one action or data action")
+	}
+
+	assignableScopes := getProfileStringList(profile, "assignable_scopes")
+	if len(assignableScopes) == 0 {
+		assignableScopes = []string{scope}
+	}
+
+	description := resource.Description
+	if profileDescription, ok := rs.GetProfileStringValue(profile, "description"); ok && !IsEmpty(profileDescription) {
+		description = profileDescription
+	}
+
+	roleName := resource.DisplayName
+	roleType := "CustomRole"
+	roleDefinition := armauthorization.RoleDefinition{
+		Properties: &armauthorization.RoleDefinitionProperties{
+			RoleName:    &roleName,
+			Description: &description,
+			RoleType:    &roleType,
+			Permissions: []*armauthorization.Permission{
+				{
+					Actions:        stringsToPtrs(actions),
+					NotActions:     stringsToPtrs(getProfileStringList(profile, "not_actions")),
+					DataActions:    stringsToPtrs(dataActions),
+					NotDataActions: stringsToPtrs(getProfileStringList(profile, "not_data_actions")),
+				},
+			},
+			AssignableScopes: stringsToPtrs(assignableScopes),
+		},
+	}
+
+	// The role definition name must be a new GUID.
+	roleDefinitionID := uuid.New().String()
+	resp, err := r.roleDefinitionsClient.CreateOrUpdate(ctx, scope, roleDefinitionID, roleDefinition, nil)
+	if err != nil {
+		return nil, nil, armError(err)
+	}
+
+	l.Info("Custom role definition has been created.",
+		zap.String("ID", StringValue(resp.ID)),
+		zap.String("RoleName", roleName),
+	)
+
+	rv, err := roleResource(ctx, &resp.RoleDefinition, parentResourceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rv, nil, nil
+}
+
+// Delete removes a custom role definition. Built-in roles are refused. Azure refuses to delete roles that are
+// still assigned, so existing assignments at every assignable scope are looked up first and reported back to the
+// caller.
+// https://learn.microsoft.com/en-us/rest/api/authorization/role-definitions/delete
+func (r *roleBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	entitlementIDs := strings.Split(resourceId.Resource, ":")
+	if len(entitlementIDs) != 2 {
+		return nil, fmt.Errorf("%s", invalidRoleID)
+	}
+
+	roleID := entitlementIDs[0]
+	subscriptionID := entitlementIDs[1]
+	scope := fmt.Sprintf("/subscriptions/%s", subscriptionID)
+	definition, err := r.roleDefinitionsClient.Get(ctx, scope, roleID, nil)
+	if err != nil {
+		if err = armError(err); status.Code(err) == codes.NotFound {
+			l.Info("Role definition to delete not found; treating as successful because the end state is achieved",
+				zap.String("roleID", roleID),
+				zap.String("scope", scope),
+			)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if definition.Properties == nil || StringValue(definition.Properties.RoleType) != "CustomRole" {
+		return nil, fmt.Errorf("azure-infrastructure-connector: role %s is not a custom role and cannot be deleted", roleID)
+	}
+
+	var assignableScopes []string
+	for _, assignableScope := range definition.Properties.AssignableScopes {
+		if !IsEmpty(StringValue(assignableScope)) {
+			assignableScopes = append(assignableScopes, StringValue(assignableScope))
+		}
+	}
+	if len(assignableScopes) == 0 {
+		assignableScopes = []string{scope}
+	}
+
+	var blockingAssignments []string
+	for _, assignableScope := range assignableScopes {
+		assignmentIDs, err := r.listRoleAssignmentIDs(ctx, subscriptionID, assignableScope, roleID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range assignmentIDs {
+			if !slices.Contains(blockingAssignments, id) {
+				blockingAssignments = append(blockingAssignments, id)
+			}
+		}
+	}
+
+	if len(blockingAssignments) > 0 {
+		return nil, fmt.Errorf("azure-infrastructure-connector: role %s is still assigned and cannot be deleted, remove these role assignments first: %s",
+			roleID,
+			strings.Join(blockingAssignments, ", "),
+		)
+	}
+
+	resp, err := r.roleDefinitionsClient.Delete(ctx, scope, roleID, nil)
+	if err != nil {
+		return nil, armError(err)
+	}
+
+	if resp.ID == nil {
+		l.Info("Role definition to delete not found; treating as successful because the end state is achieved",
+			zap.String("roleID", roleID),
+			zap.String("scope", scope),
+		)
+		return nil, nil
+	}
+
+	l.Info("Custom role definition successfully deleted.",
+		zap.String("ID", *resp.ID),
+	)
+
+	return nil, nil
+}
+
+// listRoleAssignmentIDs returns the IDs of every assignment of the role definition at or below scope.
+func (r *roleBuilder) listRoleAssignmentIDs(ctx context.Context, subscriptionID, scope, roleID string) ([]string, error) {
+	roleAssignmentsClient, err := r.conn.newRoleAssignmentsClient(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []string
+	pager := roleAssignmentsClient.NewListForScopePager(scope, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, armError(err)
+		}
+
+		for _, assignment := range page.Value {
+			if assignment.Properties == nil || !strings.EqualFold(path.Base(StringValue(assignment.Properties.RoleDefinitionID)), roleID) {
+				continue
+			}
+
+			rv = append(rv, StringValue(assignment.ID))
+		}
+	}
+
+	return rv, nil
+}
+
 func newRoleBuilder(c *Connector) *roleBuilder {
 	return &roleBuilder{
-		conn:                      c,
-		roleDefinitionsClient:     c.roleDefinitionsClient,
-		subIdRoleAssignmentsCache: make(map[string][]*armauthorization.RoleAssignment),
+		conn:                  c,
+		roleDefinitionsClient: c.roleDefinitionsClient,
+		state:                 newSyncCache[*roleSyncState](c.syncEpoch),
 	}
 }
 
 func (r *roleBuilder) cacheRoleAssignments(ctx context.Context, subscriptionID string) error {
-	if _, ok := r.cacheGet(subscriptionID); ok {
+	if _, ok := r.cacheGet(ctx, subscriptionID); ok {
 		return nil
 	}
 
-	// Create a Role Assignments Client
-	roleAssignmentsClient, err := armauthorization.NewRoleAssignmentsClient(subscriptionID, r.conn.token, nil)
-	if err != nil {
-		return err
+	if r.conn.useResourceGraph() {
+		snapshot, err := r.conn.resourceGraphSnapshot(ctx)
+		if err != nil {
+			return err
+		}
+
+		r.cacheSet(ctx, subscriptionID, snapshot.roleAssignments[subscriptionID])
+		return nil
 	}
 
-	// Iterate over all role assignments
-	pagerRoles := roleAssignmentsClient.NewListPager(nil)
-	for pagerRoles.More() {
-		page, err := pagerRoles.NextPage(ctx)
+	if r.conn.useSubscriptionScan() {
+		scan, err := r.conn.subscriptionScanSnapshot(ctx)
 		if err != nil {
 			return err
 		}
 
-		assignments, _ := r.cacheGet(subscriptionID)
-		r.cacheSet(subscriptionID, append(assignments, page.Value...))
+		if assignments, ok := scan.roleAssignments[subscriptionID]; ok {
+			r.cacheSet(ctx, subscriptionID, assignments)
+			return nil
+		}
+	}
+
+	// The cache is only set once every page was read, so concurrent readers never see a partial list.
+	assignments, err := listRoleAssignments(ctx, r.conn, subscriptionID)
+	if err != nil {
+		return err
 	}
+	r.cacheSet(ctx, subscriptionID, assignments)
 
 	return nil
 }
@@ -0,0 +1,291 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	armsubscription "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/subscription/armsubscription"
+)
+
+// managementGroupsAPIVersion is the Microsoft.Management API version used to list management group descendants.
+const managementGroupsAPIVersion = "2020-05-01"
+
+// scopeFilter limits the subscriptions and resource groups the connector syncs. IDs are compared case-insensitively
+// and names are matched against glob patterns, also case-insensitively. An empty list doesn't filter.
+type scopeFilter struct {
+	subscriptionIDs           map[string]bool
+	excludedSubscriptionIDs   map[string]bool
+	subscriptionNames         []string
+	excludedSubscriptionNames []string
+	managementGroups          []string
+	resourceGroups            []string
+	excludedResourceGroups    []string
+	// resolved holds what had to be read from ARM to apply the subscription filters, once per sync. It is only
+	// set when subscriptions are filtered.
+	resolved *resolvedScope
+}
+
+type resolvedScope struct {
+	managementGroupSubscriptions *syncCache[map[string]bool]
+	included                     *syncCache[map[string]bool]
+}
+
+func newResolvedScope(epoch *atomic.Uint64) *resolvedScope {
+	return &resolvedScope{
+		managementGroupSubscriptions: newSyncCache[map[string]bool](epoch),
+		included:                     newSyncCache[map[string]bool](epoch),
+	}
+}
+
+// WithSubscriptionIDs only syncs the subscriptions with these IDs, unless their name matches WithSubscriptionNames.
+func WithSubscriptionIDs(ids ...string) Option {
+	return func(c *Connector) error {
+		c.filter.subscriptionIDs = addLowered(c.filter.subscriptionIDs, ids)
+		return nil
+	}
+}
+
+// WithExcludedSubscriptionIDs skips the subscriptions with these IDs.
+func WithExcludedSubscriptionIDs(ids ...string) Option {
+	return func(c *Connector) error {
+		c.filter.excludedSubscriptionIDs = addLowered(c.filter.excludedSubscriptionIDs, ids)
+		return nil
+	}
+}
+
+// WithSubscriptionNames only syncs the subscriptions whose display name matches one of the glob patterns, unless
+// their ID is listed by WithSubscriptionIDs.
+func WithSubscriptionNames(patterns ...string) Option {
+	return func(c *Connector) error {
+		return appendPatterns(&c.filter.subscriptionNames, patterns)
+	}
+}
+
+// WithExcludedSubscriptionNames skips the subscriptions whose display name matches one of the glob patterns, e.g.
+// "sandbox-*".
+func WithExcludedSubscriptionNames(patterns ...string) Option {
+	return func(c *Connector) error {
+		return appendPatterns(&c.filter.excludedSubscriptionNames, patterns)
+	}
+}
+
+// WithManagementGroups only syncs the subscriptions below one of these management groups, at any depth.
+func WithManagementGroups(ids ...string) Option {
+	return func(c *Connector) error {
+		for _, id := range ids {
+			if id = strings.TrimSpace(id); id != "" {
+				c.filter.managementGroups = append(c.filter.managementGroups, id)
+			}
+		}
+		return nil
+	}
+}
+
+// WithResourceGroups only syncs the resource groups whose name matches one of the glob patterns. Role assignments
+// made inside other resource groups are skipped as well.
+func WithResourceGroups(patterns ...string) Option {
+	return func(c *Connector) error {
+		return appendPatterns(&c.filter.resourceGroups, patterns)
+	}
+}
+
+// WithExcludedResourceGroups skips the resource groups whose name matches one of the glob patterns, along with the
+// role assignments made inside them.
+func WithExcludedResourceGroups(patterns ...string) Option {
+	return func(c *Connector) error {
+		return appendPatterns(&c.filter.excludedResourceGroups, patterns)
+	}
+}
+
+func addLowered(set map[string]bool, values []string) map[string]bool {
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if set == nil {
+			set = make(map[string]bool)
+		}
+		set[v] = true
+	}
+
+	return set
+}
+
+func appendPatterns(dst *[]string, patterns []string) error {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("baton-azure-infrastructure: invalid pattern %q: %w", pattern, err)
+		}
+		*dst = append(*dst, pattern)
+	}
+
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filtersSubscriptions reports whether any subscription filter is set.
+func (f *scopeFilter) filtersSubscriptions() bool {
+	return len(f.subscriptionIDs) > 0 || len(f.excludedSubscriptionIDs) > 0 ||
+		len(f.subscriptionNames) > 0 || len(f.excludedSubscriptionNames) > 0 ||
+		len(f.managementGroups) > 0
+}
+
+// includeSubscription reports whether the subscription passes the subscription filters.
+func (d *Connector) includeSubscription(ctx context.Context, s *armsubscription.Subscription) (bool, error) {
+	f := &d.filter
+	if !f.filtersSubscriptions() {
+		return true, nil
+	}
+
+	id := strings.ToLower(StringValue(s.SubscriptionID))
+	name := StringValue(s.DisplayName)
+	if f.excludedSubscriptionIDs[id] || matchAny(f.excludedSubscriptionNames, name) {
+		return false, nil
+	}
+	if (len(f.subscriptionIDs) > 0 || len(f.subscriptionNames) > 0) && !f.subscriptionIDs[id] && !matchAny(f.subscriptionNames, name) {
+		return false, nil
+	}
+	if len(f.managementGroups) == 0 {
+		return true, nil
+	}
+
+	subscriptions, err := d.managementGroupSubscriptions(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return subscriptions[id], nil
+}
+
+// subscriptionIncluded reports whether the subscription with the given ID passes the subscription filters. Names
+// and management groups aren't known from the ID alone, so the included subscriptions are listed once.
+func (d *Connector) subscriptionIncluded(ctx context.Context, subscriptionID string) (bool, error) {
+	f := &d.filter
+	if !f.filtersSubscriptions() || f.resolved == nil {
+		return true, nil
+	}
+
+	included, err := f.resolved.included.get(ctx, func(ctx context.Context) (map[string]bool, error) {
+		subscriptionIDs, err := d.listSubscriptionIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return addLowered(make(map[string]bool), subscriptionIDs), nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return included[strings.ToLower(subscriptionID)], nil
+}
+
+type managementGroupDescendant struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type managementGroupDescendantsList struct {
+	Value    []*managementGroupDescendant `json:"value"`
+	NextLink string                       `json:"nextLink"`
+}
+
+// managementGroupSubscriptions returns the IDs of the subscriptions below the configured management groups.
+// https://learn.microsoft.com/en-us/rest/api/managementgroups/management-groups/get-descendants
+func (d *Connector) managementGroupSubscriptions(ctx context.Context) (map[string]bool, error) {
+	return d.filter.resolved.managementGroupSubscriptions.get(ctx, d.listManagementGroupSubscriptions)
+}
+
+func (d *Connector) listManagementGroupSubscriptions(ctx context.Context) (map[string]bool, error) {
+	rv := make(map[string]bool)
+	for _, managementGroup := range d.filter.managementGroups {
+		v := url.Values{}
+		v.Set("api-version", managementGroupsAPIVersion)
+		reqURL := d.buildARMURL(path.Join("providers/Microsoft.Management/managementGroups", managementGroup, "descendants"), v)
+		for reqURL != "" {
+			resp := &managementGroupDescendantsList{}
+			err := d.query(ctx, armScopes, http.MethodGet, reqURL, nil, resp)
+			if err != nil {
+				return nil, fmt.Errorf("baton-azure-infrastructure: failed to list subscriptions of management group %s: %w", managementGroup, err)
+			}
+
+			for _, descendant := range resp.Value {
+				if strings.HasSuffix(strings.ToLower(descendant.Type), "/subscriptions") {
+					rv[strings.ToLower(descendant.Name)] = true
+				}
+			}
+			reqURL = resp.NextLink
+		}
+	}
+
+	return rv, nil
+}
+
+// includeResourceGroup reports whether the resource group passes the resource group filters.
+func (d *Connector) includeResourceGroup(name string) bool {
+	f := &d.filter
+	if matchAny(f.excludedResourceGroups, name) {
+		return false
+	}
+
+	return len(f.resourceGroups) == 0 || matchAny(f.resourceGroups, name)
+}
+
+// includeRoleAssignment reports whether the role assignment isn't made inside a filtered resource group.
+func (d *Connector) includeRoleAssignment(assignment *armauthorization.RoleAssignment) bool {
+	if assignment.Properties == nil {
+		return true
+	}
+
+	resourceGroup := resourceGroupOfScope(StringValue(assignment.Properties.Scope))
+	return resourceGroup == "" || d.includeResourceGroup(resourceGroup)
+}
+
+// filterRoleAssignments drops the role assignments made inside filtered resource groups.
+func (d *Connector) filterRoleAssignments(assignments []*armauthorization.RoleAssignment) []*armauthorization.RoleAssignment {
+	if len(d.filter.resourceGroups) == 0 && len(d.filter.excludedResourceGroups) == 0 {
+		return assignments
+	}
+
+	rv := make([]*armauthorization.RoleAssignment, 0, len(assignments))
+	for _, assignment := range assignments {
+		if d.includeRoleAssignment(assignment) {
+			rv = append(rv, assignment)
+		}
+	}
+
+	return rv
+}
+
+// resourceGroupOfScope returns the resource group an ARM scope is in, or "" for scopes above resource groups.
+func resourceGroupOfScope(scope string) string {
+	segments := strings.Split(strings.Trim(scope, "/"), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if strings.EqualFold(segments[i], "resourceGroups") {
+			return segments[i+1]
+		}
+	}
+
+	return ""
+}
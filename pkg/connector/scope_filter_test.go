@@ -0,0 +1,136 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	productionSubscriptionID = "aaaaaaaa-0000-0000-0000-000000000001"
+	sandboxSubscriptionID    = "aaaaaaaa-0000-0000-0000-000000000002"
+	sharedSubscriptionID     = "aaaaaaaa-0000-0000-0000-000000000003"
+)
+
+func newFilterTenant(t *testing.T) *fakeAzure {
+	f := newFakeAzure(t)
+	f.addUser("u1", "User u1")
+	f.addUser("u2", "User u2")
+	f.addNamedSubscription(productionSubscriptionID, "Production", "app-rg", "sandbox-rg")
+	f.addNamedSubscription(sandboxSubscriptionID, "Sandbox 1", "rg")
+	f.addNamedSubscription(sharedSubscriptionID, "Shared", "rg")
+	f.addManagementGroup("corp", productionSubscriptionID, sharedSubscriptionID)
+	for _, id := range []string{productionSubscriptionID, sandboxSubscriptionID, sharedSubscriptionID} {
+		f.addRoleDefinition(id, fakeRoleID, "Reader")
+	}
+
+	return f
+}
+
+func TestSubscriptionFilters(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "none",
+			want: []string{productionSubscriptionID, sandboxSubscriptionID, sharedSubscriptionID},
+		},
+		{
+			name: "excluded names",
+			opts: []Option{WithExcludedSubscriptionNames("SANDBOX*")},
+			want: []string{productionSubscriptionID, sharedSubscriptionID},
+		},
+		{
+			name: "IDs or names",
+			opts: []Option{WithSubscriptionIDs(sandboxSubscriptionID), WithSubscriptionNames("shared")},
+			want: []string{sandboxSubscriptionID, sharedSubscriptionID},
+		},
+		{
+			name: "management group without excluded IDs",
+			opts: []Option{WithManagementGroups("corp"), WithExcludedSubscriptionIDs(sharedSubscriptionID)},
+			want: []string{productionSubscriptionID},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := newFilterTenant(t).connector(t, tc.opts...)
+
+			subscriptions := listAll(t, newSubscriptionBuilder(c), nil)
+			require.Equal(t, tc.want, resourceIDs(subscriptions))
+
+			subscriptionIDs, err := c.listSubscriptionIDs(ctx)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, subscriptionIDs)
+
+			// Roles and resource groups of filtered subscriptions aren't listed, even when asked for directly.
+			for _, id := range []string{productionSubscriptionID, sandboxSubscriptionID, sharedSubscriptionID} {
+				parent := &v2.ResourceId{ResourceType: subscriptionsResourceType.Id, Resource: id}
+				roles := listAll(t, newRoleBuilder(c), parent)
+				resourceGroups := listAll(t, newResourceGroupBuilder(c), parent)
+				if slices.Contains(tc.want, id) {
+					require.Len(t, roles, 1, id)
+					require.NotEmpty(t, resourceGroups, id)
+				} else {
+					require.Empty(t, roles, id)
+					require.Empty(t, resourceGroups, id)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriptionFiltersResolvedPerSync(t *testing.T) {
+	ctx := context.Background()
+	f := newFilterTenant(t)
+	c := f.connector(t, WithManagementGroups("corp"))
+
+	ok, err := c.subscriptionIncluded(ctx, sandboxSubscriptionID)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Moving a subscription into the management group takes effect on the next sync.
+	f.addManagementGroup("corp", productionSubscriptionID, sandboxSubscriptionID, sharedSubscriptionID)
+	ok, err = c.subscriptionIncluded(ctx, sandboxSubscriptionID)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	c.syncEpoch.Add(1)
+	ok, err = c.subscriptionIncluded(ctx, sandboxSubscriptionID)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestResourceGroupFilters(t *testing.T) {
+	ctx := context.Background()
+	f := newFilterTenant(t)
+	f.addRoleAssignment("/subscriptions/"+productionSubscriptionID+"/resourceGroups/app-rg", "ra1", fakeRoleID, "u1")
+	f.addRoleAssignment("/subscriptions/"+productionSubscriptionID+"/resourceGroups/sandbox-rg", "ra2", fakeRoleID, "u2")
+	c := f.connector(t, WithSubscriptionIDs(productionSubscriptionID), WithExcludedResourceGroups("sandbox-*"))
+	subscription := &v2.ResourceId{ResourceType: subscriptionsResourceType.Id, Resource: productionSubscriptionID}
+
+	resourceGroups := listAll(t, newResourceGroupBuilder(c), subscription)
+	require.Len(t, resourceGroups, 1)
+	require.Equal(t, "app-rg", resourceGroups[0].DisplayName)
+
+	roles := listAll(t, newRoleBuilder(c), subscription)
+	require.Equal(t, []string{"assigned/u1"}, grantPrincipals(grantsAll(t, newRoleBuilder(c), roles[0])))
+
+	assignments := listAll(t, &roleAssignmentResourceGroupBuilder{conn: c}, nil)
+	require.Equal(t, []string{"app-rg:" + productionSubscriptionID + ":" + fakeRoleID}, resourceIDs(assignments))
+
+	_, err := newConnector(ctx, http.DefaultClient, false, false, WithResourceGroups("[rg"))
+	require.Error(t, err)
+}
+
+func TestResourceGroupOfScope(t *testing.T) {
+	require.Equal(t, "rg", resourceGroupOfScope("/subscriptions/s/resourceGroups/rg"))
+	require.Equal(t, "rg", resourceGroupOfScope("/subscriptions/s/resourcegroups/rg/providers/Microsoft.Compute/virtualMachines/vm"))
+	require.Equal(t, "", resourceGroupOfScope("/subscriptions/s"))
+	require.Equal(t, "", resourceGroupOfScope("/"))
+}
@@ -1,8 +1,13 @@
 package connector
 
 import (
+	"context"
 	"fmt"
-	"net/url"
+	"net/http"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
 )
 
 const (
@@ -21,9 +26,135 @@ var servicePrincipalSelect = []string{
 	"homepage",
 	"id",
 	"info",
+	"keyCredentials",
+	"passwordCredentials",
 	"tags",
 }
 
+// servicePrincipalActivity holds the tenant wide sign-in activity report for service principals, keyed by
+// appId. The report is loaded once per sync and shared by the managed identity and enterprise application builders.
+type servicePrincipalActivity struct {
+	unavailable bool
+	byAppID     map[string]*servicePrincipalSignInActivity
+}
+
+// getServicePrincipalSignInActivity returns the sign-in activity for the app, or nil if there is none.
+// The report is only available on the beta endpoint and needs AuditLog.Read.All and an Entra ID P1 or P2
+// license. When either is missing a single warning is logged and activity is skipped for the rest of the sync.
+// The report is read past the HTTP cache so every sync sees the latest activity.
+// https://learn.microsoft.com/en-us/graph/api/reportroot-list-serviceprincipalsigninactivities?view=graph-rest-beta
+func (d *Connector) getServicePrincipalSignInActivity(ctx context.Context, appID string) (*servicePrincipalSignInActivity, error) {
+	activity, err := d.spActivity.get(ctx, d.loadServicePrincipalSignInActivity)
+	if err != nil {
+		return nil, err
+	}
+
+	if activity.unavailable {
+		return nil, nil
+	}
+
+	return activity.byAppID[appID], nil
+}
+
+func (d *Connector) loadServicePrincipalSignInActivity(ctx context.Context) (*servicePrincipalActivity, error) {
+	rv := &servicePrincipalActivity{
+		byAppID: make(map[string]*servicePrincipalSignInActivity),
+	}
+	reqURL := d.buildBetaURL("reports/servicePrincipalSignInActivities", nil)
+	for reqURL != "" {
+		resp := &servicePrincipalSignInActivityList{}
+		err := d.queryUncached(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+		if err != nil {
+			if !isSignInActivityError(err) {
+				return nil, err
+			}
+
+			ctxzap.Extract(ctx).Warn(
+				"baton-azure-infrastructure: unable to read service principal sign-in activity, last activity will not be synced. "+
+					"This requires an Entra ID P1 or P2 license and the AuditLog.Read.All permission",
+				zap.Error(err),
+			)
+			return &servicePrincipalActivity{unavailable: true}, nil
+		}
+
+		for _, activity := range resp.Value {
+			rv.byAppID[activity.AppId] = activity
+		}
+		reqURL = resp.NextLink
+	}
+
+	return rv, nil
+}
+
+// earliestCredentialExpiry returns the soonest end date of the key and password credentials
+// registered on the service principal itself.
+func (sp *servicePrincipal) earliestCredentialExpiry() *time.Time {
+	var rv *time.Time
+	for _, creds := range [][]*credential{sp.KeyCredentials, sp.PasswordCredentials} {
+		for _, c := range creds {
+			if c == nil || c.EndDateTime == nil {
+				continue
+			}
+
+			if rv == nil || c.EndDateTime.Before(*rv) {
+				rv = c.EndDateTime
+			}
+		}
+	}
+
+	return rv
+}
+
+// addWorkloadIdentityProfile adds last activity and credential expiry details to a service principal profile.
+func addWorkloadIdentityProfile(profile map[string]interface{}, sp *servicePrincipal, activity *servicePrincipalSignInActivity) {
+	if expiry := sp.earliestCredentialExpiry(); expiry != nil {
+		profile["earliest_credential_expiry"] = expiry.Format(time.RFC3339)
+	}
+	profile["credential_count"] = len(sp.KeyCredentials) + len(sp.PasswordCredentials)
+
+	if activity == nil {
+		return
+	}
+
+	for key, entry := range map[string]*signInActivityEntry{
+		"last_sign_in":                             activity.LastSignInActivity,
+		"last_delegated_client_sign_in":            activity.DelegatedClientSignInActivity,
+		"last_delegated_resource_sign_in":          activity.DelegatedResourceSignInActivity,
+		"last_app_authentication_client_sign_in":   activity.ApplicationAuthenticationClientSignInActivity,
+		"last_app_authentication_resource_sign_in": activity.ApplicationAuthenticationResourceSignInActivity,
+	} {
+		if entry != nil && entry.LastSignInDateTime != nil {
+			profile[key] = entry.LastSignInDateTime.Format(time.RFC3339)
+		}
+	}
+}
+
+// lastActivity returns the most recent sign-in recorded for the service principal in any role.
+func (a *servicePrincipalSignInActivity) lastActivity() *time.Time {
+	if a == nil {
+		return nil
+	}
+
+	var rv *time.Time
+	for _, entry := range []*signInActivityEntry{
+		a.LastSignInActivity,
+		a.DelegatedClientSignInActivity,
+		a.DelegatedResourceSignInActivity,
+		a.ApplicationAuthenticationClientSignInActivity,
+		a.ApplicationAuthenticationResourceSignInActivity,
+	} {
+		if entry == nil || entry.LastSignInDateTime == nil || entry.LastSignInDateTime.IsZero() {
+			continue
+		}
+
+		if rv == nil || entry.LastSignInDateTime.After(*rv) {
+			rv = entry.LastSignInDateTime
+		}
+	}
+
+	return rv
+}
+
 func (sp *servicePrincipal) getDisplayName() string {
 	if sp.DisplayName != "" {
 		return sp.DisplayName
@@ -32,16 +163,11 @@ func (sp *servicePrincipal) getDisplayName() string {
 	return sp.AppDisplayName
 }
 
-func (sp *servicePrincipal) externalURL() string {
-	return (&url.URL{
-		Scheme: "https",
-		Host:   "entra.microsoft.com",
-		Path:   "/",
-		Fragment: fmt.Sprintf(
-			"view/Microsoft_AAD_IAM/ManagedAppMenuBlade/~/Overview/objectId/%s/appId/%s/preferredSingleSignOnMode~/null/servicePrincipalType/%s",
-			sp.ID,
-			sp.AppId,
-			sp.ServicePrincipalType,
-		),
-	}).String()
+func (sp *servicePrincipal) externalURL(cloud *azureCloud) string {
+	return cloud.portalURL(fmt.Sprintf(
+		"view/Microsoft_AAD_IAM/ManagedAppMenuBlade/~/Overview/objectId/%s/appId/%s/preferredSingleSignOnMode~/null/servicePrincipalType/%s",
+		sp.ID,
+		sp.AppId,
+		sp.ServicePrincipalType,
+	))
 }
@@ -0,0 +1,150 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Graph accepts at most 1000 sign-ins per page.
+const signInsMaxPageSize = 1000
+
+// signInSource reads successful user sign-ins and reports them as usage of the enterprise application.
+// Requires AuditLog.Read.All and an Entra ID P1 or P2 license.
+// https://learn.microsoft.com/en-us/graph/api/signin-list?view=graph-rest-1.0
+type signInSource struct {
+	conn     *Connector
+	lookback time.Duration
+}
+
+// servicePrincipalIDCache maps application IDs onto the object ID of the tenant's service principal,
+// which is the ID enterprise applications are synced with. It is started over every sync, so applications
+// added since are found.
+type servicePrincipalIDCache struct {
+	mu      sync.Mutex
+	byAppID map[string]string
+}
+
+func newServicePrincipalIDCache(context.Context) (*servicePrincipalIDCache, error) {
+	return &servicePrincipalIDCache{
+		byAppID: make(map[string]string),
+	}, nil
+}
+
+func (s *signInSource) name() string {
+	return "sign_ins"
+}
+
+func (s *signInSource) listEvents(ctx context.Context, since time.Time, reqURL string, pageSize int) ([]*v2.Event, string, time.Time, error) {
+	if reqURL == "" {
+		if earliest := time.Now().Add(-s.lookback); earliest.After(since) {
+			since = earliest
+		}
+
+		v := url.Values{}
+		// since overlaps the previous pass, the sign-ins it already returned are dropped by the cursor.
+		v.Set("$filter", fmt.Sprintf("createdDateTime ge %s and status/errorCode eq 0", graphFilterTime(since)))
+		if pageSize > 0 && pageSize <= signInsMaxPageSize {
+			v.Set("$top", strconv.Itoa(pageSize))
+		}
+		reqURL = s.conn.buildURL("auditLogs/signIns", v)
+	}
+
+	resp := &signInList{}
+	err := s.conn.query(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+	if err != nil {
+		if status.Code(err) == codes.PermissionDenied {
+			// ListEvents skips the source and logs this once.
+			return nil, "", time.Time{}, fmt.Errorf(
+				"baton-azure-infrastructure: unable to read sign-in logs, application usage events will not be reported. "+
+					"This requires AuditLog.Read.All and an Entra ID P1 or P2 license: %w", err)
+		}
+
+		// Throttling errors are returned as they are. They map to Unavailable with a RateLimitDescription, so
+		// the SDK waits before asking for the page again.
+		return nil, "", time.Time{}, err
+	}
+
+	var (
+		rv     []*v2.Event
+		latest time.Time
+	)
+	for _, si := range resp.Value {
+		if si.CreatedDateTime.After(latest) {
+			latest = si.CreatedDateTime
+		}
+
+		if si.UserID == "" || si.AppID == "" {
+			continue
+		}
+
+		servicePrincipalID, err := s.conn.servicePrincipalIDForApp(ctx, si.AppID)
+		if err != nil {
+			return nil, "", time.Time{}, err
+		}
+		if servicePrincipalID == "" {
+			// Microsoft first party apps don't always have a service principal in the tenant.
+			continue
+		}
+
+		displayName := si.UserDisplayName
+		if displayName == "" {
+			displayName = si.UserPrincipalName
+		}
+		rv = append(rv, newUsageEvent(si.ID, si.CreatedDateTime,
+			&v2.Resource{
+				Id: &v2.ResourceId{
+					ResourceType: enterpriseApplicationResourceType.Id,
+					Resource:     servicePrincipalID,
+				},
+				DisplayName: si.AppDisplayName,
+			},
+			&v2.Resource{
+				Id: &v2.ResourceId{
+					ResourceType: userResourceType.Id,
+					Resource:     si.UserID,
+				},
+				DisplayName: displayName,
+			},
+		))
+	}
+
+	return rv, resp.NextLink, latest, nil
+}
+
+// servicePrincipalIDForApp returns the object ID of the service principal for appID, or an empty string
+// if the tenant doesn't have one.
+func (d *Connector) servicePrincipalIDForApp(ctx context.Context, appID string) (string, error) {
+	// newServicePrincipalIDCache never fails.
+	cache, _ := d.spIDs.get(ctx, newServicePrincipalIDCache)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if id, ok := cache.byAppID[appID]; ok {
+		return id, nil
+	}
+
+	v := url.Values{}
+	v.Set("$filter", fmt.Sprintf("appId eq '%s'", appID))
+	v.Set("$select", "id")
+	resp := &servicePrincipalsList{}
+	err := d.query(ctx, graphReadScopes, http.MethodGet, d.buildURL("servicePrincipals", v), nil, resp)
+	if err != nil {
+		return "", err
+	}
+
+	id := ""
+	if len(resp.Value) > 0 {
+		id = resp.Value[0].ID
+	}
+	cache.byAppID[appID] = id
+
+	return id, nil
+}
@@ -3,13 +3,19 @@ package connector
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 
+	armsubscription "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/subscription/armsubscription"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
 )
 
+// subscriptionsAPIVersion is the Microsoft.Resources API version used to list subscriptions and tenants.
+const subscriptionsAPIVersion = "2016-06-01"
+
 type subscriptionBuilder struct {
 	conn *Connector
 }
@@ -20,14 +26,13 @@ func (s *subscriptionBuilder) ResourceType(ctx context.Context) *v2.ResourceType
 
 func (s *subscriptionBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
 	var rv []*v2.Resource
-	pager := s.conn.clientFactory.NewSubscriptionsClient().NewListPager(nil)
-	for pager.More() {
-		page, err := pager.NextPage(ctx)
+	if s.conn.useResourceGraph() {
+		snapshot, err := s.conn.resourceGraphSnapshot(ctx)
 		if err != nil {
 			return nil, "", nil, err
 		}
 
-		for _, subscription := range page.Value {
+		for _, subscription := range snapshot.subscriptions {
 			sr, err := subscriptionResource(ctx, subscription)
 			if err != nil {
 				return nil, "", nil, err
@@ -35,9 +40,51 @@ func (s *subscriptionBuilder) List(ctx context.Context, parentResourceID *v2.Res
 
 			rv = append(rv, sr)
 		}
+
+		return rv, "", nil, nil
 	}
 
-	return rv, "", nil, nil
+	bag, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: subscriptionsResourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	reqURL := bag.PageToken()
+	if reqURL == "" {
+		v := url.Values{}
+		v.Set("api-version", subscriptionsAPIVersion)
+		reqURL = s.conn.buildARMURL("subscriptions", v)
+	}
+
+	resp := &armsubscription.ListResult{}
+	err = s.conn.queryUncached(ctx, armScopes, http.MethodGet, reqURL, nil, resp)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	for _, subscription := range resp.Value {
+		ok, err := s.conn.includeSubscription(ctx, subscription)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		sr, err := subscriptionResource(ctx, subscription)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		rv = append(rv, sr)
+	}
+
+	pageToken, err := bag.NextToken(StringValue(resp.NextLink))
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, pageToken, nil, nil
 }
 
 func (s *subscriptionBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
@@ -0,0 +1,168 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	armresources "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// subscriptionScan holds role definitions, role assignments and resource groups prefetched for every subscription
+// by a bounded pool of workers. A subscription that failed to prefetch has no entry, and is read one request at a
+// time again when it is needed, which surfaces its error.
+type subscriptionScan struct {
+	roleDefinitions map[string][]*armauthorization.RoleDefinition
+	roleAssignments map[string][]*armauthorization.RoleAssignment
+	resourceGroups  map[string][]*armresources.ResourceGroup
+}
+
+func newSubscriptionScan() *subscriptionScan {
+	return &subscriptionScan{
+		roleDefinitions: make(map[string][]*armauthorization.RoleDefinition),
+		roleAssignments: make(map[string][]*armauthorization.RoleAssignment),
+		resourceGroups:  make(map[string][]*armresources.ResourceGroup),
+	}
+}
+
+// throttleGate holds back every worker of a pool once one of them is throttled.
+type throttleGate struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (g *throttleGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	wait := time.Until(g.until)
+	g.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+func (g *throttleGate) pause(until time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if until.After(g.until) {
+		g.until = until
+	}
+}
+
+// useSubscriptionScan reports whether subscriptions are prefetched concurrently. Resource Graph already reads the
+// whole tenant at once, so it takes precedence.
+func (d *Connector) useSubscriptionScan() bool {
+	return d.subscriptionScan != nil && !d.useResourceGraph()
+}
+
+// subscriptionScanSnapshot prefetches every subscription on first use in each sync.
+func (d *Connector) subscriptionScanSnapshot(ctx context.Context) (*subscriptionScan, error) {
+	return d.subscriptionScan.get(ctx, d.prefetchSubscriptions)
+}
+
+func (d *Connector) prefetchSubscriptions(ctx context.Context) (*subscriptionScan, error) {
+	scan := newSubscriptionScan()
+	subscriptionIDs, err := d.listSubscriptionIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	err = d.forEachSubscription(ctx, subscriptionIDs, func(ctx context.Context, subscriptionID string) error {
+		roleDefinitions, err := listRoleDefinitions(ctx, d, subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		roleAssignments, err := listRoleAssignments(ctx, d, subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		resourceGroups, err := listResourceGroups(ctx, d, subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		scan.roleDefinitions[subscriptionID] = roleDefinitions
+		scan.roleAssignments[subscriptionID] = roleAssignments
+		scan.resourceGroups[subscriptionID] = resourceGroups
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctxzap.Extract(ctx).Debug("baton-azure-infrastructure: prefetched subscriptions",
+		zap.Int("subscriptions", len(subscriptionIDs)),
+		zap.Int("prefetched", len(scan.roleAssignments)),
+		zap.Int("parallelism", d.subscriptionParallelism),
+	)
+
+	return scan, nil
+}
+
+// forEachSubscription runs fn for every subscription with at most subscriptionParallelism workers. Requests made
+// by fn are already retried by the HTTP clients, so fn isn't run again here. When fn is still throttled, every
+// worker waits until the service's reset time before starting more work. Failures are logged and skip the
+// subscription; only a canceled context fails the whole pool.
+func (d *Connector) forEachSubscription(ctx context.Context, subscriptionIDs []string, fn func(ctx context.Context, subscriptionID string) error) error {
+	l := ctxzap.Extract(ctx)
+	gate := &throttleGate{}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(d.subscriptionParallelism, 1))
+	for _, subscriptionID := range subscriptionIDs {
+		g.Go(func() error {
+			if err := gate.wait(gctx); err != nil {
+				return err
+			}
+
+			err := fn(gctx, subscriptionID)
+			if err == nil {
+				return nil
+			}
+			if gctx.Err() != nil {
+				return gctx.Err()
+			}
+
+			l.Warn("baton-azure-infrastructure: unable to prefetch subscription",
+				zap.String("subscription_id", subscriptionID),
+				zap.Error(err),
+			)
+
+			rl := rateLimitDescription(err)
+			if rl == nil {
+				return nil
+			}
+			resetAt := time.Now().Add(d.retry.maxDelay)
+			if rl.GetResetAt() != nil && rl.GetResetAt().AsTime().Before(resetAt) {
+				resetAt = rl.GetResetAt().AsTime()
+			}
+			l.Debug("baton-azure-infrastructure: subscription prefetch throttled, pausing workers",
+				zap.String("subscription_id", subscriptionID),
+				zap.Time("reset_at", resetAt),
+			)
+			gate.pause(resetAt)
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return fmt.Errorf("baton-azure-infrastructure: failed to prefetch subscriptions: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEachSubscription(t *testing.T) {
+	c := &Connector{
+		retry:                   retryPolicy{maxRetries: 2, baseDelay: time.Millisecond, maxDelay: time.Millisecond},
+		subscriptionParallelism: 2,
+	}
+
+	var (
+		mu              sync.Mutex
+		running, peak   int
+		calls           = make(map[string]int)
+		throttledOnce   bool
+		subscriptionIDs = []string{"a", "b", "c", "d", "e"}
+	)
+	err := c.forEachSubscription(context.Background(), subscriptionIDs, func(ctx context.Context, id string) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		calls[id]++
+		throttle := id == "b" && !throttledOnce
+		throttledOnce = throttledOnce || throttle
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		switch {
+		case throttle:
+			return newHTTPError(&http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": []string{"0"}},
+			}, "", ErrRequestFailed)
+		case id == "c":
+			return errors.New("forbidden")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.LessOrEqual(t, peak, 2)
+	require.Equal(t, map[string]int{"a": 1, "b": 1, "c": 1, "d": 1, "e": 1}, calls, "throttled subscriptions are skipped, not run again")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = c.forEachSubscription(ctx, subscriptionIDs, func(ctx context.Context, id string) error {
+		return ctx.Err()
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSubscriptionScanOffline(t *testing.T) {
+	f := newFakeTenant(t)
+	c := f.connector(t, WithSubscriptionParallelism(2))
+	subscription := &v2.ResourceId{ResourceType: subscriptionsResourceType.Id, Resource: fakeSubscriptionID}
+
+	roles := listAll(t, newRoleBuilder(c), subscription)
+	require.Equal(t, []string{fakeRoleID + ":" + fakeSubscriptionID}, resourceIDs(roles))
+	resourceGroups := listAll(t, newResourceGroupBuilder(c), subscription)
+	require.Len(t, resourceGroups, 2)
+
+	// Both lists are served from the prefetched subscription.
+	require.Equal(t, 1, f.requestCount("GET /subscriptions/"+fakeSubscriptionID+"/providers/Microsoft.Authorization/roleDefinitions"))
+	require.Equal(t, 1, f.requestCount("GET /subscriptions/"+fakeSubscriptionID+"/resourcegroups"))
+
+	// The next sync prefetches again.
+	f.resourceGroups[fakeSubscriptionID] = append(f.resourceGroups[fakeSubscriptionID], "rg3")
+	c.syncEpoch.Add(1)
+	resourceGroups = listAll(t, newResourceGroupBuilder(c), subscription)
+	require.Len(t, resourceGroups, 3)
+}
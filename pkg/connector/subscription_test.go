@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	uhttp "github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionListPages(t *testing.T) {
+	const nextLink = "https://management.azure.com/subscriptions?api-version=2016-06-01&%24skiptoken=page2"
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "/subscriptions", req.URL.Path)
+		if req.URL.Query().Get("$skiptoken") == "page2" {
+			return jsonResponse(http.StatusOK, map[string]interface{}{
+				"value": []map[string]string{{"subscriptionId": "sub-2", "displayName": "Two"}},
+			})
+		}
+
+		return jsonResponse(http.StatusOK, map[string]interface{}{
+			"value":    []map[string]string{{"subscriptionId": "sub-1", "displayName": "One"}},
+			"nextLink": nextLink,
+		})
+	})
+
+	client := &http.Client{Transport: transport}
+	c := &Connector{
+		token:      staticToken{},
+		httpClient: uhttp.NewBaseHttpClient(client),
+		transport:  client,
+		retry:      defaultRetryPolicy(),
+	}
+	s := newSubscriptionBuilder(c)
+
+	var (
+		ids   []string
+		token = &pagination.Token{}
+	)
+	for {
+		resources, next, _, err := s.List(context.Background(), &v2.ResourceId{}, token)
+		require.NoError(t, err)
+		for _, r := range resources {
+			ids = append(ids, r.Id.Resource)
+		}
+
+		if next == "" {
+			break
+		}
+		token = &pagination.Token{Token: next}
+	}
+
+	require.Equal(t, []string{"sub-1", "sub-2"}, ids)
+}
+
+func TestARMListingsUncached(t *testing.T) {
+	f := newFakeTenant(t)
+	// Every sync lists subscriptions, resource groups and roles again, even with the HTTP cache on.
+	t.Setenv("BATON_DISABLE_HTTP_CACHE", "false")
+	c, err := NewConnectorFromToken(context.Background(), f.server.Client(), staticToken{}, false, false,
+		WithBaseURLs(f.server.URL, f.server.URL))
+	require.NoError(t, err)
+	subscription := &v2.ResourceId{ResourceType: subscriptionsResourceType.Id, Resource: fakeSubscriptionID}
+
+	require.Len(t, listAll(t, newSubscriptionBuilder(c), nil), 1)
+	require.Len(t, listAll(t, newResourceGroupBuilder(c), subscription), 2)
+	require.Len(t, listAll(t, newRoleBuilder(c), subscription), 1)
+
+	f.addSubscription("33333333-3333-3333-3333-333333333333")
+	f.resourceGroups[fakeSubscriptionID] = append(f.resourceGroups[fakeSubscriptionID], "rg3")
+	f.addRoleDefinition(fakeSubscriptionID, "44444444-4444-4444-4444-444444444444", "Custom Reader")
+	c.syncEpoch.Add(1)
+	require.Len(t, listAll(t, newSubscriptionBuilder(c), nil), 2)
+	require.Len(t, listAll(t, newResourceGroupBuilder(c), subscription), 3)
+	require.Len(t, listAll(t, newRoleBuilder(c), subscription), 2)
+}
@@ -0,0 +1,46 @@
+package connector
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// syncCache holds a value that is loaded at most once per sync and shared between builders, such as a tenant
+// wide report or snapshot. The SDK calls Validate at the start of every sync, which advances the connector's sync
+// epoch. A value loaded in an earlier epoch is loaded again, so a connector running in service mode doesn't keep
+// serving the first sync's data.
+type syncCache[T any] struct {
+	epoch *atomic.Uint64
+
+	mu       sync.Mutex
+	loaded   bool
+	loadedIn uint64
+	value    T
+}
+
+func newSyncCache[T any](epoch *atomic.Uint64) *syncCache[T] {
+	return &syncCache[T]{epoch: epoch}
+}
+
+// get returns the value loaded during the current sync, calling load if there is none yet. Errors aren't cached,
+// so the next call loads again.
+func (c *syncCache[T]) get(ctx context.Context, load func(ctx context.Context) (T, error)) (T, error) {
+	epoch := c.epoch.Load()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loaded && c.loadedIn == epoch {
+		return c.value, nil
+	}
+
+	value, err := load(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	c.value = value
+	c.loaded = true
+	c.loadedIn = epoch
+
+	return value, nil
+}
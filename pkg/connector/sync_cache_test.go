@@ -0,0 +1,41 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncCache(t *testing.T) {
+	ctx := context.Background()
+	epoch := &atomic.Uint64{}
+	cache := newSyncCache[int](epoch)
+	loads := 0
+	load := func(context.Context) (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	for range 2 {
+		value, err := cache.get(ctx, load)
+		require.NoError(t, err)
+		require.Equal(t, 1, value)
+	}
+
+	// A new sync loads the value again.
+	epoch.Add(1)
+	value, err := cache.get(ctx, load)
+	require.NoError(t, err)
+	require.Equal(t, 2, value)
+
+	// Errors aren't cached.
+	epoch.Add(1)
+	_, err = cache.get(ctx, func(context.Context) (int, error) { return 0, errors.New("unavailable") })
+	require.Error(t, err)
+	value, err = cache.get(ctx, load)
+	require.NoError(t, err)
+	require.Equal(t, 3, value)
+}
@@ -2,7 +2,10 @@ package connector
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 
+	armsubscription "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/subscription/armsubscription"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
@@ -17,25 +20,40 @@ func (t *tenantBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 }
 
 func (t *tenantBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	bag, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: tenantResourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	reqURL := bag.PageToken()
+	if reqURL == "" {
+		v := url.Values{}
+		v.Set("api-version", subscriptionsAPIVersion)
+		reqURL = t.conn.buildARMURL("tenants", v)
+	}
+
+	resp := &armsubscription.TenantListResult{}
+	err = t.conn.queryUncached(ctx, armScopes, http.MethodGet, reqURL, nil, resp)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
 	var rv []*v2.Resource
-	pager := t.conn.clientFactory.NewTenantsClient().NewListPager(nil)
-	for pager.More() {
-		page, err := pager.NextPage(ctx)
+	for _, tenant := range resp.Value {
+		sr, err := tenantResource(ctx, tenant)
 		if err != nil {
 			return nil, "", nil, err
 		}
 
-		for _, tenant := range page.Value {
-			sr, err := tenantResource(ctx, tenant)
-			if err != nil {
-				return nil, "", nil, err
-			}
+		rv = append(rv, sr)
+	}
 
-			rv = append(rv, sr)
-		}
+	pageToken, err := bag.NextToken(StringValue(resp.NextLink))
+	if err != nil {
+		return nil, "", nil, err
 	}
 
-	return rv, "", nil, nil
+	return rv, pageToken, nil, nil
 }
 
 func (t *tenantBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
@@ -0,0 +1,201 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// userAttributeAliases maps convenience names onto the Graph property that actually holds them.
+// https://learn.microsoft.com/en-us/graph/api/resources/employeeorgdata?view=graph-rest-1.0
+var userAttributeAliases = map[string]string{
+	"costCenter": "employeeOrgData/costCenter",
+	"division":   "employeeOrgData/division",
+}
+
+// reservedUserProfileKeys are set on every user profile and can't be configured as attributes.
+var reservedUserProfileKeys = []string{
+	"id",
+	"mail",
+	"displayName",
+	"title",
+	"jobTitle",
+	"userPrincipalName",
+	"accountEnabled",
+	"employeeId",
+	"department",
+	"lastSignInDateTime",
+	"lastNonInteractiveSignInDateTime",
+	"lastSuccessfulSignInDateTime",
+	employeeNumberProfileKey,
+	managerIDProfileKey,
+	managerEmailProfileKey,
+	supervisorIDProfileKey,
+	supervisorEmailProfileKey,
+	supervisorFullNameProfileKey,
+}
+
+var userAttributePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(/[A-Za-z0-9_]+)*$`)
+
+// userAttribute is an additional Graph user property that is copied into the user profile.
+// The first path segment is added to $select, any following segments walk into the returned object.
+type userAttribute struct {
+	property   string
+	path       []string
+	profileKey string
+}
+
+// parseUserAttributes validates the configured user attributes. Accepted forms are plain properties
+// (onPremisesSamAccountName), directory extensions (extension_<appId>_<name>), nested properties
+// (employeeOrgData/costCenter) and custom security attribute sets (customSecurityAttributes/<set>).
+func parseUserAttributes(attributes []string) ([]*userAttribute, error) {
+	var rv []*userAttribute
+	seen := make(map[string]bool)
+	for _, attribute := range attributes {
+		attribute = strings.TrimSpace(attribute)
+		if IsEmpty(attribute) {
+			continue
+		}
+
+		profileKey := strings.ReplaceAll(attribute, "/", "_")
+		if alias, ok := userAttributeAliases[attribute]; ok {
+			attribute = alias
+		}
+
+		if !userAttributePattern.MatchString(attribute) {
+			return nil, fmt.Errorf("baton-azure-infrastructure: invalid user attribute %q", attribute)
+		}
+
+		if slices.ContainsFunc(reservedUserProfileKeys, func(key string) bool { return strings.EqualFold(key, profileKey) }) {
+			return nil, fmt.Errorf("baton-azure-infrastructure: user attribute %q is already part of the user profile", profileKey)
+		}
+
+		// Aliases and the properties they stand for read the same value, so either may only be configured once.
+		for _, key := range []string{profileKey, attribute} {
+			if seen[strings.ToLower(key)] {
+				return nil, fmt.Errorf("baton-azure-infrastructure: user attribute %q is configured more than once", profileKey)
+			}
+		}
+		seen[strings.ToLower(profileKey)] = true
+		seen[strings.ToLower(attribute)] = true
+
+		parts := strings.Split(attribute, "/")
+		rv = append(rv, &userAttribute{
+			property:   parts[0],
+			path:       parts[1:],
+			profileKey: profileKey,
+		})
+	}
+
+	return rv, nil
+}
+
+// userAttributeSelectKeys returns the properties that need to be added to $select.
+func userAttributeSelectKeys(attributes []*userAttribute) []string {
+	var rv []string
+	seen := make(map[string]bool)
+	for _, attribute := range attributes {
+		if seen[attribute.property] {
+			continue
+		}
+		seen[attribute.property] = true
+		rv = append(rv, attribute.property)
+	}
+
+	return rv
+}
+
+// userAttributeProfile extracts the configured attributes from the raw Graph user object.
+func userAttributeProfile(u *user, attributes []*userAttribute) (map[string]interface{}, error) {
+	if len(attributes) == 0 || len(u.raw) == 0 {
+		return nil, nil
+	}
+
+	raw := make(map[string]interface{})
+	err := json.Unmarshal(u.raw, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(map[string]interface{})
+	for _, attribute := range attributes {
+		value, ok := raw[attribute.property]
+		for _, segment := range attribute.path {
+			if !ok {
+				break
+			}
+
+			obj, isObj := value.(map[string]interface{})
+			if !isObj {
+				ok = false
+				break
+			}
+			value, ok = obj[segment]
+		}
+
+		if !ok || value == nil {
+			continue
+		}
+
+		rv[attribute.profileKey] = withoutODataAnnotations(value)
+	}
+
+	return rv, nil
+}
+
+// withoutODataAnnotations strips @odata.type style annotations from nested objects, which Graph
+// adds to custom security attribute values.
+func withoutODataAnnotations(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		rv := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if strings.Contains(key, "@odata.") {
+				continue
+			}
+			rv[key] = withoutODataAnnotations(item)
+		}
+		return rv
+	case []interface{}:
+		rv := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			rv = append(rv, withoutODataAnnotations(item))
+		}
+		return rv
+	default:
+		return v
+	}
+}
+
+// UnmarshalJSON keeps the raw object of every user when keepRaw is set, so configured attributes that aren't part
+// of the struct can be read later. Without configured attributes the raw objects would only take up memory.
+func (l *usersList) UnmarshalJSON(data []byte) error {
+	type usersListAlias usersList
+	if !l.keepRaw {
+		return json.Unmarshal(data, (*usersListAlias)(l))
+	}
+
+	page := &struct {
+		*usersListAlias
+		Users []json.RawMessage `json:"value,omitempty"`
+	}{usersListAlias: (*usersListAlias)(l)}
+	err := json.Unmarshal(data, page)
+	if err != nil {
+		return err
+	}
+
+	l.Users = make([]*user, 0, len(page.Users))
+	for _, raw := range page.Users {
+		u := &user{}
+		err := json.Unmarshal(raw, u)
+		if err != nil {
+			return err
+		}
+		u.raw = raw
+		l.Users = append(l.Users, u)
+	}
+
+	return nil
+}
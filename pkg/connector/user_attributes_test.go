@@ -0,0 +1,93 @@
+package connector
+
+import (
+	"encoding/json"
+	"testing"
+
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAttributeProfile(t *testing.T) {
+	attributes, err := parseUserAttributes([]string{
+		"costCenter",
+		"onPremisesSamAccountName",
+		"extension_b7d8e648520f41d3b9c0fdeb91768a0a_jobGroup",
+		"customSecurityAttributes/Engineering",
+		" ",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"employeeOrgData",
+		"onPremisesSamAccountName",
+		"extension_b7d8e648520f41d3b9c0fdeb91768a0a_jobGroup",
+		"customSecurityAttributes",
+	}, userAttributeSelectKeys(attributes))
+
+	page := &usersList{keepRaw: true}
+	err = json.Unmarshal([]byte(`{"value": [{
+		"id": "1",
+		"employeeOrgData": {"costCenter": "CC-42", "division": null},
+		"onPremisesSamAccountName": "jdoe",
+		"extension_b7d8e648520f41d3b9c0fdeb91768a0a_jobGroup": "L4",
+		"customSecurityAttributes": {
+			"Engineering": {"@odata.type": "#microsoft.graph.customSecurityAttributeValue", "Project": "Baton"}
+		}
+	}]}`), page)
+	require.NoError(t, err)
+	require.Len(t, page.Users, 1)
+	u := page.Users[0]
+	require.Equal(t, "1", u.ID)
+
+	profile, err := userAttributeProfile(u, attributes)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"costCenter":               "CC-42",
+		"onPremisesSamAccountName": "jdoe",
+		"extension_b7d8e648520f41d3b9c0fdeb91768a0a_jobGroup": "L4",
+		"customSecurityAttributes_Engineering":                map[string]interface{}{"Project": "Baton"},
+	}, profile)
+
+	// Without configured attributes the raw objects aren't kept.
+	page = &usersList{}
+	err = json.Unmarshal([]byte(`{"value": [{"id": "1", "onPremisesSamAccountName": "jdoe"}], "@odata.nextLink": "next"}`), page)
+	require.NoError(t, err)
+	require.Equal(t, "next", page.NextLink)
+	require.Equal(t, "1", page.Users[0].ID)
+	require.Nil(t, page.Users[0].raw)
+}
+
+func TestUserAttributesOffline(t *testing.T) {
+	f := newFakeTenant(t)
+	f.objects["u1"]["employeeOrgData"] = map[string]any{"costCenter": "CC-42"}
+
+	users := listAll(t, newUserBuilder(f.connector(t, WithUserAttributes("costCenter"))), nil)
+	trait, err := rs.GetUserTrait(findResource(t, users, "u1"))
+	require.NoError(t, err)
+	costCenter, ok := rs.GetProfileStringValue(trait.GetProfile(), "costCenter")
+	require.True(t, ok)
+	require.Equal(t, "CC-42", costCenter)
+
+	users = listAll(t, newUserBuilder(f.connector(t)), nil)
+	trait, err = rs.GetUserTrait(findResource(t, users, "u1"))
+	require.NoError(t, err)
+	_, ok = rs.GetProfileStringValue(trait.GetProfile(), "costCenter")
+	require.False(t, ok)
+}
+
+func TestParseUserAttributesInvalid(t *testing.T) {
+	for _, attributes := range [][]string{
+		{"manager($select=id)"},
+		// Fixed profile keys can't be overwritten.
+		{"mail"},
+		{"employeeNumber"},
+		// An alias and the property it stands for collide.
+		{"costCenter", "employeeOrgData/costCenter"},
+		{"employeeOrgData/costCenter", "costCenter"},
+		{"employeeOrgData/division", "employeeOrgData_division"},
+		{"onPremisesSamAccountName", "onPremisesSamAccountName"},
+	} {
+		_, err := parseUserAttributes(attributes)
+		require.Error(t, err, attributes)
+	}
+}
@@ -2,9 +2,13 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/url"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/conductorone/baton-azure-infrastructure/pkg/internal/slices"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -17,8 +21,17 @@ import (
 
 type userBuilder struct {
 	conn *Connector
+	// signInActivityUnavailable is set once Graph refuses signInActivity because the
+	// tenant has no Entra ID P1/P2 license or the app lacks AuditLog.Read.All.
+	signInActivityUnavailable atomic.Bool
+	// deltaWarning logs once that users listed through delta have no last login.
+	deltaWarning sync.Once
 }
 
+// signInActivityLicenseErrorCode is the Graph error code returned when sign-in activity is read in a
+// tenant without an Entra ID P1 or P2 license.
+const signInActivityLicenseErrorCode = "Authentication_RequestFromNonPremiumTenantOrB2CTenant"
+
 func (usr *userBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return userResourceType
 }
@@ -33,13 +46,12 @@ func (usr *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceI
 		return nil, "", nil, err
 	}
 
-	reqURL := bag.PageToken()
-	if reqURL == "" {
-		reqURL = usr.conn.buildURL("users", setUserKeys())
+	var resp *usersList
+	if usr.conn.listsUsersThroughDelta() {
+		resp, err = usr.listUsersDelta(ctx, bag.PageToken())
+	} else {
+		resp, err = usr.listUsers(ctx, bag.PageToken())
 	}
-
-	resp := &usersList{}
-	err = usr.conn.query(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
 	if err != nil {
 		return nil, "", nil, err
 	}
@@ -52,7 +64,7 @@ func (usr *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceI
 	// If mailboxSettings is disabled, we can return the users without checking mailboxSettings.
 	if !usr.conn.MailboxSettings {
 		users, err := slices.ConvertErr(resp.Users, func(user *user) (*v2.Resource, error) {
-			return userResource(ctx, user, parentResourceID)
+			return userResource(ctx, usr.conn.azureCloud(), user, usr.conn.userAttributes, parentResourceID)
 		})
 		if err != nil {
 			return nil, "", nil, err
@@ -61,19 +73,30 @@ func (usr *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceI
 		return users, pageToken, nil, nil
 	}
 
-	// GET https://graph.microsoft.com/beta/users/{userId}/mailboxSettings
+	// GET https://graph.microsoft.com/v1.0/users/{userId}/mailboxSettings, sent in batches of 20.
+	batch := make([]*graphBatchItem, 0, len(resp.Users))
 	for _, ur := range resp.Users {
-		reqURL = usr.conn.buildURL(path.Join("users", ur.ID, "mailboxSettings"), setUserResponseKeys())
-		mailboxSettingsResp := &mailboxSettings{}
-		err = usr.conn.query(ctx, graphReadScopes, http.MethodGet, reqURL, nil, mailboxSettingsResp)
-		if err != nil {
+		batch = append(batch, &graphBatchItem{
+			URL:    usr.conn.buildURL(path.Join("users", ur.ID, "mailboxSettings"), setUserResponseKeys()),
+			Result: &mailboxSettings{},
+		})
+	}
+
+	err = usr.conn.batchGet(ctx, batch)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	for i, ur := range resp.Users {
+		if batch[i].Err != nil {
 			l.Warn(
 				"baton-azure-infrastructure: error fetching mailboxSettings",
 				zap.Any("user", ur),
-				zap.Error(err),
+				zap.Error(batch[i].Err),
 			)
 		}
 
+		mailboxSettingsResp, _ := batch[i].Result.(*mailboxSettings)
 		userPurpose := strings.ToLower(mailboxSettingsResp.UserPurpose)
 		userAccountType := resource.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_HUMAN)
 		switch userPurpose {
@@ -81,7 +104,7 @@ func (usr *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceI
 			userAccountType = resource.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE)
 		}
 
-		userResource, err := userResource(ctx, ur, parentResourceID, userAccountType)
+		userResource, err := userResource(ctx, usr.conn.azureCloud(), ur, usr.conn.userAttributes, parentResourceID, userAccountType)
 		if err != nil {
 			return nil, "", nil, err
 		}
@@ -92,6 +115,61 @@ func (usr *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceI
 	return userResources, pageToken, nil, nil
 }
 
+// listUsers reads a page of users from Graph. signInActivity is dropped from the query once Graph refuses it.
+func (usr *userBuilder) listUsers(ctx context.Context, reqURL string) (*usersList, error) {
+	if reqURL == "" {
+		v := setUserKeys(!usr.signInActivityUnavailable.Load(), userAttributeSelectKeys(usr.conn.userAttributes)...)
+		addGraphFilter(v, usr.conn.graphFilters.users)
+		reqURL = usr.conn.buildURL("users", v)
+	}
+
+	resp := &usersList{keepRaw: len(usr.conn.userAttributes) > 0}
+	err := usr.conn.query(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+	if err != nil && isSignInActivityError(err) && strings.Contains(reqURL, signInActivityKey) {
+		if usr.signInActivityUnavailable.CompareAndSwap(false, true) {
+			ctxzap.Extract(ctx).Warn(
+				"baton-azure-infrastructure: unable to read user sign-in activity, last login will not be synced. "+
+					"This requires an Entra ID P1 or P2 license and the AuditLog.Read.All permission",
+				zap.Error(err),
+			)
+		}
+
+		reqURL, err = removeSelectKey(reqURL, signInActivityKey)
+		if err != nil {
+			return nil, err
+		}
+
+		resp = &usersList{keepRaw: len(usr.conn.userAttributes) > 0}
+		err = usr.conn.query(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// listUsersDelta reads a page of users through users/delta, which doesn't return signInActivity.
+func (usr *userBuilder) listUsersDelta(ctx context.Context, reqURL string) (*usersList, error) {
+	if reqURL == "" {
+		usr.deltaWarning.Do(func() {
+			ctxzap.Extract(ctx).Warn(
+				"baton-azure-infrastructure: users are listed through delta queries, which don't return sign-in " +
+					"activity. Last login will not be synced",
+			)
+		})
+		reqURL = usr.conn.deltaListURL("users", setUserKeys(false, userAttributeSelectKeys(usr.conn.userAttributes)...))
+	}
+
+	resp := &usersList{keepRaw: len(usr.conn.userAttributes) > 0}
+	err := usr.conn.queryUncached(ctx, graphReadScopes, http.MethodGet, reqURL, nil, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
 // Entitlements always returns an empty slice for users.
 func (usr *userBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
 	return nil, "", nil, nil
@@ -102,6 +180,37 @@ func (usr *userBuilder) Grants(ctx context.Context, resource *v2.Resource, pToke
 	return nil, "", nil, nil
 }
 
+// isSignInActivityError reports whether Graph refused sign-in activity, either because the tenant isn't licensed
+// for it or because the app wasn't granted AuditLog.Read.All. Graph answers the latter with a plain 403
+// Authorization_RequestDenied, so any 403 for a query selecting signInActivity counts.
+func isSignInActivityError(err error) bool {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	return httpErr.ErrorCode == signInActivityLicenseErrorCode || httpErr.StatusCode == http.StatusForbidden
+}
+
+// removeSelectKey drops a single property from the $select of a Graph URL.
+func removeSelectKey(reqURL string, key string) (string, error) {
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	var keys []string
+	for _, k := range strings.Split(q.Get("$select"), ",") {
+		if k != key {
+			keys = append(keys, k)
+		}
+	}
+	q.Set("$select", strings.Join(keys, ","))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
 func newUserBuilder(conn *Connector) *userBuilder {
 	return &userBuilder{
 		conn: conn,
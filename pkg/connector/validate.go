@@ -0,0 +1,399 @@
+package connector
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const permissionsAPIVersion = "2022-04-01"
+
+// graphPermissionProbe is a Graph endpoint a syncer reads, and the application permissions that grant access to it.
+// https://learn.microsoft.com/en-us/graph/permissions-reference
+type graphPermissionProbe struct {
+	permission  string
+	satisfiedBy []string
+	required    bool
+	path        string
+}
+
+var (
+	usersProbe = graphPermissionProbe{
+		permission:  "User.Read.All",
+		satisfiedBy: []string{"User.Read.All", "User.ReadWrite.All", "Directory.Read.All", "Directory.ReadWrite.All"},
+		required:    true,
+		path:        "users",
+	}
+	groupsProbe = graphPermissionProbe{
+		permission:  "GroupMember.Read.All",
+		satisfiedBy: []string{"GroupMember.Read.All", "Group.Read.All", "Group.ReadWrite.All", "Directory.Read.All", "Directory.ReadWrite.All"},
+		required:    true,
+		path:        "groups",
+	}
+	servicePrincipalsProbe = graphPermissionProbe{
+		permission:  "Application.Read.All",
+		satisfiedBy: []string{"Application.Read.All", "Application.ReadWrite.All", "Directory.Read.All", "Directory.ReadWrite.All"},
+		required:    true,
+		path:        "servicePrincipals",
+	}
+	mailboxSettingsProbe = graphPermissionProbe{
+		permission:  "MailboxSettings.Read",
+		satisfiedBy: []string{"MailboxSettings.Read", "MailboxSettings.ReadWrite"},
+		path:        "users/%s/mailboxSettings",
+	}
+	// auditLogsProbe covers user and service principal sign-in activity and the directory audit and sign-in events.
+	// Without it those are skipped with a warning.
+	auditLogsProbe = graphPermissionProbe{
+		permission:  "AuditLog.Read.All",
+		satisfiedBy: []string{"AuditLog.Read.All"},
+		path:        "auditLogs/directoryAudits",
+	}
+)
+
+// readerActions are the ARM actions the subscription, resource group and role syncers need on every subscription.
+// The Reader role grants all of them.
+var readerActions = []string{
+	"Microsoft.Authorization/roleAssignments/read",
+	"Microsoft.Authorization/roleDefinitions/read",
+	"Microsoft.Resources/subscriptions/resourceGroups/read",
+}
+
+// tokenClaims are the claims of an access token that say what it grants. App-only tokens carry application
+// permissions in roles, delegated tokens, e.g. from the Azure CLI, carry scopes in scp.
+type tokenClaims struct {
+	Roles []string `json:"roles"`
+	Scp   string   `json:"scp"`
+}
+
+// validationReport is what Validate found.
+type validationReport struct {
+	grantedPermissions         []string
+	missingRequiredPermissions []string
+	missingOptionalPermissions []string
+	subscriptions              int
+	subscriptionsWithoutReader []string
+	warnings                   []string
+}
+
+func (r *validationReport) missing(probe graphPermissionProbe) {
+	if probe.required {
+		r.missingRequiredPermissions = append(r.missingRequiredPermissions, probe.permission)
+	} else {
+		r.missingOptionalPermissions = append(r.missingOptionalPermissions, probe.permission)
+	}
+}
+
+func (r *validationReport) warn(format string, args ...any) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+func (r *validationReport) toStruct() (*structpb.Struct, error) {
+	list := func(values []string) []any {
+		rv := make([]any, 0, len(values))
+		for _, v := range values {
+			rv = append(rv, v)
+		}
+		return rv
+	}
+
+	return structpb.NewStruct(map[string]any{
+		"granted_graph_permissions":          list(r.grantedPermissions),
+		"missing_required_graph_permissions": list(r.missingRequiredPermissions),
+		"missing_optional_graph_permissions": list(r.missingOptionalPermissions),
+		"subscriptions":                      r.subscriptions,
+		"subscriptions_without_reader":       list(r.subscriptionsWithoutReader),
+		"warnings":                           list(r.warnings),
+	})
+}
+
+// validate acquires Graph and ARM tokens and probes every endpoint the enabled syncers read. It only returns an
+// error when a probe fails for a reason other than missing access.
+func (d *Connector) validate(ctx context.Context) (*validationReport, error) {
+	report := &validationReport{}
+	cloud := d.azureCloud()
+
+	graphToken, err := d.token.GetToken(ctx, policy.TokenRequestOptions{Scopes: cloud.scopes(graphReadScopes)})
+	if err != nil {
+		return nil, fmt.Errorf("baton-azure-infrastructure: failed to get a Microsoft Graph token: %w", err)
+	}
+	granted, claimsKnown := decodeTokenClaims(graphToken.Token)
+	report.grantedPermissions = granted
+
+	probes := []graphPermissionProbe{usersProbe, groupsProbe, servicePrincipalsProbe}
+	var userID string
+	for _, probe := range probes {
+		resp := &struct {
+			Value []struct {
+				ID string `json:"id"`
+			} `json:"value"`
+		}{}
+		ok, err := d.probeGraph(ctx, probe, granted, claimsKnown, d.buildURL(probe.path, url.Values{"$top": {"1"}, "$select": {"id"}}), resp)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			report.missing(probe)
+		}
+		if probe.path == usersProbe.path && len(resp.Value) > 0 {
+			userID = resp.Value[0].ID
+		}
+	}
+
+	if d.MailboxSettings {
+		if userID == "" {
+			report.warn("no user to read mailbox settings of, %s was not checked", mailboxSettingsProbe.permission)
+		} else {
+			reqURL := d.buildURL(fmt.Sprintf(mailboxSettingsProbe.path, url.PathEscape(userID)), nil)
+			ok, err := d.probeGraph(ctx, mailboxSettingsProbe, granted, claimsKnown, reqURL, &mailboxSettings{})
+			if err != nil && status.Code(err) != codes.NotFound {
+				return nil, err
+			}
+			// Users without a mailbox answer 404, which says nothing about the permission.
+			if !ok && err == nil {
+				report.missing(mailboxSettingsProbe)
+			}
+		}
+	}
+
+	ok, err := d.probeGraph(ctx, auditLogsProbe, granted, claimsKnown, d.buildURL(auditLogsProbe.path, url.Values{"$top": {"1"}}), &struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		report.missing(auditLogsProbe)
+	}
+
+	_, err = d.token.GetToken(ctx, policy.TokenRequestOptions{Scopes: cloud.scopes(armScopes)})
+	if err != nil {
+		return nil, fmt.Errorf("baton-azure-infrastructure: failed to get an Azure Resource Manager token: %w", err)
+	}
+
+	subscriptionIDs, err := d.listSubscriptionIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("baton-azure-infrastructure: failed to list subscriptions: %w", err)
+	}
+	report.subscriptions = len(subscriptionIDs)
+	if len(subscriptionIDs) == 0 {
+		report.warn("no subscriptions are visible, assign the Reader role on the subscriptions to sync")
+	}
+
+	var (
+		mu         sync.Mutex
+		withReader = make(map[string]bool)
+	)
+	err = d.forEachSubscription(ctx, subscriptionIDs, func(ctx context.Context, subscriptionID string) error {
+		ok, err := d.hasReaderAccess(ctx, subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		withReader[subscriptionID] = ok
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, subscriptionID := range subscriptionIDs {
+		if !withReader[subscriptionID] {
+			report.subscriptionsWithoutReader = append(report.subscriptionsWithoutReader, subscriptionID)
+		}
+	}
+
+	return report, nil
+}
+
+// probeGraph reports whether the connector may read probe's endpoint. Access is missing when Graph refuses the
+// request, or when the token lists what it grants and none of it satisfies the probe.
+func (d *Connector) probeGraph(ctx context.Context, probe graphPermissionProbe, granted []string, claimsKnown bool, reqURL string, res interface{}) (bool, error) {
+	err := d.query(ctx, graphReadScopes, http.MethodGet, reqURL, nil, res)
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return false, nil
+	default:
+		return false, fmt.Errorf("baton-azure-infrastructure: failed to probe %s: %w", probe.path, err)
+	}
+
+	if claimsKnown && !slices.ContainsFunc(probe.satisfiedBy, func(p string) bool {
+		return slices.ContainsFunc(granted, func(g string) bool { return strings.EqualFold(g, p) })
+	}) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// hasReaderAccess reports whether the connector's permissions on a subscription include readerActions.
+func (d *Connector) hasReaderAccess(ctx context.Context, subscriptionID string) (bool, error) {
+	v := url.Values{}
+	v.Set("api-version", permissionsAPIVersion)
+	reqURL := d.buildARMURL(path.Join("subscriptions", subscriptionID, "providers/Microsoft.Authorization/permissions"), v)
+
+	var permissions []*armauthorization.Permission
+	for reqURL != "" {
+		resp := &armauthorization.PermissionGetResult{}
+		err := d.query(ctx, armScopes, http.MethodGet, reqURL, nil, resp)
+		if err != nil {
+			if code := status.Code(err); code == codes.PermissionDenied || code == codes.Unauthenticated {
+				return false, nil
+			}
+			return false, err
+		}
+
+		permissions = append(permissions, resp.Value...)
+		reqURL = StringValue(resp.NextLink)
+	}
+
+	for _, action := range readerActions {
+		if !actionAllowed(permissions, action) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// actionAllowed reports whether any of the permissions allows action without also excluding it.
+// https://learn.microsoft.com/en-us/azure/role-based-access-control/role-definitions#actions
+func actionAllowed(permissions []*armauthorization.Permission, action string) bool {
+	for _, permission := range permissions {
+		if permission == nil {
+			continue
+		}
+
+		matches := func(patterns []*string) bool {
+			return slices.ContainsFunc(patterns, func(pattern *string) bool {
+				return matchAction(StringValue(pattern), action)
+			})
+		}
+		if matches(permission.Actions) && !matches(permission.NotActions) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchAction matches an action against a pattern where * stands for any sequence of characters.
+// Actions are case-insensitive.
+func matchAction(pattern, action string) bool {
+	pattern, action = strings.ToLower(pattern), strings.ToLower(action)
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == action
+	}
+
+	if !strings.HasPrefix(action, parts[0]) {
+		return false
+	}
+	action = action[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(action, part)
+		if i < 0 {
+			return false
+		}
+		action = action[i+len(part):]
+	}
+
+	return strings.HasSuffix(action, parts[len(parts)-1])
+}
+
+// decodeTokenClaims returns the application permissions or delegated scopes of a JWT access token. The second
+// result is false when the token can't be decoded or lists neither, e.g. for opaque tokens.
+func decodeTokenClaims(token string) ([]string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, false
+	}
+
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, false
+	}
+
+	granted := append([]string{}, claims.Roles...)
+	granted = append(granted, strings.Fields(claims.Scp)...)
+	if len(granted) == 0 {
+		return nil, false
+	}
+
+	return granted, true
+}
+
+// validationError reports missing required permissions as a PermissionDenied status with a PreconditionFailure
+// violation for each of them.
+func validationError(report *validationReport) error {
+	if len(report.missingRequiredPermissions) == 0 {
+		return nil
+	}
+
+	violations := make([]*errdetails.PreconditionFailure_Violation, 0, len(report.missingRequiredPermissions))
+	for _, permission := range report.missingRequiredPermissions {
+		violations = append(violations, &errdetails.PreconditionFailure_Violation{
+			Type:        "GRAPH_APPLICATION_PERMISSION",
+			Subject:     permission,
+			Description: fmt.Sprintf("the app registration needs the %s Microsoft Graph application permission", permission),
+		})
+	}
+
+	st := status.New(codes.PermissionDenied, fmt.Sprintf("baton-azure-infrastructure: missing required Microsoft Graph permissions: %s",
+		strings.Join(report.missingRequiredPermissions, ", ")))
+	withDetails, err := st.WithDetails(&errdetails.PreconditionFailure{Violations: violations})
+	if err != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
+
+// logValidationWarnings logs the missing optional access found by validate.
+func logValidationWarnings(ctx context.Context, report *validationReport) {
+	l := ctxzap.Extract(ctx)
+	for _, permission := range report.missingOptionalPermissions {
+		l.Warn("baton-azure-infrastructure: missing optional Microsoft Graph permission", zap.String("permission", permission))
+	}
+	if len(report.subscriptionsWithoutReader) > 0 {
+		l.Warn("baton-azure-infrastructure: subscriptions without Reader access are synced partially",
+			zap.Strings("subscription_ids", report.subscriptionsWithoutReader),
+		)
+	}
+	for _, warning := range report.warnings {
+		l.Warn("baton-azure-infrastructure: " + warning)
+	}
+}
+
+// validationAnnotations carries the report to the caller of Validate.
+func validationAnnotations(report *validationReport) (annotations.Annotations, error) {
+	reportStruct, err := report.toStruct()
+	if err != nil {
+		return nil, fmt.Errorf("baton-azure-infrastructure: failed to build validation report: %w", err)
+	}
+
+	var annos annotations.Annotations
+	annos.Update(reportStruct)
+	return annos, nil
+}
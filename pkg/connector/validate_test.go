@@ -0,0 +1,113 @@
+package connector
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type claimsToken struct {
+	roles []string
+}
+
+func (c claimsToken) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	payload, err := json.Marshal(map[string]interface{}{"roles": c.roles})
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	return azcore.AccessToken{Token: "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"}, nil
+}
+
+func TestValidate(t *testing.T) {
+	groupsStatus := http.StatusForbidden
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/v1.0/users":
+			return jsonResponse(http.StatusOK, map[string]interface{}{"value": []map[string]string{{"id": "u1"}}})
+		case "/v1.0/groups":
+			return jsonResponse(groupsStatus, map[string]interface{}{"value": []map[string]string{}})
+		case "/v1.0/servicePrincipals":
+			return jsonResponse(http.StatusOK, map[string]interface{}{"value": []map[string]string{}})
+		case "/v1.0/auditLogs/directoryAudits":
+			return jsonResponse(http.StatusOK, map[string]interface{}{"value": []map[string]string{}})
+		case "/v1.0/users/u1/mailboxSettings":
+			return jsonResponse(http.StatusForbidden, map[string]interface{}{
+				"error": map[string]string{"code": "ErrorAccessDenied"},
+			})
+		case "/subscriptions":
+			return jsonResponse(http.StatusOK, map[string]interface{}{
+				"value": []map[string]string{{"subscriptionId": "s1"}, {"subscriptionId": "s2"}},
+			})
+		case "/subscriptions/s1/providers/Microsoft.Authorization/permissions":
+			return jsonResponse(http.StatusOK, map[string]interface{}{
+				"value": []map[string][]string{{"actions": {"*/read"}}},
+			})
+		case "/subscriptions/s2/providers/Microsoft.Authorization/permissions":
+			return jsonResponse(http.StatusOK, map[string]interface{}{
+				"value": []map[string][]string{{"actions": {"*"}, "notActions": {"Microsoft.Authorization/*"}}},
+			})
+		default:
+			return jsonResponse(http.StatusNotFound, map[string]interface{}{})
+		}
+	})
+
+	c, err := newConnector(context.Background(), &http.Client{Transport: transport}, true, false, WithMaxRetries(0))
+	require.NoError(t, err)
+	c.token = claimsToken{roles: []string{"Directory.Read.All"}}
+	c.clientFactory, err = c.newSubscriptionClientFactory()
+	require.NoError(t, err)
+
+	_, err = c.Validate(context.Background())
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	st, _ := status.FromError(err)
+	require.Len(t, st.Details(), 1)
+	failure, ok := st.Details()[0].(*errdetails.PreconditionFailure)
+	require.True(t, ok)
+	require.Equal(t, "GroupMember.Read.All", failure.GetViolations()[0].GetSubject())
+
+	groupsStatus = http.StatusOK
+	annos, err := c.Validate(context.Background())
+	require.NoError(t, err)
+
+	report := &structpb.Struct{}
+	ok, err = annos.Pick(report)
+	require.NoError(t, err)
+	require.True(t, ok)
+	fields := report.GetFields()
+	require.Equal(t, []interface{}{"MailboxSettings.Read", "AuditLog.Read.All"}, fields["missing_optional_graph_permissions"].GetListValue().AsSlice())
+	require.Equal(t, []interface{}{"s2"}, fields["subscriptions_without_reader"].GetListValue().AsSlice())
+	require.Equal(t, float64(2), fields["subscriptions"].GetNumberValue())
+
+	// Granting AuditLog.Read.All clears the optional warning for it.
+	c.token = claimsToken{roles: []string{"Directory.Read.All", "AuditLog.Read.All"}}
+	annos, err = c.Validate(context.Background())
+	require.NoError(t, err)
+	report = &structpb.Struct{}
+	_, err = annos.Pick(report)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"MailboxSettings.Read"}, report.GetFields()["missing_optional_graph_permissions"].GetListValue().AsSlice())
+
+	c.token = claimsToken{roles: []string{"Application.Read.All"}}
+	_, err = c.Validate(context.Background())
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.ErrorContains(t, err, "User.Read.All, GroupMember.Read.All")
+}
+
+func TestMatchAction(t *testing.T) {
+	require.True(t, matchAction("*", "Microsoft.Authorization/roleAssignments/read"))
+	require.True(t, matchAction("*/read", "Microsoft.Authorization/roleAssignments/read"))
+	require.True(t, matchAction("microsoft.authorization/*/read", "Microsoft.Authorization/roleAssignments/read"))
+	require.True(t, matchAction("Microsoft.Authorization/roleAssignments/read", "Microsoft.Authorization/roleAssignments/read"))
+	require.False(t, matchAction("*/write", "Microsoft.Authorization/roleAssignments/read"))
+	require.False(t, matchAction("Microsoft.Resources/*", "Microsoft.Authorization/roleAssignments/read"))
+}